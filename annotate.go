@@ -0,0 +1,99 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Maximum number of annotations carried by a context, see [Annotate].
+const MaxAnnotations = 16
+
+type keyAnnotations struct{}
+
+// Annotation attached to a context with [Annotate].
+type Annotation struct {
+	Key   string
+	Value any
+}
+
+// Returns a copy of ctx carrying the annotations of ctx, if any, followed by the key-value pairs
+// kv, so the detail of an error can be enriched as the request goes deeper into the call stack,
+// like the fields of a structured logger but for the error response:
+//
+//	ctx = centra.Annotate(ctx, "order", order.ID)
+//	...
+//	ctx = centra.Annotate(ctx, "step", "payment")
+//
+// The keys must be strings, like the ones of slog, other keys are formatted with fmt.Sprint, and a
+// key without value gets "!MISSING". The annotations of the context of the request passed to
+// [Error], or of the one passed to [ErrorCtx], are included by the built-in handlers along with
+// the message of the error when [WithVerboseErrors] is enabled, as in
+// "charge declined (order=123 step=payment)", so they are opt-in as well. At most
+// [MaxAnnotations] are kept, the next ones are dropped.
+func Annotate(ctx context.Context, kv ...any) context.Context {
+	if ctx == nil {
+		panic("centra: nil context.Context passed to Annotate")
+	}
+
+	prev := Annotations(ctx)
+	if len(kv) == 0 || len(prev) >= MaxAnnotations {
+		return ctx
+	}
+
+	// copied, so the annotations of ctx are never changed
+	annotations := make([]Annotation, len(prev), min(len(prev)+(len(kv)+1)/2, MaxAnnotations))
+	copy(annotations, prev)
+	for i := 0; i < len(kv) && len(annotations) < MaxAnnotations; i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value any = "!MISSING"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		annotations = append(annotations, Annotation{Key: key, Value: value})
+	}
+	return context.WithValue(ctx, keyAnnotations{}, annotations)
+}
+
+// Returns the annotations attached to ctx with [Annotate], in the order they were attached, or
+// nil if there are none. The returned slice must not be modified.
+func Annotations(ctx context.Context) []Annotation {
+	annotations, _ := ctx.Value(keyAnnotations{}).([]Annotation)
+	return annotations
+}
+
+// formatAnnotations formats annotations as space-separated key=value pairs, quoting the values
+// with spaces, or returns an empty string if there are none.
+func formatAnnotations(annotations []Annotation) string {
+	var b strings.Builder
+	for i, a := range annotations {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		value := fmt.Sprint(a.Value)
+		if strings.ContainsAny(value, " =\"") {
+			value = fmt.Sprintf("%q", value)
+		}
+		b.WriteString(a.Key)
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	testCases := map[string]struct {
+		Verbose  bool
+		Annotate func(ctx context.Context) context.Context
+
+		ExpectedDetail string
+	}{
+		"Two_Levels": {
+			Verbose: true,
+			Annotate: func(ctx context.Context) context.Context {
+				ctx = Annotate(ctx, "order", 123)
+				return Annotate(ctx, "step", "charge card")
+			},
+			ExpectedDetail: `declined (order=123 step="charge card")`,
+		},
+		"Missing_Value_And_Non_String_Key": {
+			Verbose: true,
+			Annotate: func(ctx context.Context) context.Context {
+				return Annotate(ctx, 1, "one", "two")
+			},
+			ExpectedDetail: "declined (1=one two=!MISSING)",
+		},
+		"None": {
+			Verbose:        true,
+			Annotate:       func(ctx context.Context) context.Context { return ctx },
+			ExpectedDetail: "declined",
+		},
+		"Not_Verbose": {
+			Verbose: false,
+			Annotate: func(ctx context.Context) context.Context {
+				return Annotate(ctx, "order", 123)
+			},
+			ExpectedDetail: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(tc.Verbose))
+			errMux.Handle(errString("declined"), ProblemDetailsHandler(http.StatusPaymentRequired))
+
+			r := httptest.NewRequest("", "/", nil)
+			r = r.WithContext(tc.Annotate(r.Context()))
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(r, errMux), errString("declined"))
+
+			var problem struct {
+				Detail string `json:"detail"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if tc.ExpectedDetail != problem.Detail {
+				t.Fatalf("expected detail %q, got %q", tc.ExpectedDetail, problem.Detail)
+			}
+		})
+	}
+}
+
+func TestAnnotateBounded(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < MaxAnnotations+4; i++ {
+		ctx = Annotate(ctx, "k"+strconv.Itoa(i), i)
+	}
+
+	annotations := Annotations(ctx)
+	if len(annotations) != MaxAnnotations {
+		t.Fatalf("expected %d annotations, got %d", MaxAnnotations, len(annotations))
+	}
+	if last := annotations[MaxAnnotations-1]; last.Key != "k"+strconv.Itoa(MaxAnnotations-1) {
+		t.Fatalf("expected the last annotations to be dropped, got %v", last)
+	}
+
+	// annotating a context doesn't change the annotations of its parent
+	parent := Annotate(context.Background(), "a", 1)
+	Annotate(parent, "b", 2)
+	Annotate(parent, "c", 3)
+	if got := Annotations(parent); len(got) != 1 {
+		t.Fatalf("expected the parent to keep 1 annotation, got %v", got)
+	}
+}
@@ -16,31 +16,200 @@ package centra
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"html"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type handlerStruct struct {
 	err     error
 	handler ErrorHandlerFunc
+
+	// matches the errors that handler handles, IsMatcher(err) for the handlers registered with
+	// Mux.Handle, see handlerStruct.plain for the ones where err is a placeholder describing the
+	// match instead.
+	matcher Matcher
+
+	// handler only handles err itself, see Mux.HandleExact
+	exact bool
+
+	// name given with Mux.HandleNamed
+	name string
+
+	// if not 0, handler handles the errors resolving to this status instead, see Mux.HandleStatus
+	status int
+
+	// if not 0, handler handles the errors resolving to a status in [status, statusMax] instead,
+	// see Mux.HandleStatusRange
+	statusMax int
+
+	// handlers with higher priority are consulted first, see Mux.HandleP
+	priority int
+
+	// errors handled by handler are reported to the audit sink, see Mux.HandleAudited
+	audited bool
+
+	// errors handled by handler are client faults, logged at info level, see Mux.HandleExpected
+	expected bool
+
+	// if not empty, handler only handles the errors of the requests with this HTTP method, see
+	// Mux.HandleMethod
+	method string
+
+	// handler is only consulted after the other non-exact handlers, see Mux.HandleRegexp
+	fallback bool
+
+	// outcome the handler was generated from, see Mux.Register
+	outcome *OutcomeSpec
+}
+
+// nilHandlerMessage returns the message of the panic of the registrations of err with a nil
+// handler, identifying err since they are often made in a loop.
+func nilHandlerMessage(err error) string {
+	return fmt.Sprintf("centra: handler must not be nil for error: %v", err)
+}
+
+// Label of the unknown handler, see [MatchedName].
+const UnknownName = "unknown"
+
+// label returns the name of h, defaulting to the message of its registered error, or UnknownName
+// for the unknown handler.
+func (h handlerStruct) label() string {
+	switch {
+	case h.name != "":
+		return h.name
+	case h.err != nil:
+		return h.err.Error()
+	default:
+		return UnknownName
+	}
+}
+
+// matches reports whether target should be handled by h.
+func (h handlerStruct) matches(target error) bool {
+	if h.status != 0 {
+		// only looked up by status, after the other handlers
+		return false
+	}
+	if h.matcher == nil {
+		// the handlers that are not registered, like the UnknownHandler
+		return errors.Is(target, h.err)
+	}
+	return h.matcher.Match(target)
+}
+
+// plain reports whether h matches its registered error itself, through errors.Is or identity,
+// instead of a placeholder describing the match, like the handlers registered with
+// Mux.HandleMatcher.
+func (h handlerStruct) plain() bool {
+	switch h.matcher.(type) {
+	case isMatcher, exactMatcher:
+		return true
+	default:
+		return false
+	}
 }
 
 // Multiplexer error handler, multiplexes a call to [Error] to the registered error handler,
 // if error is not found, then a call to the registered UnknownHandler is made.
+//
+// Registrations are copy-on-write: every call that modifies the Mux stores a new snapshot of its
+// registrations, and [Error] dispatches using the snapshot that was current when it was called,
+// without taking any lock. So a slow error handler never blocks a concurrent registration, and
+// a registration takes effect for the subsequent calls to [Error].
+//
+// All the methods of Mux are safe to be called concurrently, among themselves and with [Error]:
+// Handle and the other registration methods may be called while requests are being handled,
+// the newly registered handlers take effect for the calls to Error made after they return, and
+// the calls to Error in progress keep using the handlers they started with.
+//
+// Matching an error against the registered handlers doesn't allocate, and dispatching it to the
+// matched handler only allocates once, the request passed to the handler together with its
+// context, which carries the data returned by [Matched] and the like, as [Mux.Handler] only
+// allocates the request passed to the next handler. The options, middlewares and
+// handlers in use may allocate on their own, as well as the errors that need an errors.As to be
+// matched, like the ones reaching the UnknownHandler, which are checked for a [StatusCoder].
+//
+// For the same reasons, a Mux can be shared by several routers and http.Server instances, for
+// example a public and an admin server, they dispatch concurrently without coordinating, see
+// [Mux.Shared]. The state kept by the options, like the counters of [WithSampledLogging], is
+// shared as well.
 type Mux struct {
+	state atomic.Pointer[muxState]
+	cfg   config
+
+	// serializes the writers of state
+	mu sync.Mutex
+
+	// occurrences of the errors logged by label of their handler, see WithSampledLogging
+	logCounts sync.Map
+}
+
+// muxState is an immutable snapshot of the registrations of a Mux.
+type muxState struct {
 	handlersStack []handlerStruct
-	mu            sync.RWMutex
+	middlewares   []func(ErrorHandlerFunc) ErrorHandlerFunc
+	finalizers    []ErrorHandlerFunc
+	sealed        bool
+	parent        *Mux
+
+	// some handler has been registered with Mux.HandleMethod
+	methods bool
+
+	// classifiers of the errors always handled by the UnknownHandler, see Mux.ForceUnknown
+	forceUnknown []func(err error) bool
+}
+
+// UnknownHandler of the Mux returned by [NewMux], so the library-wide default can be changed
+// once, for example in tests. It's read by NewMux, so it must be set before the Mux are created,
+// setting it doesn't change the UnknownHandler of the existing ones. If it's nil,
+// [DefaultUnknownHandler] is used.
+var DefaultUnknown ErrorHandlerFunc = DefaultUnknownHandler
+
+// Whether [Error] and the other functions looking up the Mux installed in the request panic when
+// there is none, most likely because the [Mux.Handler] middleware has been registered after the
+// handlers calling them. If it's false, the error is handled by [DefaultUnknownHandler] instead,
+// so a misrouted request gets a generic error response instead of an aborted connection, if the
+// panic is not recovered. Must be set before any request is handled.
+var PanicOnMissingMux = true
+
+// Returns a new Mux configured with opts, with UnknownHandler set to [DefaultUnknown] unless
+// [WithUnknownHandler] is given.
+func NewMux(opts ...Option) *Mux {
+	m := &Mux{}
+	for _, opt := range opts {
+		opt(&m.cfg)
+	}
+
+	m.state.Store(m.initialState())
+	return m
 }
 
-// Returns a new Mux with UnknownHandler set to DefaultUnknownError.
-func NewMux() *Mux {
-	return &Mux{
+// initialState returns the registrations of a new Mux, with only the UnknownHandler set.
+func (m *Mux) initialState() *muxState {
+	unknown := m.cfg.unknown
+	if unknown == nil {
+		unknown = DefaultUnknown
+	}
+	if unknown == nil {
+		unknown = DefaultUnknownHandler
+	}
+
+	return &muxState{
 		handlersStack: []handlerStruct{
 			{
 				err:     nil,
-				handler: DefaultUnknownHandler,
+				handler: unknown,
 			},
 		},
 	}
@@ -51,119 +220,1471 @@ type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
 
 type keyContext struct{}
 
+// Returns m itself, it only signals the intent of sharing m across several routers or servers,
+// which is safe as any other concurrent use of a Mux, see [Mux]:
+//
+//	errMux := centra.NewMux()
+//	public := &http.Server{Handler: errMux.Shared().Handler(publicRouter)}
+//	admin := &http.Server{Handler: errMux.Shared().Handler(adminRouter)}
+//
+// The registrations made on m after the servers start take effect for both of them.
+func (m *Mux) Shared() *Mux {
+	return m
+}
+
 // Middleware handler, compatible with Chi router, changes the request's context and adds
 // the error handlers to it.
 func (m *Mux) Handler(next http.Handler) http.Handler {
+	return m.HandlerWithKey(keyContext{}, next)
+}
+
+// Same as [Mux.Handler], reads better when wrapping a single route of the standard library
+// [http.ServeMux], including the method and path patterns:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("GET /users/{id}", errMux.Wrap(getUser))
+//
+// The wrapped handler can read the path values of the pattern with [http.Request.PathValue],
+// since the Mux is added to the same request the ServeMux matched.
+func (m *Mux) Wrap(h http.Handler) http.Handler {
+	return m.Handler(h)
+}
+
+// Returns [Mux.Handler] as the func(http.Handler) http.Handler middleware expected by most
+// middleware stacks built on top of [http.ServeMux] and by community routers:
+//
+//	mux := http.NewServeMux()
+//	mux.HandleFunc("GET /users/{id}", getUser)
+//	http.ListenAndServe(":8080", errMux.Middleware()(mux))
+func (m *Mux) Middleware() func(http.Handler) http.Handler {
+	return m.Handler
+}
+
+// Same as [Mux.Handler], but the Mux is added to the request's context under key, so it doesn't
+// replace a Mux added by [Mux.Handler] or by HandlerWithKey with a different key. Errors must
+// then be handled with [ErrorWithKey] and the same key.
+//
+// This allows partitioning the error handling of the same request by concern, for example, a
+// Mux for authentication errors and another one for business errors. key must be comparable,
+// like the keys passed to context.WithValue, it's recommended to use an unexported type.
+func (m *Mux) HandlerWithKey(key any, next http.Handler) http.Handler {
+	if key == nil {
+		panic("centra: key must not be nil")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("centra: key must be comparable")
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(context.WithValue(r.Context(), keyContext{}, m))
+		next.ServeHTTP(w, setMux(r, key, m))
+	})
+}
 
+// Returns a middleware meant for development and tests that catches the calls to [Error] made
+// after the handler has already written a successful (2xx) response, which is most likely a bug,
+// like calling Error on a success path, and the cause of the "superfluous WriteHeader" warnings:
+//
+//	router.Use(errMux.Handler, errMux.GuardSuccess)
+//
+// The mistake is reported with a panic, or logged at error level, along with the status already
+// written and the error, if [WithGuardLogging] is in use, and then the error is handled as usual.
+// The calls to Error made before writing the response are not affected.
+//
+// The writer passed to next is wrapped to track the status code, it only exposes the optional
+// interfaces of the original one through [http.ResponseController].
+func (m *Mux) GuardSuccess(next http.Handler) http.Handler {
+	if next == nil {
+		panic("centra: next must not be nil")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = wrapWriter(w)
+		findWriter(w).guard = m
 		next.ServeHTTP(w, r)
 	})
 }
 
+// successViolated reports a call to Error with err after status has been written, see
+// Mux.GuardSuccess.
+func (m *Mux) successViolated(r *http.Request, status int, err error) {
+	const msg = "centra: Error called after a successful response was written"
+	if !m.cfg.guardLogging {
+		panic(fmt.Sprintf("%s with status %d, error: %v", msg, status, err))
+	}
+
+	logger := m.cfg.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(r.Context(), slog.LevelError, msg, slog.Int("status", status), slog.Any("error", err))
+}
+
+// Returns an http.Handler that handles err with m every time it's served, as if [Error] had been
+// called with m installed in the request, useful for previewing the error pages or for routes
+// that always fail with the same error. The normal matching is used, so the response is the same
+// one the users get. m is installed in the request passed to the handlers.
+func (m *Mux) ErrorHandler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeError(w, r, err)
+	})
+}
+
+// Returns an error handler that handles its error with m, as if [Error] had been called with m
+// installed in the request, so a configured Mux can be composed explicitly with other error
+// handling code, for example as the UnknownHandler of another Mux:
+//
+//	api.UnknownHandler(shared.AsHandlerFunc())
+//
+// The normal matching is used, including the special case of the nil error, which is handled by
+// the UnknownHandler of m. m is installed in the request passed to the handlers.
+func (m *Mux) AsHandlerFunc() ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		m.ServeError(w, r, err)
+	}
+}
+
+// Returns an http.HandlerFunc that calls fn and, if it returns an error, handles it with
+// [Error], so the handlers can just return their errors instead of calling Error at every
+// return, which fits the routers without an error-handling convention, like chi:
+//
+//	router.Get("/users/{id}", errMux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+//		user, err := repo.User(chi.URLParam(r, "id"))
+//		if err != nil {
+//			return err
+//		}
+//		return json.NewEncoder(w).Encode(user)
+//	}))
+//
+// The error is handled by the Mux installed in the request, usually by [Mux.Handler], or by m if
+// there is none, in which case m is installed in the request passed to the handler.
+func (m *Mux) HandlerFunc(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r)
+		if err == nil {
+			return
+		}
+		mux := getMux(r)
+		if mux == nil {
+			mux, r = m, setMux(r, keyContext{}, m)
+		}
+		errorWithMux(mux, w, r, err)
+	}
+}
+
+// Returns an http.Handler that installs m in the request, like [Mux.Handler] does, calls h with
+// it and handles the error it returns, if any, with m, so a route of the codebases defining their
+// own error-returning handler type is adapted in one step, without a separate middleware:
+//
+//	type Handler func(w http.ResponseWriter, r *http.Request) error
+//
+//	mux.Handle("GET /users/{id}", errMux.Adapt(getUser))
+//
+// m is not installed again if it's already installed in the request, for example by
+// [Mux.Handler] wrapping the whole router. Unlike [Mux.HandlerFunc], which defers to the Mux
+// already installed in the request, the errors returned by h are always handled by m.
+func (m *Mux) Adapt(h func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	if h == nil {
+		panic("centra: h must not be nil")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getMux(r) != m {
+			r = setMux(r, keyContext{}, m)
+		}
+		if err := h(w, r); err != nil {
+			errorWithMux(m, w, r, err)
+		}
+	})
+}
+
+// Middleware handler, compatible with Negroni, installs m in the request's context like
+// [Mux.Handler] does, and calls next with it.
+func (m *Mux) Negroni(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	next(w, setMux(r, keyContext{}, m))
+}
+
+// Reports whether a Mux is installed in r, by [Mux.Handler] or [SetMux], so [Error] can be called
+// with r. Handlers that may be mounted without the middleware can check it to fall back to another
+// response instead of panicking. The Mux installed by [Mux.HandlerWithKey] is not reported.
+func IsInstalled(r *http.Request) bool {
+	return getMux(r) != nil
+}
+
+// Returns a shallow copy of r with m installed in its context, so [Error] can be called with the
+// returned request. It's what [Mux.Handler] does before calling the next handler, useful when
+// the middleware can't be inserted where it's needed and the request is already at hand.
+func SetMux(r *http.Request, m *Mux) *http.Request {
+	if m == nil {
+		panic("centra: m must not be nil")
+	}
+
+	return setMux(r, keyContext{}, m)
+}
+
+func setMux(r *http.Request, key any, m *Mux) *http.Request {
+	f := &muxFrame{Context: r.Context(), key: key, mux: m}
+	// copied into f, so the request doesn't need an allocation of its own
+	f.req = *r.WithContext(f)
+	return &f.req
+}
+
+// muxFrame is the context of the requests in which a Mux has been installed under key, allocated
+// at once with the request itself, see setMux. It behaves like context.WithValue(ctx, key, mux).
+type muxFrame struct {
+	context.Context
+	key any
+	mux *Mux
+	req http.Request
+}
+
+func (f *muxFrame) Value(key any) any {
+	if key == f.key {
+		return f.mux
+	}
+	return f.Context.Value(key)
+}
+
+// load returns the current snapshot of the registrations of m.
+func (m *Mux) load() *muxState {
+	s := m.state.Load()
+	if s == nil {
+		panic("centra: Mux has not been initialized correctly, please call NewMux()")
+	}
+	return s
+}
+
+// update calls fn with a copy of the current snapshot and stores it as the new current one,
+// method is the name of the calling method, used in the panic message if m is sealed.
+func (m *Mux) update(method string, fn func(s *muxState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.load()
+	if old.sealed {
+		panic("centra: Mux is sealed, cannot call " + method + "() after Seal()")
+	}
+
+	s := *old
+	s.handlersStack = append([]handlerStruct(nil), old.handlersStack...)
+	s.middlewares = append([]func(ErrorHandlerFunc) ErrorHandlerFunc(nil), old.middlewares...)
+	s.finalizers = append([]ErrorHandlerFunc(nil), old.finalizers...)
+	s.forceUnknown = append([]func(error) bool(nil), old.forceUnknown...)
+
+	fn(&s)
+
+	m.state.Store(&s)
+}
+
 // Sets handler to handle err when a call to Error(w, r, errOrWrappedErr) is made in the context
 // of a http request.
+//
+// err matches the errors for which errors.Is(errOrWrappedErr, err) reports true, see [IsMatcher]
+// and [Mux.HandleMatcher] for the other matching strategies. Note that errors.Is only calls the
+// Is methods of the errors in the chain of errOrWrappedErr, the Is method of err, if any, is
+// never called, see [Mux.HandleMatch] for that.
+//
+// When several handlers match, the last registered one wins, see [WithMostSpecific] to select the
+// one of the most specific error instead, like a wrapping error over the base error it wraps. The
+// exception are the errors that join others, implementing "Unwrap() []error" like the ones returned
+// by errors.Join: each of their errors is matched in order, and the handler of the first one with a
+// match is selected, so in errors.Join(ErrA, ErrB) the handler of ErrA wins over the one of ErrB.
+// The handlers matching the errors that wrap the joined error are only selected if none of the
+// joined errors has a match.
+//
+// Registering an error identical to an already registered one is allowed by default, see
+// [WithStrictDuplicates] and [WithOnDuplicate] to detect it.
 func (m *Mux) Handle(err error, handler ErrorHandlerFunc) {
 	if err == nil {
 		panic("centra: err must not be nil")
 	}
 
 	if handler == nil {
-		panic("centra: handler must not be nil")
+		panic(nilHandlerMessage(err))
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.handle("Handle", handlerStruct{
+		err:     err,
+		handler: handler,
+		matcher: IsMatcher(err),
+	})
+}
 
-	if len(m.handlersStack) == 0 {
-		panic("centra: Mux has not been initialized correctly, please call NewMux()")
+// Same as [Mux.Handle], but the handler is built by calling provider the first time err is
+// matched, so the handlers expensive to set up, like the ones parsing a large template, cost
+// nothing until their error path fires:
+//
+//	errMux.HandleLazy(ErrMaintenance, func() centra.ErrorHandlerFunc {
+//		tmpl := template.Must(template.ParseFS(pages, "maintenance.html"))
+//		return centra.TemplateHandler(tmpl, "maintenance.html", http.StatusServiceUnavailable)
+//	})
+//
+// provider is called at most once, even if err is matched concurrently, the other calls waiting
+// for it to return. If provider panics, or returns a nil handler, which panics too, every call
+// handling err panics.
+func (m *Mux) HandleLazy(err error, provider func() ErrorHandlerFunc) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if provider == nil {
+		panic("centra: provider must not be nil for error: " + err.Error())
+	}
+
+	handler := sync.OnceValue(func() ErrorHandlerFunc {
+		h := provider()
+		if h == nil {
+			panic(fmt.Sprintf("centra: provider returned a nil handler for error: %v", err))
+		}
+		return h
+	})
+
+	m.handle("HandleLazy", handlerStruct{
+		err: err,
+		handler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handler()(w, r, err)
+		},
+		matcher: IsMatcher(err),
+	})
+}
+
+// Registers every entry of mapping with [Mux.Handle], the handler of the nil key, if any, being
+// set as the UnknownHandler.
+//
+// Since the iteration order of maps is random, the entries are registered sorted by the message
+// of their errors, so the result is deterministic, but those messages are rarely a meaningful
+// precedence: HandleMap is meant for errors without errors.Is relationships between them, the
+// overlapping ones should be registered with Handle in the intended order instead.
+func (m *Mux) HandleMap(mapping map[error]ErrorHandlerFunc) {
+	errs := make([]error, 0, len(mapping))
+	for err := range mapping {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+
+	if handler, ok := mapping[nil]; ok {
+		m.UnknownHandler(handler)
+	}
+	for _, err := range errs {
+		m.Handle(err, mapping[err])
+	}
+}
+
+// Registers every entry of statuses with [Mux.Handle], all of them sharing render as their handler,
+// so the sentinels that only differ in their status code keep the same rendering style:
+//
+//	errMux.HandleStatusMap(map[error]int{
+//		ErrNotFound:  http.StatusNotFound,
+//		ErrConflict:  http.StatusConflict,
+//		ErrForbidden: http.StatusForbidden,
+//	}, centra.DefaultUnknownHandler)
+//
+// The status mapped to the matched sentinel is hinted to render like [ErrorStatus] does, render
+// retrieves it with [Status], the built-in handlers that honor the hinted status, like
+// [DefaultUnknownHandler], write it directly. The entries are registered sorted, see
+// [Mux.HandleMap].
+func (m *Mux) HandleStatusMap(statuses map[error]int, render ErrorHandlerFunc) {
+	if render == nil {
+		panic("centra: render must not be nil")
+	}
+
+	errs := make([]error, 0, len(statuses))
+	for err, status := range statuses {
+		if err == nil {
+			panic("centra: err must not be nil")
+		}
+		if status < 100 || status > 999 {
+			panic("centra: invalid status code " + strconv.Itoa(status))
+		}
+		errs = append(errs, err)
+	}
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+
+	for _, err := range errs {
+		status := statuses[err]
+		m.Handle(err, func(w http.ResponseWriter, r *http.Request, err error) {
+			render(w, r.WithContext(context.WithValue(r.Context(), keyStatus{}, status)), err)
+		})
+	}
+}
+
+// Registers err, like [Mux.Handle], with a handler that only writes the status code status, see
+// [StatusOnlyHandler], making visible that nothing meaningful is done for err on purpose, instead
+// of letting it reach the UnknownHandler.
+func (m *Mux) Ignore(err error, status int) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if status < 100 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
 	}
 
-	m.handlersStack = append(m.handlersStack, handlerStruct{
+	m.handle("Ignore", handlerStruct{
 		err:     err,
-		handler: handler,
+		handler: StatusOnlyHandler(status),
 	})
 }
 
-// Sets handler to handle unknown errors when a call to Error(w, r, err) doesn't find a registered
-// error handler for err.
-func (m *Mux) UnknownHandler(handler ErrorHandlerFunc) {
-	if handler == nil {
-		panic("centra: handler must not be nil")
+// Same as [Mux.Handle], but name identifies the registration, it's returned by [MatchedName] and
+// written in the debug header enabled with [WithDebugHeader] when handler is selected. Unlike the
+// message of err, name is chosen to be shown in diagnostics.
+func (m *Mux) HandleNamed(name string, err error, handler ErrorHandlerFunc) {
+	if name == "" {
+		panic("centra: name must not be empty")
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
 
-	if len(m.handlersStack) == 0 {
-		panic("centra: Mux has not been initialized correctly, please call NewMux()")
+	if handler == nil {
+		panic(nilHandlerMessage(err))
 	}
 
-	m.handlersStack[0] = handlerStruct{
-		err:     nil,
+	m.handle("HandleNamed", handlerStruct{
+		err:     err,
 		handler: handler,
-	}
+		name:    name,
+	})
 }
 
-// Returns the registered UnknownHandler, if [Mux.UnknownHandler] has not been called yet,
-// by default it is [DefaultUnknownHandler]
-func (m *Mux) GetUnknownHandler() ErrorHandlerFunc {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Same as [Mux.Handle], but the handlers with higher priority are consulted before the ones with
+// lower priority, regardless of registration order, making precedence explicit when the
+// registrations are spread across packages whose initialization order is not obvious. The
+// handlers registered by the other methods, like [Mux.Handle], have priority 0, and within the
+// same priority the last registered handler wins as usual.
+//
+// Priority doesn't change the precedence of the handlers registered with [Mux.HandleExact],
+// which are always consulted first, ordered by their own priority, nor the one of the
+// errors joined with errors.Join, see [Mux.Handle].
+func (m *Mux) HandleP(priority int, err error, handler ErrorHandlerFunc) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
 
-	if len(m.handlersStack) == 0 {
-		panic("centra: Mux has not been initialized correctly, please call NewMux()")
+	if handler == nil {
+		panic(nilHandlerMessage(err))
 	}
 
-	return m.handlersStack[0].handler
+	m.handle("HandleP", handlerStruct{
+		err:      err,
+		handler:  handler,
+		priority: priority,
+	})
 }
 
-// Error search for registered error handlers to handle err, if no error handler is found, then
-// it calls the registered UnknownHandler
-func Error(w http.ResponseWriter, r *http.Request, err error) {
-	mux := getMux(r)
-	if mux == nil {
-		// TODO: panic or DefaultUnknownHandler?
-		//
-		// For now we are panicking, since this should be a invalid state for the library,
-		// and calling Default may not be desired behaviour.
-		panic("centra: Mux has not been initialized, cannot call Error() for this request")
+// Same as [Mux.Handle], but the errors handled by handler are reported to the audit sink set with
+// [WithAuditSink] before calling handler, even if it doesn't write the response, keeping an audit
+// trail of the security-relevant errors, like authentication failures and permission denials,
+// separate from the general logging.
+func (m *Mux) HandleAudited(err error, handler ErrorHandlerFunc) {
+	if err == nil {
+		panic("centra: err must not be nil")
 	}
-	mux.mu.RLock()
-	defer mux.mu.RUnlock()
-	if len(mux.handlersStack) == 0 {
-		panic("centra: Mux has not been initialized, cannot call Error() for this request")
+
+	if handler == nil {
+		panic(nilHandlerMessage(err))
 	}
+
+	m.handle("HandleAudited", handlerStruct{
+		err:     err,
+		handler: handler,
+		audited: true,
+	})
+}
+
+// Same as [Mux.Handle], but err is marked as expected, a client fault rather than a server one,
+// like a validation error, so its occurrences don't pollute the error level logs:
+//
+//   - The logger set with [WithLogger] logs them at info level instead of error level.
+//   - The function set with [WithLoggerFunc], meant for the error level logs, is not called.
+//   - handler is called with status hinted as the status code to write, see [ErrorStatus], so
+//     the built-in handlers and the metrics built on the written status, like the ones of
+//     centraprom, count them as status instead of 5xx.
+//
+// The middlewares can tell the expected errors apart with [Expected].
+func (m *Mux) HandleExpected(err error, status int, handler ErrorHandlerFunc) {
 	if err == nil {
-		// as a special case, if err is nil, call unknown handler
-		mux.handlersStack[0].handler(w, r, err)
-		return
+		panic("centra: err must not be nil")
 	}
-	for i := len(mux.handlersStack) - 1; i >= 1; i-- {
-		h := mux.handlersStack[i]
-		if errors.Is(err, h.err) {
-			h.handler(w, r, err)
-			return
-		}
+
+	if status < 100 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
 	}
 
-	// if err is not registered, then call unknown error handler
-	mux.handlersStack[0].handler(w, r, err)
+	if handler == nil {
+		panic(nilHandlerMessage(err))
+	}
+
+	m.handle("HandleExpected", handlerStruct{
+		err: err,
+		handler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handler(w, r.WithContext(context.WithValue(r.Context(), keyStatus{}, status)), err)
+		},
+		expected: true,
+	})
 }
 
-// Default error handler for unknown errors
+// Same as [Mux.Handle], but handler only handles the errors of the requests whose HTTP method is
+// method, compared case-insensitively, so the same error can be rendered differently by method:
 //
-// Writes string "<h1>Internal Server Error</h1>" to w, sets Content-Type to "text/html"
-// and writes status code 500
-func DefaultUnknownHandler(w http.ResponseWriter, r *http.Request, err error) {
-	response := "<h1>Internal Server Error</h1>"
+//	errMux.Handle(ErrNotFound, notFoundPage)
+//	errMux.HandleMethod(http.MethodPost, ErrNotFound, notFoundJSON)
+//
+// The handlers registered for the method of the request are consulted before the ones registered
+// without method matching the same error, regardless of registration order, the latter being the
+// fallback for the other methods. [Mux.Match] and [Mux.Explain], which have no request, ignore
+// them.
+func (m *Mux) HandleMethod(method string, err error, handler ErrorHandlerFunc) {
+	if method == "" {
+		panic("centra: method must not be empty")
+	}
+
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if handler == nil {
+		panic(nilHandlerMessage(err))
+	}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+	m.handle("HandleMethod", handlerStruct{
+		err:     err,
+		handler: handler,
+		method:  strings.ToUpper(method),
+	})
+}
 
-	w.WriteHeader(http.StatusInternalServerError)
+// Sets handler to handle err only when Error(w, r, err) is called with err itself, that is, the
+// error passed to [Error] is identical (==) to err. Unlike [Mux.Handle], errors wrapping err are
+// not handled by handler.
+//
+// Handlers registered with HandleExact are checked before the ones registered with [Mux.Handle],
+// so they win even if a handler registered later matches the error through errors.Is.
+func (m *Mux) HandleExact(err error, handler ErrorHandlerFunc) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if handler == nil {
+		panic(nilHandlerMessage(err))
+	}
+
+	m.handle("HandleExact", handlerStruct{
+		err:     err,
+		handler: handler,
+		exact:   true,
+		matcher: ExactMatcher(err),
+	})
+}
+
+// handle pushes h onto the handlers stack, method is the name of the calling method.
+func (m *Mux) handle(method string, h handlerStruct) {
+	if m.cfg.strictNil && typedNil(h.err) {
+		panic(fmt.Sprintf("centra: err passed to %s() is a nil %T, it can never be matched meaningfully", method, h.err))
+	}
+
+	if h.matcher == nil && h.status == 0 {
+		if h.exact {
+			h.matcher = ExactMatcher(h.err)
+		} else {
+			h.matcher = IsMatcher(h.err)
+		}
+	}
+
+	m.update(method, func(s *muxState) {
+		m.insert(s, method, h)
+	})
+}
+
+// insert adds h to the stack of s, the snapshot of m being updated by method.
+func (m *Mux) insert(s *muxState, method string, h handlerStruct) {
+	if m.cfg.maxHandlers != 0 && len(s.handlersStack)-1 >= m.cfg.maxHandlers {
+		panic(fmt.Sprintf("centra: cannot call %s(), the Mux already has the maximum of %d handlers", method, m.cfg.maxHandlers))
+	}
+
+	if m.cfg.onDuplicate != nil {
+		for _, registered := range s.handlersStack[1:] {
+			if registered.exact == h.exact && registered.method == h.method && identical(registered.err, h.err) {
+				m.cfg.onDuplicate(h.err)
+				break
+			}
+		}
+	}
+
+	// the stack is kept sorted by priority, and in registration order within the same
+	// priority, since it's scanned from the end
+	i := len(s.handlersStack)
+	for i > 1 && s.handlersStack[i-1].priority > h.priority {
+		i--
+	}
+	s.handlersStack = append(s.handlersStack, handlerStruct{})
+	copy(s.handlersStack[i+1:], s.handlersStack[i:])
+	s.handlersStack[i] = h
+
+	if h.method != "" {
+		s.methods = true
+	}
+}
+
+// Registers the handlers of other in m, after the ones already registered, as if they were
+// registered again in m in the same order, so the modules of an application can export their own
+// configured Mux and the application can merge them into its own. For the same error, the
+// handlers of other take precedence over the ones of m, as usual for the handlers registered
+// later, and the duplicates are reported to [WithOnDuplicate] as usual. If adoptUnknown is true,
+// the UnknownHandler of other replaces the one of m, otherwise it's ignored.
+//
+// The middlewares, finalizers, parent and options of other are not merged. other is read from a
+// snapshot, without locking it, so merging Muxes into each other concurrently is safe and later
+// changes to other don't affect m.
+func (m *Mux) Merge(other *Mux, adoptUnknown bool) {
+	if other == nil {
+		panic("centra: other must not be nil")
+	}
+	if other == m {
+		panic("centra: cannot merge a Mux into itself")
+	}
+
+	src := other.load()
+	m.update("Merge", func(s *muxState) {
+		for _, h := range src.handlersStack[1:] {
+			m.insert(s, "Merge", h)
+		}
+		if adoptUnknown {
+			s.handlersStack[0] = src.handlersStack[0]
+		}
+	})
+}
+
+// Sets handler to handle unknown errors when a call to Error(w, r, err) doesn't find a registered
+// error handler for err.
+func (m *Mux) UnknownHandler(handler ErrorHandlerFunc) {
+	if handler == nil {
+		panic("centra: handler must not be nil")
+	}
+
+	m.update("UnknownHandler", func(s *muxState) {
+		s.handlersStack[0] = handlerStruct{
+			err:     nil,
+			handler: handler,
+		}
+	})
+}
+
+// Sets handlers as a fallback chain of UnknownHandler, they are called in order until one of
+// them writes the response, so each one may decline an error by returning without writing the
+// status code nor the body, as reported by [Written], for example a JSON handler that declines
+// if the client doesn't accept JSON. The headers set by a handler that declines are kept. The
+// last handler is the final fallback, it should always write the response.
+func (m *Mux) UnknownHandlers(handlers ...ErrorHandlerFunc) {
+	if len(handlers) == 0 {
+		panic("centra: at least one handler must be given")
+	}
+	for i, h := range handlers {
+		if h == nil {
+			panic(fmt.Sprintf("centra: handler at index %d must not be nil", i))
+		}
+	}
+
+	m.update("UnknownHandlers", func(s *muxState) {
+		s.handlersStack[0] = handlerStruct{
+			err: nil,
+			handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w = wrapWriter(w)
+				for _, h := range handlers {
+					h(w, r, err)
+					if Written(w) {
+						return
+					}
+				}
+			},
+		}
+	})
+}
+
+// Makes [Error] handle the errors for which match reports true with the UnknownHandler, skipping
+// every registered handler, even the ones matching them, as a safety valve so a class of errors,
+// like the ones carrying sensitive details, is always rendered opaquely instead of leaking
+// through a too broad handler:
+//
+//	errMux.ForceUnknown(func(err error) bool {
+//		var e *SQLError
+//		return errors.As(err, &e)
+//	})
+//
+// It takes precedence over every other step of the matching, see [Error], the forced errors are
+// handled like a nil error, by the UnknownHandler of the last parent, see [Mux.WithParent], and
+// the handler receives err as is. It may be called several times, an error is forced if any of
+// the classifiers matches it.
+func (m *Mux) ForceUnknown(match func(err error) bool) {
+	if match == nil {
+		panic("centra: match must not be nil")
+	}
+
+	m.update("ForceUnknown", func(s *muxState) {
+		s.forceUnknown = append(s.forceUnknown, match)
+	})
+}
+
+// Appends middlewares to the Mux, every handler selected by [Error] (including the UnknownHandler)
+// is wrapped by them before being called. Middlewares are applied in the order they were added,
+// the first one being the outermost.
+func (m *Mux) Use(middlewares ...func(ErrorHandlerFunc) ErrorHandlerFunc) {
+	for _, mw := range middlewares {
+		if mw == nil {
+			panic("centra: middleware must not be nil")
+		}
+	}
+
+	m.update("Use", func(s *muxState) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	})
+}
+
+// Appends fn to the finalizers of the Mux, which are called in the order they were added after
+// every handler selected by [Error] returns, whether it matched the error or it's the
+// UnknownHandler, with the same arguments. They are not wrapped by the middlewares, and like
+// them, only the finalizers of the Mux whose handler was selected are called, see
+// [Mux.WithParent].
+//
+// They are meant for side effects like incrementing a metric, the response has usually been
+// written by the time they are called, so they should use [Written] before writing anything.
+func (m *Mux) Finalize(fn ErrorHandlerFunc) {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+
+	m.update("Finalize", func(s *muxState) {
+		s.finalizers = append(s.finalizers, fn)
+	})
+}
+
+// Sets parent as the parent of m, errors that don't match any of the handlers registered in m
+// are handled by parent, as if [Error] had been called with parent installed in the request, so
+// they are matched against the parent's handlers, and then against the handlers of the parent's
+// own parent, if any. It's the UnknownHandler of the last Mux in the chain the one called when
+// no handler matches, the UnknownHandler of a Mux that has a parent is never called.
+//
+// This is useful when installing a different Mux for a subtree of routes, so the Mux of the
+// subtree only needs to register its specific errors. Passing a nil parent removes the current
+// one. Panics if it would create a cycle.
+func (m *Mux) WithParent(parent *Mux) {
+	for p := parent; p != nil; p = p.load().parent {
+		if p == m {
+			panic("centra: WithParent() would create a cycle of Mux")
+		}
+	}
+
+	m.update("WithParent", func(s *muxState) {
+		s.parent = parent
+	})
+}
+
+// Removes all the registrations of m, leaving it as it was returned by [NewMux], with the same
+// options: the handlers, the middlewares, the finalizers and the parent are removed, and the
+// UnknownHandler is restored. Useful to reconfigure a Mux at runtime, for example on a hot
+// reload, while keeping the references to it valid. Panics if m is sealed.
+func (m *Mux) Reset() {
+	m.update("Reset", func(s *muxState) {
+		*s = *m.initialState()
+	})
+}
+
+// Marks the Mux as read-only, subsequent calls to [Mux.Handle], [Mux.UnknownHandler],
+// [Mux.Use], [Mux.Finalize] and [Mux.WithParent] will panic. [Error] keeps working as usual.
+//
+// Call it once all the error handlers have been registered, to make sure no registration happens
+// while handling requests.
+func (m *Mux) Seal() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := *m.load()
+	s.sealed = true
+	m.state.Store(&s)
+}
+
+// Calls fn with m, and returns a function that restores the registrations m had before calling
+// fn, useful to register handlers for a single test and undo it with defer:
+//
+//	defer errMux.With(func(m *centra.Mux) {
+//		m.Handle(ErrNotFound, fakeHandler)
+//	})()
+//
+// The restore function replaces the registrations wholesale, undoing as well the changes made
+// to m after fn returned, including the ones of nested calls to With that were not restored yet.
+// It panics if m has been sealed in the meantime.
+func (m *Mux) With(fn func(m *Mux)) (restore func()) {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+
+	snapshot := m.load()
+	fn(m)
+
+	return func() {
+		m.update("With", func(s *muxState) {
+			*s = *snapshot
+		})
+	}
+}
+
+// Returns the registered errors in registration order, or by priority if [Mux.HandleP] has been
+// used, lowest first, excluding the UnknownHandler and the errors registered in the parent of m,
+// see [Mux.WithParent]. Errors registered with [Mux.HandleExact] and [Mux.HandleNamed] are returned
+// as they were registered, the ones registered with [HandleType] are represented by a placeholder
+// error whose message is "centra: errors of type T", the same one returned by [Matched].
+//
+// It's meant for diagnostics, like listing the configured errors in an admin endpoint, or testing
+// that all the expected errors are registered.
+func (m *Mux) Handlers() []error {
+	stack := m.load().handlersStack[1:]
+
+	errs := make([]error, 0, len(stack))
+	for _, h := range stack {
+		errs = append(errs, h.err)
+	}
+	return errs
+}
+
+// Returns the number of handlers registered in m, excluding the UnknownHandler and the handlers
+// registered in the parent of m, the same as len(m.Handlers()) without allocating.
+func (m *Mux) Len() int {
+	return len(m.load().handlersStack) - 1
+}
+
+// Checks the registrations of m, returning an error joining all the problems found, or nil if
+// there are none, so the setup can fail fast in main() instead of misbehaving later:
+//
+//   - m has not been created with [NewMux].
+//   - A handler or the UnknownHandler is nil.
+//   - An error is registered more than once, only if [WithStrictDuplicates] or
+//     [WithOnDuplicate] are in use, since duplicates are allowed otherwise.
+//   - A handler registered with [Mux.Handle], [Mux.HandleNamed] or [Mux.HandleP] can never be
+//     selected, because its error matches an error, or has an error of the type given to
+//     [HandleType] in its chain, whose handler takes precedence over it, unless
+//     [WithMostSpecific] is in use. The handlers using a custom [Matcher] are not checked.
+func (m *Mux) Validate() error {
+	s := m.state.Load()
+	if s == nil {
+		return errors.New("centra: Mux has not been initialized correctly, please call NewMux()")
+	}
+
+	var errs []error
+	if s.handlersStack[0].handler == nil {
+		errs = append(errs, errors.New("centra: UnknownHandler is nil"))
+	}
+
+	for i, h := range s.handlersStack[1:] {
+		if h.handler == nil {
+			errs = append(errs, fmt.Errorf("centra: handler for %q is nil", h.label()))
+		}
+
+		if h.exact || !h.plain() || h.method != "" {
+			continue
+		}
+		for _, later := range s.handlersStack[i+2:] {
+			if later.method != "" || later.fallback {
+				continue
+			}
+			cm, chain := later.matcher.(chainMatcher)
+			if !chain {
+				continue
+			}
+			if later.plain() && identical(h.err, later.err) {
+				if m.cfg.onDuplicate != nil {
+					errs = append(errs, fmt.Errorf("centra: duplicate handler registration for error: %v", h.err))
+				}
+			} else if !m.cfg.mostSpecific && cm.Match(h.err) {
+				errs = append(errs, fmt.Errorf("centra: handler for %q is shadowed by the handler for %q, which takes precedence", h.label(), later.label()))
+			} else {
+				continue
+			}
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns the registered UnknownHandler, if [Mux.UnknownHandler] has not been called yet,
+// by default it is [DefaultUnknown]
+func (m *Mux) GetUnknownHandler() ErrorHandlerFunc {
+	return m.load().handlersStack[0].handler
+}
+
+// Error search for registered error handlers to handle err, if no error handler is found, then
+// it calls the registered UnknownHandler
+//
+// The handler is selected in the following order, which is part of the API and is not going to
+// change, the first step that finds a handler wins:
+//
+//  1. The UnknownHandler, if err is matched by a classifier given to [Mux.ForceUnknown].
+//  2. With [WithSelfRendering], the first [Renderer] in the chain of err.
+//  3. The handlers registered with [Mux.HandleExact] for err itself.
+//  4. If the chain of err reaches an error joining others, like the ones returned by errors.Join,
+//     steps 5 and 6 for each of the joined errors, in order.
+//  5. The handlers registered with [Mux.HandleMethod] for the method of r matching err.
+//  6. The other handlers matching err, like the ones registered with [Mux.Handle],
+//     [Mux.HandleMatch] or [HandleType].
+//  7. The handlers registered with [Mux.HandleRegexp] matching the message of err.
+//  8. The handler registered with [Mux.HandleStatus] for the status err resolves to, then the
+//     ones registered with [Mux.HandleStatusRange], then the status mapper set with
+//     [WithStatusMapper].
+//  9. The parent Mux, see [Mux.WithParent], following these same steps.
+//  10. The UnknownHandler.
+//
+// Within a step, the handlers with higher priority, see [Mux.HandleP], are consulted first, and
+// within the same priority the last registered handler wins, unless [WithMostSpecific] is in use.
+//
+// A nil err is valid, and it's always handled by the UnknownHandler (of the last parent, see
+// [Mux.WithParent]) without matching it against any registered handler or the status mapper, the
+// handler receives the nil err as is. Prefer [ErrorUnknown] to make that intent explicit.
+//
+// An err whose chain is longer than [MaxChainLength], or cyclic, is replaced by an error
+// matching [ErrChainTooDeep] before any step, so that Error always terminates.
+//
+// Error may be called from an error handler, for example to delegate the rendering to the
+// handler of another error, but it panics if the calls are nested too deeply, since that's most
+// likely an error handler calling Error() with an error handled by itself.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	checkErrorArgs("Error", w, r)
+	getMux(r).ServeError(w, r, err)
+}
+
+// Same as [Error], but handles err with m instead of the Mux installed in the request, so it
+// doesn't need the [Mux.Handler] middleware, useful when the Mux is at hand, like in tests:
+//
+//	errMux.ServeError(recorder, httptest.NewRequest("GET", "/", nil), ErrNotFound)
+//
+// m is installed in the request passed to the handlers, unless it's already installed, so the
+// calls to Error made by them are handled by m too.
+func (m *Mux) ServeError(w http.ResponseWriter, r *http.Request, err error) {
+	checkErrorArgs("ServeError", w, r)
+	if m != nil && getMux(r) != m {
+		r = setMux(r, keyContext{}, m)
+	}
+	errorWithMux(m, w, r, err)
+}
+
+// Calls the UnknownHandler of the Mux installed in r with a nil error, it's the same as calling
+// Error(w, r, nil), but makes explicit that no error handler is being searched.
+func ErrorUnknown(w http.ResponseWriter, r *http.Request) {
+	checkErrorArgs("ErrorUnknown", w, r)
+	errorWithMux(getMux(r), w, r, nil)
+}
+
+// Same as [Error], but uses the Mux added to the request's context by [Mux.HandlerWithKey] with
+// key. Like [Error], it panics if there is no such Mux, which is also the case when the keys of
+// HandlerWithKey and ErrorWithKey don't match.
+func ErrorWithKey(key any, w http.ResponseWriter, r *http.Request, err error) {
+	checkErrorArgs("ErrorWithKey", w, r)
+	mux, _ := r.Context().Value(key).(*Mux)
+	errorWithMux(mux, w, r, err)
+}
+
+// Same as [Error], but for the code that only has the context of the request, not the request
+// itself, the Mux is looked up in ctx, which must be derived from the context of a request handled
+// by [Mux.Handler] or passed to [SetMux].
+//
+// The handlers receive a minimal request carrying ctx, with an empty URL, no headers and method
+// GET, so the handlers depending on the request only see its defaults: [NegotiatingHandler] and
+// the status mapper render HTML, [LocalizedHandler] uses [DefaultLocale] and
+// [ProblemDetailsHandler] writes an empty "instance". All the built-in handlers tolerate it.
+func ErrorCtx(ctx context.Context, w http.ResponseWriter, err error) {
+	if ctx == nil {
+		panic("centra: nil context.Context passed to ErrorCtx")
+	}
+	r := (&http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}).WithContext(ctx)
+	checkErrorArgs("ErrorCtx", w, r)
+	errorWithMux(getMux(r), w, r, err)
+}
+
+// checkErrorArgs panics with a clear message if w or r are nil, fn is the name of the calling
+// function.
+func checkErrorArgs(fn string, w http.ResponseWriter, r *http.Request) {
+	if r == nil {
+		panic("centra: nil *http.Request passed to " + fn)
+	}
+	if w == nil {
+		panic("centra: nil http.ResponseWriter passed to " + fn)
+	}
+}
+
+func errorWithMux(mux *Mux, w http.ResponseWriter, r *http.Request, err error) {
+	if mux == nil {
+		// This should be an invalid state for the library, most likely the middleware has been
+		// registered after the handler calling Error(), so the panic tells how to fix it, unless
+		// resilience has been preferred over strictness.
+		if !PanicOnMissingMux {
+			DefaultUnknownHandler(w, r, err)
+			return
+		}
+		panic("centra: no Mux installed in the request, the centra.Handler middleware must be registered before the handlers that call centra.Error, see IsInstalled")
+	}
+	if getDispatchInfo(r).depth >= maxDispatchDepth {
+		panic("centra: too many nested calls to Error(), an error handler is probably calling Error() with an error handled by itself")
+	}
+	mux.dispatch(w, r, err)
+}
+
+func (m *Mux) dispatch(w http.ResponseWriter, r *http.Request, err error) {
+	if rw := findWriter(w); rw != nil {
+		// the status deferred by DeferHeader is discarded, the one of the error is written instead
+		rw.deferHeader, rw.pending = false, 0
+		if rw.guard != nil && rw.status >= 200 && rw.status < 300 {
+			rw.guard.successViolated(r, rw.status, err)
+		}
+	}
+
+	if m.cfg.skipOnCancel && r.Context().Err() != nil {
+		if m.cfg.onCancel != nil {
+			m.cfg.onCancel(r, err)
+		}
+		return
+	}
+
+	err = boundChain(err)
+	owner, s, h := m.resolve(r.Method, err)
+	if (m.cfg.logger != nil || m.cfg.loggerFunc != nil) && err != nil {
+		m.logError(r, err, h)
+	}
+	if h.err == nil {
+		// only the UnknownHandler is registered without an error
+		if m.cfg.nearMissHints && err != nil {
+			m.logNearMisses(r, err)
+		}
+		if m.cfg.onUnknown != nil {
+			m.cfg.onUnknown(r, err)
+		}
+		h = owner.selectUnknown(r, h)
+	}
+	if h.audited && owner.cfg.auditSink != nil {
+		owner.cfg.auditSink(r, err)
+	}
+	owner.serve(s, h, w, r, err)
+}
+
+// selectUnknown returns the unknown handler h with its handler replaced by the one chosen by the
+// selector set with WithUnknownSelector, if any.
+func (m *Mux) selectUnknown(r *http.Request, h handlerStruct) handlerStruct {
+	if m.cfg.unknownSelector != nil {
+		if handler := m.cfg.unknownSelector(r); handler != nil {
+			h.handler = handler
+		}
+	}
+	return h
+}
+
+// resolve returns the handler that should handle err for a request with HTTP method method, along
+// with the Mux it was found in and its snapshot, following the chain of parents. An empty method
+// ignores the handlers registered with Mux.HandleMethod.
+func (m *Mux) resolve(method string, err error) (*Mux, *muxState, handlerStruct) {
+	return m.resolveTrace(method, err, nil)
+}
+
+// resolveTrace is resolve calling trace, if not nil, with every handler tested, along with the
+// Mux it's registered in.
+func (m *Mux) resolveTrace(method string, err error, trace func(m *Mux, h handlerStruct, target error, matched bool)) (*Mux, *muxState, handlerStruct) {
+	s := m.state.Load()
+	if s == nil {
+		panic("centra: Mux has not been initialized, cannot call Error() for this request")
+	}
+	if err == nil {
+		if s.parent != nil {
+			return s.parent.resolveTrace(method, err, trace)
+		}
+		// as a special case, if err is nil, call unknown handler
+		return m, s, s.handlersStack[0]
+	}
+
+	for _, force := range s.forceUnknown {
+		if force(err) {
+			// handled like a nil err, including by the UnknownHandler of the last parent
+			return m.resolveTrace(method, nil, trace)
+		}
+	}
+
+	var st traceFunc
+	if trace != nil {
+		st = func(h handlerStruct, target error, matched bool) {
+			trace(m, h, target, matched)
+		}
+	}
+
+	if m.cfg.selfRendering {
+		if h, ok := rendererHandler(err); ok {
+			if st != nil {
+				st(h, err, true)
+			}
+			return m, s, h
+		}
+	}
+
+	if h, ok := s.match(method, err, m.cfg.mostSpecific, st); ok {
+		return m, s, h
+	}
+
+	if h, ok := s.matchFallback(err, st); ok {
+		return m, s, h
+	}
+
+	if status, mapped := m.errorStatus(err); status != 0 {
+		if h, ok := s.matchStatus(status); ok {
+			if st != nil {
+				st(h, err, true)
+			}
+			return m, s, h
+		}
+		if mapped {
+			h := mappedHandler(status)
+			if st != nil {
+				st(h, err, true)
+			}
+			return m, s, h
+		}
+	}
+
+	if s.parent != nil {
+		// let the parent handle it, including calling its own unknown handler
+		return s.parent.resolveTrace(method, err, trace)
+	}
+
+	// if err is not registered, then call unknown error handler
+	return m, s, s.handlersStack[0]
+}
+
+// Returns the registered error whose handler would handle err if [Error] was called with it,
+// without calling any handler. That is the err argument passed to [Mux.Handle], or a placeholder
+// for the handlers registered with [HandleType] and the errors mapped by [WithStatusMapper].
+// Returns false if err would be handled by the UnknownHandler.
+//
+// It's useful to drive other transports, like gRPC, with the same registrations used for HTTP.
+func (m *Mux) Match(err error) (error, bool) {
+	_, _, h := m.resolve("", boundChain(err))
+	return h.err, h.err != nil
+}
+
+// Returns the errors of errs that would be handled by the UnknownHandler if [Error] was called with
+// them, in the same order, as reported by [Mux.Match], or nil if all of them have a handler. So
+// the completeness of the registrations can be checked in the tests, by feeding the exported
+// errors of a package:
+//
+//	if errs := errMux.Unhandled(users.ErrNotFound, users.ErrConflict); len(errs) != 0 {
+//		t.Fatalf("errors without handler: %v", errs)
+//	}
+//
+// A nil error is always reported, since it's always handled by the UnknownHandler.
+func (m *Mux) Unhandled(errs ...error) []error {
+	var unhandled []error
+	for _, err := range errs {
+		if _, ok := m.Match(err); !ok {
+			unhandled = append(unhandled, err)
+		}
+	}
+	return unhandled
+}
+
+// serve wraps h.handler with the middlewares registered in s and calls it, the request passed to
+// it carries the matched sentinel so it can be retrieved with [Matched].
+func (m *Mux) serve(s *muxState, h handlerStruct, w http.ResponseWriter, r *http.Request, err error) {
+	handler := h.handler
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handler = s.middlewares[i](handler)
+	}
+
+	f := &dispatchFrame{
+		Context: r.Context(),
+		info: dispatchInfo{
+			mux:     m,
+			err:     err,
+			matched: h.err,
+			label:   h.label(),
+			depth:   getDispatchInfo(r).depth + 1,
+
+			expected: h.expected,
+		},
+	}
+
+	for k, v := range m.cfg.defaultHeaders {
+		w.Header()[k] = slices.Clone(v)
+	}
+	if m.cfg.corsHeaders != nil {
+		for k, v := range m.cfg.corsHeaders(r) {
+			w.Header()[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	if m.cfg.debugHeader != "" {
+		w.Header().Set(m.cfg.debugHeader, f.info.label)
+	}
+	// copied into f, so the request doesn't need an allocation of its own
+	f.req = *r.WithContext(f)
+	r = &f.req
+
+	if findWriter(w) == nil {
+		f.rw.ResponseWriter = w
+		w = &f.rw
+	}
+	if m.cfg.implicitStatus != 0 || m.cfg.defaultContentType != "" || m.cfg.writeErrorHook != nil {
+		// the writer may be shared with an outer dispatch made by another Mux
+		rw := findWriter(w)
+		prev := rw.defaults
+		if m.cfg.implicitStatus != 0 {
+			rw.implicitStatus = m.cfg.implicitStatus
+		}
+		if m.cfg.defaultContentType != "" {
+			rw.defaultContentType = m.cfg.defaultContentType
+		}
+		if m.cfg.writeErrorHook != nil {
+			rw.writeErrorHook = m.cfg.writeErrorHook
+			rw.req = r
+		}
+		defer func() { rw.defaults = prev }()
+	}
+	if m.cfg.buffered {
+		handler = buffered(handler)
+	}
+	if m.cfg.renderTimeout != 0 {
+		handler = withTimeout(m.cfg.renderTimeout, handler)
+	}
+	m.call(handler, w, r, err)
+
+	for _, fn := range s.finalizers {
+		fn(w, r, err)
+	}
+}
+
+// call calls handler, recovering its panics if WithHandlerRecovery was given.
+func (m *Mux) call(handler ErrorHandlerFunc, w http.ResponseWriter, r *http.Request, err error) {
+	if m.cfg.onHandlerPanic != nil {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			m.cfg.onHandlerPanic(r, v)
+			if !Written(w) {
+				writePlainInternalServerError(w, r)
+			}
+		}()
+	}
+	handler(w, r, err)
+}
+
+// Maximum number of nested calls to Error(), made from error handlers that call Error() again.
+const maxDispatchDepth = 16
+
+type keyDispatch struct{}
+
+// dispatchInfo is stored in the context of the request passed to the handler selected by Error.
+type dispatchInfo struct {
+	// Mux that selected the handler
+	mux *Mux
+
+	// error being handled
+	err error
+
+	// registered error that matched, nil for the unknown handler
+	matched error
+
+	// label of the handler, see handlerStruct.label
+	label string
+
+	// number of nested calls to Error(), 1 for the outermost handler
+	depth int
+
+	// the handler has been registered with Mux.HandleExpected
+	expected bool
+}
+
+// dispatchFrame is the context of the request passed to the handler selected by Error, carrying
+// its dispatchInfo under keyDispatch{}, and the responseWriter wrapping the writer passed to it,
+// so both are allocated at once with the context, see Mux.serve.
+type dispatchFrame struct {
+	context.Context
+	info dispatchInfo
+	rw   responseWriter
+	req  http.Request
+}
+
+func (f *dispatchFrame) Value(key any) any {
+	if key == (keyDispatch{}) {
+		return &f.info
+	}
+	return f.Context.Value(key)
+}
+
+// getDispatchInfo returns the dispatchInfo of r, or a zero one if r is not being handled by
+// Error.
+func getDispatchInfo(r *http.Request) dispatchInfo {
+	if info, ok := r.Context().Value(keyDispatch{}).(*dispatchInfo); ok {
+		return *info
+	}
+	return dispatchInfo{}
+}
+
+// Returns the registered error that matched the error being handled, this is the err argument
+// that was passed to [Mux.Handle], or a placeholder error describing the match for the handlers
+// that don't register an error, like [HandleType]. Returns false if r is being handled by the
+// UnknownHandler, or if it's not being handled by [Error] at all.
+//
+// The returned error is one of the registered ones, so unlike the error being handled, it's
+// suitable to be used as a low cardinality label for metrics.
+func Matched(r *http.Request) (error, bool) {
+	matched := getDispatchInfo(r).matched
+	return matched, matched != nil
+}
+
+// Reports whether the error being handled in r has been registered with [Mux.HandleExpected],
+// being a client fault rather than a server one. Returns false if r is not being handled by
+// [Error].
+func Expected(r *http.Request) bool {
+	return getDispatchInfo(r).expected
+}
+
+// Returns the error being handled in r, this is the err argument passed to [Error], so it can be
+// retrieved by handlers that don't receive it as an argument, like the ones adapted with
+// [HandlerFromHTTP]. Returns false if r is not being handled by [Error], the returned error is
+// nil if [ErrorUnknown] was called.
+//
+// Every call to Error derives a new request for the handler, so the error is only visible to the
+// request given to the handler, it's never visible to the request passed to Error, nor to
+// a later call of Error with the same request.
+func CurrentError(r *http.Request) (error, bool) {
+	info := getDispatchInfo(r)
+	return info.err, info.mux != nil
+}
+
+type keyStatus struct{}
+
+// Returns the name that identifies the handler selected for r: the name given to
+// [Mux.HandleNamed], the message of the registered error for other registrations, see [Matched],
+// or [UnknownName] if r is being handled by the UnknownHandler or not being handled at all.
+func MatchedName(r *http.Request) string {
+	if label := getDispatchInfo(r).label; label != "" {
+		return label
+	}
+	return UnknownName
+}
+
+// Same as [Error], but hints status as the status code that should be written for err, the
+// handlers can retrieve it with [Status].
+//
+// Matching is done as usual, so the handler registered for err is called if there is one. The
+// built-in handlers, like [DefaultUnknownHandler], write the hinted status instead of their
+// default one, a registered handler may read it with [Status] or just ignore it and write its
+// own status code.
+//
+// Panics if status is not a valid status code.
+func ErrorStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	checkErrorArgs("ErrorStatus", w, r)
+	if status < 100 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), keyStatus{}, status))
+
+	Error(w, r, err)
+}
+
+// Returns the status code hinted with [ErrorStatus] for the error being handled, returns false
+// if r is not being handled by [ErrorStatus].
+func Status(r *http.Request) (int, bool) {
+	status, ok := r.Context().Value(keyStatus{}).(int)
+	return status, ok
+}
+
+// statusOr returns the status hinted with ErrorStatus, or fallback if there is none.
+func statusOr(r *http.Request, fallback int) int {
+	if status, ok := Status(r); ok {
+		return status
+	}
+	return fallback
+}
+
+// Status written by [DefaultUnknownHandler] and [DefaultUnknownJSONHandler] when no status has
+// been hinted with [ErrorStatus]. It's read without synchronization, so it must be set before
+// [NewMux] is called and any request is handled, for example in an init function.
+var DefaultUnknownStatus = http.StatusInternalServerError
+
+// Body written by [DefaultUnknownHandler] when no status has been hinted with [ErrorStatus]. If
+// it's empty, the heading with the text of [DefaultUnknownStatus] is written, localized with
+// [WithStatusText]. Same as [DefaultUnknownStatus], it must be set before [NewMux] is called and
+// any request is handled.
+var DefaultUnknownBody = ""
+
+// Default error handler for unknown errors
+//
+// Writes string "<h1>Internal Server Error</h1>" to w, sets Content-Type to
+// "text/html; charset=utf-8", see [WithCharset], and writes status code 500, see
+// [DefaultUnknownBody] and [DefaultUnknownStatus] to change them.
+//
+// If a status has been hinted with [ErrorStatus], that status and its text are written instead.
+// The message of err is written in a paragraph after the heading if [WithVerboseErrors] is
+// enabled.
+func DefaultUnknownHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if shed(w, r) {
+		return
+	}
+
+	status, hinted := Status(r)
+	if !hinted {
+		status = DefaultUnknownStatus
+	}
+
+	page := "<h1>" + statusText(r, status) + "</h1>"
+	if !hinted && DefaultUnknownBody != "" {
+		page = DefaultUnknownBody
+	}
+	if detail, ok := errorDetail(r, err); ok {
+		page += "<p>" + html.EscapeString(detail) + "</p>"
+	}
+
+	writeResponse(w, r, status, "text/html", []byte(page))
+}
+
+// JSON counterpart of [DefaultUnknownHandler], for JSON-only services, see [WithUnknownHandler].
+//
+// Writes string `{"error":"internal server error"}` to w, sets Content-Type to "application/json"
+// and writes status code 500, or [DefaultUnknownStatus]. The message of err is only written, as
+// "detail", if [WithVerboseErrors] is enabled, since it may leak internal details.
+//
+// If a status has been hinted with [ErrorStatus], that status and its text in lowercase are
+// written instead.
+func DefaultUnknownJSONHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if shed(w, r) {
+		return
+	}
+
+	status := statusOr(r, DefaultUnknownStatus)
+
+	body := map[string]string{"error": strings.ToLower(http.StatusText(status))}
+	if detail, ok := errorDetail(r, err); ok {
+		body["detail"] = detail
+	}
 
-	w.Write([]byte(response))
+	b, _ := json.Marshal(body)
+	writeResponse(w, r, status, "application/json", b)
 }
 
 func getMux(r *http.Request) *Mux {
@@ -15,11 +15,21 @@
 package centra
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type errString string
@@ -164,3 +174,2761 @@ func TestHandleAndError(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleMap(t *testing.T) {
+	body := func(s string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, s)
+		}
+	}
+
+	errMux := NewMux()
+	errMux.HandleMap(map[error]ErrorHandlerFunc{
+		nil:            body("unknown"),
+		errString("A"): body("a"),
+		errString("B"): body("b"),
+		errString("C"): body("c"),
+	})
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"A":              {Err: errString("A"), ExpectedBuf: "a"},
+		"B_Wrapped":      {Err: fmt.Errorf("wrapped: %w", errString("B")), ExpectedBuf: "b"},
+		"C":              {Err: errString("C"), ExpectedBuf: "c"},
+		"Unknown":        {Err: errString("D"), ExpectedBuf: "unknown"},
+		"Nil_Is_Unknown": {Err: nil, ExpectedBuf: "unknown"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+
+	expected := []error{errString("A"), errString("B"), errString("C")}
+	if handlers := errMux.Handlers(); !slices.Equal(expected, handlers) {
+		t.Fatalf("expected the handlers to be registered sorted, got %v", handlers)
+	}
+}
+
+func TestHandleLazy(t *testing.T) {
+	const dispatches = 50
+
+	var calls atomic.Int32
+	errMux := NewMux()
+	errMux.HandleLazy(errString("A"), func() ErrorHandlerFunc {
+		calls.Add(1)
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, "lazy")
+		}
+	})
+
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("expected the provider not to be called before the first match, called %d times", n)
+	}
+
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	for i := 0; i < dispatches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), fmt.Errorf("w: %w", errString("A")))
+			if recorder.Body.String() != "lazy" {
+				failures.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := failures.Load(); n != 0 {
+		t.Fatalf("expected every dispatch to be handled by the lazy handler, failed %d times", n)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the provider to be called once, called %d times", n)
+	}
+}
+
+func TestHandleLazyNilHandler(t *testing.T) {
+	errMux := NewMux()
+	errMux.HandleLazy(errString("A"), func() ErrorHandlerFunc { return nil })
+
+	defer func() {
+		expected := "centra: provider returned a nil handler for error: A"
+		if r := recover(); r != expected {
+			t.Fatalf("expected panic %q, got %v", expected, r)
+		}
+	}()
+	Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+}
+
+func TestHandleStatusMap(t *testing.T) {
+	var rendered int
+	errMux := NewMux()
+	errMux.HandleStatusMap(map[error]int{
+		errString("NOT_FOUND"): http.StatusNotFound,
+		errString("CONFLICT"):  http.StatusConflict,
+		errString("FORBIDDEN"): http.StatusForbidden,
+	}, func(w http.ResponseWriter, r *http.Request, err error) {
+		rendered++
+		DefaultUnknownHandler(w, r, err)
+	})
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Not_Found": {
+			Err:            errString("NOT_FOUND"),
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "<h1>Not Found</h1>",
+		},
+		"Conflict_Wrapped": {
+			Err:            fmt.Errorf("saving: %w", errString("CONFLICT")),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "<h1>Conflict</h1>",
+		},
+		"Forbidden": {
+			Err:            errString("FORBIDDEN"),
+			ExpectedStatus: http.StatusForbidden,
+			ExpectedBuf:    "<h1>Forbidden</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+
+	if rendered != len(testCases) {
+		t.Fatalf("expected the shared renderer to be called %d times, got %d", len(testCases), rendered)
+	}
+
+	expected := []error{errString("CONFLICT"), errString("FORBIDDEN"), errString("NOT_FOUND")}
+	if handlers := errMux.Handlers(); !slices.Equal(expected, handlers) {
+		t.Fatalf("expected the handlers to be registered sorted, got %v", handlers)
+	}
+}
+
+func TestForceUnknown(t *testing.T) {
+	body := func(s string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, s)
+		}
+	}
+
+	parent := NewMux()
+	parent.UnknownHandler(body("parent unknown"))
+
+	errMux := NewMux()
+	errMux.WithParent(parent)
+	errMux.UnknownHandler(body("unknown"))
+	errMux.Handle(errString("SQL"), body("sql"))
+	errMux.HandleExact(errString("SECRET"), body("secret"))
+	errMux.Handle(errString("OTHER"), body("other"))
+	errMux.ForceUnknown(func(err error) bool {
+		return errors.Is(err, errString("SQL"))
+	})
+	errMux.ForceUnknown(func(err error) bool {
+		return err == errString("SECRET")
+	})
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf     string
+		ExpectedMatched bool
+	}{
+		"Forced_Over_Handler": {
+			Err:         fmt.Errorf("query: %w", errString("SQL")),
+			ExpectedBuf: "parent unknown",
+		},
+		"Forced_Over_Exact": {
+			Err:         errString("SECRET"),
+			ExpectedBuf: "parent unknown",
+		},
+		"Not_Forced": {
+			Err:             errString("OTHER"),
+			ExpectedBuf:     "other",
+			ExpectedMatched: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if _, matched := errMux.Match(tc.Err); tc.ExpectedMatched != matched {
+				t.Fatalf("expected Match to report %t, got %t", tc.ExpectedMatched, matched)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	body := func(s string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, s)
+		}
+	}
+
+	testCases := map[string]struct {
+		AdoptUnknown bool
+		Err          error
+
+		ExpectedBuf string
+	}{
+		"Own": {
+			Err:         errString("APP"),
+			ExpectedBuf: "app",
+		},
+		"Merged": {
+			Err:         fmt.Errorf("wrapped: %w", errString("USERS")),
+			ExpectedBuf: "users",
+		},
+		"Merged_Wins_On_Duplicate": {
+			Err:         errString("SHARED"),
+			ExpectedBuf: "users shared",
+		},
+		"Unknown_Kept": {
+			Err:         errString("OTHER"),
+			ExpectedBuf: "app unknown",
+		},
+		"Unknown_Adopted": {
+			AdoptUnknown: true,
+			Err:          errString("OTHER"),
+			ExpectedBuf:  "users unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			users := NewMux()
+			users.Handle(errString("USERS"), body("users"))
+			users.Handle(errString("SHARED"), body("users shared"))
+			users.UnknownHandler(body("users unknown"))
+
+			app := NewMux()
+			app.Handle(errString("APP"), body("app"))
+			app.Handle(errString("SHARED"), body("app shared"))
+			app.UnknownHandler(body("app unknown"))
+
+			app.Merge(users, tc.AdoptUnknown)
+
+			// later changes to the merged Mux don't affect app
+			users.Handle(errString("APP"), body("users app"))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), app), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMergeConcurrent(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	a, b := NewMux(), NewMux()
+	a.Handle(errString("A"), noopHandler)
+	b.Handle(errString("B"), noopHandler)
+
+	// the stacks double at every round, so a few are enough
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.Merge(b, false)
+		}()
+		go func() {
+			defer wg.Done()
+			b.Merge(a, false)
+		}()
+	}
+	wg.Wait()
+
+	for _, m := range []*Mux{a, b} {
+		for _, err := range []error{errString("A"), errString("B")} {
+			if _, ok := m.Match(err); !ok {
+				t.Fatalf("expected %v to be matched", err)
+			}
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	errCanceled := errString("CANCELED")
+
+	testCases := map[string]struct {
+		Register func(m *Mux)
+		Err      error
+
+		ExpectedStatus int
+	}{
+		"Ignore": {
+			Register:       func(m *Mux) { m.Ignore(errCanceled, http.StatusNoContent) },
+			Err:            fmt.Errorf("wrapped: %w", errCanceled),
+			ExpectedStatus: http.StatusNoContent,
+		},
+		"Ignore_Error_Status": {
+			Register:       func(m *Mux) { m.Ignore(errCanceled, http.StatusServiceUnavailable) },
+			Err:            errCanceled,
+			ExpectedStatus: http.StatusServiceUnavailable,
+		},
+		"NoopHandler": {
+			Register:       func(m *Mux) { m.Handle(errCanceled, NoopHandler) },
+			Err:            errCanceled,
+			ExpectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			tc.Register(errMux)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if recorder.Body.Len() != 0 {
+				t.Fatalf("expected empty body, got %s", recorder.Body.String())
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "" {
+				t.Fatalf("expected no Content-Type, got %s", ct)
+			}
+		})
+	}
+}
+
+func TestUnknownHandlers(t *testing.T) {
+	jsonOnly := func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Header.Get("Accept") != "application/json" {
+			// declines
+			return
+		}
+		io.WriteString(w, "json")
+	}
+	htmlOnly := func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Header.Get("Accept") != "text/html" {
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	text := func(w http.ResponseWriter, r *http.Request, err error) {
+		io.WriteString(w, "text")
+	}
+
+	testCases := map[string]struct {
+		Accept string
+
+		ExpectedBuf   string
+		ExpectedCalls string
+	}{
+		"First_Writes": {
+			Accept:        "application/json",
+			ExpectedBuf:   "json",
+			ExpectedCalls: "json ",
+		},
+		"Status_Only_Counts_As_Written": {
+			Accept:        "text/html",
+			ExpectedBuf:   "",
+			ExpectedCalls: "json html ",
+		},
+		"All_Decline_But_Last": {
+			Accept:        "image/png",
+			ExpectedBuf:   "text",
+			ExpectedCalls: "json html text ",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls string
+			record := func(name string, h ErrorHandlerFunc) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					calls += name + " "
+					h(w, r, err)
+				}
+			}
+
+			errMux := NewMux()
+			errMux.UnknownHandlers(record("json", jsonOnly), record("html", htmlOnly), record("text", text))
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, errString("A"))
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected calls %s, got %s", tc.ExpectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	errA := errString("A_UNWRAP")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedCalls string
+	}{
+		"Matched": {
+			Err:           errStringWrapped("A"),
+			ExpectedCalls: "1(A_UNWRAP) 2(A_UNWRAP) handler ",
+		},
+		"Unknown": {
+			Err:           errString("B"),
+			ExpectedCalls: "1(unknown) 2(unknown) unknown ",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls string
+
+			mwFactory := func(name string) func(ErrorHandlerFunc) ErrorHandlerFunc {
+				return func(next ErrorHandlerFunc) ErrorHandlerFunc {
+					return func(w http.ResponseWriter, r *http.Request, err error) {
+						label := "unknown"
+						if matched, ok := Matched(r); ok {
+							label = matched.Error()
+						}
+						calls += name + "(" + label + ") "
+						next(w, r, err)
+					}
+				}
+			}
+
+			errMux := NewMux()
+			errMux.Use(mwFactory("1"), mwFactory("2"))
+			errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+				calls += "handler "
+			})
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				calls += "unknown "
+			})
+
+			req := httptest.NewRequest("", "/", nil)
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, tc.Err)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected %s, got %s", tc.ExpectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedCalls string
+		ExpectedBuf   string
+	}{
+		"Matched": {
+			Err:           errStringWrapped("A"),
+			ExpectedCalls: "mw handler final1(true) final2(true) ",
+			ExpectedBuf:   "handler",
+		},
+		"Unknown": {
+			Err:           errString("B"),
+			ExpectedCalls: "mw unknown final1(false) final2(true) ",
+			ExpectedBuf:   "final",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls string
+
+			finalizer := func(name string) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					calls += name + "(" + strconv.FormatBool(Written(w)) + ") "
+					if !Written(w) {
+						io.WriteString(w, "final")
+					}
+				}
+			}
+
+			errMux := NewMux()
+			errMux.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					calls += "mw "
+					next(w, r, err)
+				}
+			})
+			errMux.Finalize(finalizer("final1"))
+			errMux.Finalize(finalizer("final2"))
+			errMux.Handle(errString("A_UNWRAP"), func(w http.ResponseWriter, r *http.Request, err error) {
+				calls += "handler "
+				io.WriteString(w, "handler")
+			})
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				calls += "unknown "
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected %s, got %s", tc.ExpectedCalls, calls)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+
+		ExpectedBuf string
+	}{
+		"Default_Unknown": {
+			ExpectedBuf: "<h1>Internal Server Error</h1>",
+		},
+		"Unknown_Option_Kept": {
+			Opts:        []Option{WithUnknownHandler(DefaultUnknownJSONHandler)},
+			ExpectedBuf: `{"error":"internal server error"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "registered")
+			}
+
+			parent := NewMux()
+			parent.Handle(errString("P"), noopHandler)
+
+			errMux := NewMux(tc.Opts...)
+			errMux.WithParent(parent)
+			errMux.Handle(errString("A"), noopHandler)
+			errMux.UnknownHandler(noopHandler)
+			errMux.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc { return noopHandler })
+			errMux.Finalize(noopHandler)
+
+			// references taken before Reset stay valid
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+
+			errMux.Reset()
+
+			if handlers := errMux.Handlers(); len(handlers) != 0 {
+				t.Fatalf("expected no handlers, got %v", handlers)
+			}
+			for _, err := range []error{errString("A"), errString("P")} {
+				recorder := httptest.NewRecorder()
+				Error(recorder, req, err)
+				if tc.ExpectedBuf != recorder.Body.String() {
+					t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLen(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	parent := NewMux()
+	parent.Handle(errString("P"), noopHandler)
+
+	errMux := NewMux()
+	errMux.WithParent(parent)
+	if n := errMux.Len(); n != 0 {
+		t.Fatalf("expected 0 handlers, got %d", n)
+	}
+
+	errMux.Handle(errString("A"), noopHandler)
+	errMux.HandleExact(errString("B"), noopHandler)
+	errMux.HandleStatus(http.StatusNotFound, noopHandler)
+	errMux.UnknownHandler(noopHandler)
+
+	if n := errMux.Len(); n != 3 {
+		t.Fatalf("expected 3 handlers, got %d", n)
+	}
+	if n := len(errMux.Handlers()); n != errMux.Len() {
+		t.Fatalf("expected Len to equal len(Handlers()) %d, got %d", n, errMux.Len())
+	}
+
+	errMux.Reset()
+	if n := errMux.Len(); n != 0 {
+		t.Fatalf("expected 0 handlers after Reset, got %d", n)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Mutate func(m *Mux)
+	}{
+		"Handle": {
+			Mutate: func(m *Mux) { m.Handle(errString("B"), noopHandler) },
+		},
+		"UnknownHandler": {
+			Mutate: func(m *Mux) { m.UnknownHandler(noopHandler) },
+		},
+		"Use": {
+			Mutate: func(m *Mux) {
+				m.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc { return next })
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "1")
+			})
+			errMux.Seal()
+
+			func() {
+				defer func() {
+					if r := recover(); r == nil {
+						t.Fatalf("expected to panic, did not panic")
+					}
+				}()
+				tc.Mutate(errMux)
+			}()
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, errString("A"))
+			})).ServeHTTP(recorder, req)
+
+			if recorder.Body.String() != "1" {
+				t.Fatalf("expected 1, got %s", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithParent(t *testing.T) {
+	errA := errString("A")
+	errB := errString("B")
+
+	fnErrorFactory := func(message string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, message)
+		}
+	}
+
+	parent := NewMux()
+	parent.Handle(errB, fnErrorFactory("parent B"))
+	parent.UnknownHandler(fnErrorFactory("parent unknown"))
+
+	child := NewMux()
+	child.Handle(errA, fnErrorFactory("child A"))
+	child.UnknownHandler(fnErrorFactory("child unknown"))
+	child.WithParent(parent)
+
+	testCases := map[string]struct {
+		Path string
+		Err  error
+
+		ExpectedBuf string
+	}{
+		"Child_Handles_A": {
+			Path:        "/api/x",
+			Err:         errA,
+			ExpectedBuf: "child A",
+		},
+		"Child_Falls_Through_B": {
+			Path:        "/api/x",
+			Err:         errB,
+			ExpectedBuf: "parent B",
+		},
+		"Child_Unknown": {
+			Path:        "/api/x",
+			Err:         errString("C"),
+			ExpectedBuf: "parent unknown",
+		},
+		"Child_Nil": {
+			Path:        "/api/x",
+			Err:         nil,
+			ExpectedBuf: "parent unknown",
+		},
+		"Parent_Does_Not_Handle_A": {
+			Path:        "/x",
+			Err:         errA,
+			ExpectedBuf: "parent unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, tc.Err)
+			})
+
+			router := http.NewServeMux()
+			router.Handle("/api/", child.Handler(final))
+			router.Handle("/", final)
+
+			req := httptest.NewRequest("", tc.Path, nil)
+			recorder := httptest.NewRecorder()
+
+			parent.Handler(router).ServeHTTP(recorder, req)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithParent_Cycle(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected to panic, did not panic")
+		}
+	}()
+
+	a, b := NewMux(), NewMux()
+	a.WithParent(b)
+	b.WithParent(a)
+}
+
+func TestErrorStatus(t *testing.T) {
+	errA := errString("A")
+
+	testCases := map[string]struct {
+		Status int
+		Err    error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+		ExpectedPanic  bool
+	}{
+		"Default_Uses_Hint": {
+			Status: http.StatusBadRequest,
+			Err:    errString("Unknown"),
+
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBuf:    "<h1>Bad Request</h1>",
+		},
+		"Registered_Reads_Hint": {
+			Status: http.StatusConflict,
+			Err:    errA,
+
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "A",
+		},
+		"Invalid_Status": {
+			Status: 42,
+			Err:    errA,
+
+			ExpectedPanic: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tc.ExpectedPanic && r == nil {
+					t.Fatalf("expected to panic, did not panic")
+				} else if !tc.ExpectedPanic && r != nil {
+					t.Fatalf("expected to not panic, did panic: %v", r)
+				}
+			}()
+
+			errMux := NewMux()
+			errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+				status, ok := Status(r)
+				if !ok {
+					t.Fatalf("expected status to be hinted")
+				}
+				w.WriteHeader(status)
+				io.WriteString(w, err.Error())
+			})
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ErrorStatus(w, r, tc.Status, tc.Err)
+			})).ServeHTTP(recorder, req)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleDuringSlowHandler(t *testing.T) {
+	errMux := NewMux()
+
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	errMux.Handle(errString("Slow"), func(w http.ResponseWriter, r *http.Request, err error) {
+		close(inHandler)
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest("", "/", nil)
+		errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, errString("Slow"))
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	<-inHandler
+
+	registered := make(chan struct{})
+	go func() {
+		defer close(registered)
+		errMux.Handle(errString("Other"), func(w http.ResponseWriter, r *http.Request, err error) {})
+		errMux.UnknownHandler(DefaultUnknownHandler)
+	}()
+
+	select {
+	case <-registered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("registration blocked by in-flight handler")
+	}
+}
+
+func BenchmarkErrorConcurrentHandle(b *testing.B) {
+	errMux := NewMux()
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				errMux.UnknownHandler(DefaultUnknownHandler)
+			}
+		}
+	}()
+
+	req := httptest.NewRequest("", "/", nil)
+	final := errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errString("A"))
+	}))
+	recorder := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		final.ServeHTTP(recorder, req)
+	}
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
+
+// Meant to be run with -race, registers handlers while errors are being handled.
+func TestConcurrentHandleAndError(t *testing.T) {
+	const (
+		writers = 4
+		readers = 8
+		rounds  = 200
+	)
+
+	errMux := NewMux()
+	errMux.Handle(errString("base"), func(w http.ResponseWriter, r *http.Request, err error) {
+		io.WriteString(w, "base")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				body := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				errMux.Handle(errString(body), func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, body)
+				})
+				errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, "unknown")
+				})
+				errMux.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc { return next })
+			}
+		}(i)
+	}
+
+	var failures atomic.Int32
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+
+				recorder := httptest.NewRecorder()
+				Error(recorder, req, errString("base"))
+				if recorder.Body.String() != "base" {
+					failures.Add(1)
+				}
+
+				Error(httptest.NewRecorder(), req, errString("0-"+strconv.Itoa(j)))
+				errMux.Handlers()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := failures.Load(); n != 0 {
+		t.Fatalf("expected base handler to always be selected, failed %d times", n)
+	}
+
+	// every registration took effect once Handle returned
+	for i := 0; i < writers; i++ {
+		body := strconv.Itoa(i) + "-" + strconv.Itoa(rounds-1)
+		recorder := httptest.NewRecorder()
+		Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString(body))
+		if recorder.Body.String() != body {
+			t.Fatalf("expected %s, got %s", body, recorder.Body.String())
+		}
+	}
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("NOT_FOUND"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "no user "+r.PathValue("id"))
+	})
+
+	getUser := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errString("NOT_FOUND"))
+	})
+
+	wrapped := http.NewServeMux()
+	wrapped.Handle("GET /users/{id}", errMux.Wrap(getUser))
+
+	inner := http.NewServeMux()
+	inner.Handle("GET /users/{id}", getUser)
+
+	testCases := map[string]struct {
+		Handler http.Handler
+		Method  string
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Wrap": {
+			Handler:        wrapped,
+			Method:         http.MethodGet,
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "no user 42",
+		},
+		"Wrap_Method_Not_Allowed": {
+			Handler:        wrapped,
+			Method:         http.MethodPost,
+			ExpectedStatus: http.StatusMethodNotAllowed,
+			ExpectedBuf:    "Method Not Allowed\n",
+		},
+		"Middleware": {
+			Handler:        errMux.Middleware()(inner),
+			Method:         http.MethodGet,
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "no user 42",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			tc.Handler.ServeHTTP(recorder, httptest.NewRequest(tc.Method, "/users/42", nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("NOT_FOUND"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "not found")
+	})
+
+	var adaptedReq *http.Request
+	adapted := errMux.Adapt(func(w http.ResponseWriter, r *http.Request) error {
+		adaptedReq = r
+		if r.URL.Path == "/ok" {
+			io.WriteString(w, "ok")
+			return nil
+		}
+		return errString("NOT_FOUND")
+	})
+
+	testCases := map[string]struct {
+		Middleware bool
+		Path       string
+
+		ExpectedStatus      int
+		ExpectedBuf         string
+		ExpectedReinstalled bool
+	}{
+		"Error": {
+			Path:                "/users/42",
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedBuf:         "not found",
+			ExpectedReinstalled: true,
+		},
+		"No_Error": {
+			Path:                "/ok",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedBuf:         "ok",
+			ExpectedReinstalled: true,
+		},
+		"Already_Installed": {
+			Middleware:          true,
+			Path:                "/users/42",
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedBuf:         "not found",
+			ExpectedReinstalled: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var outerReq *http.Request
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				outerReq = r
+				adapted.ServeHTTP(w, r)
+			})
+			if tc.Middleware {
+				handler = errMux.Handler(handler)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("", tc.Path, nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if reinstalled := adaptedReq != outerReq; tc.ExpectedReinstalled != reinstalled {
+				t.Fatalf("expected reinstalled %v, got %v", tc.ExpectedReinstalled, reinstalled)
+			}
+			if getMux(adaptedReq) != errMux {
+				t.Fatal("expected the Mux to be installed in the request")
+			}
+		})
+	}
+}
+
+func TestSharedTwoServers(t *testing.T) {
+	const requests = 50
+
+	errMux := NewMux(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithSampledLogging(10))
+	if errMux.Shared() != errMux {
+		t.Fatal("expected Shared to return the Mux itself")
+	}
+	errMux.Handle(errString("NOT_FOUND"), NegotiatingHandler(http.StatusNotFound))
+
+	failing := func(err error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, err)
+		})
+	}
+	public := httptest.NewServer(errMux.Shared().Handler(failing(errString("NOT_FOUND"))))
+	defer public.Close()
+	admin := httptest.NewServer(errMux.Shared().Handler(failing(errString("FORBIDDEN"))))
+	defer admin.Close()
+
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	get := func(url string, expected int) {
+		defer wg.Done()
+		resp, err := http.Get(url)
+		if err != nil {
+			failures.Add(1)
+			return
+		}
+		resp.Body.Close()
+		// FORBIDDEN may be registered while the requests are in flight
+		if resp.StatusCode != expected && resp.StatusCode != http.StatusInternalServerError {
+			failures.Add(1)
+		}
+	}
+	for i := 0; i < requests; i++ {
+		wg.Add(2)
+		go get(public.URL, http.StatusNotFound)
+		go get(admin.URL, http.StatusForbidden)
+		if i == requests/2 {
+			errMux.Handle(errString("FORBIDDEN"), NegotiatingHandler(http.StatusForbidden))
+		}
+	}
+	wg.Wait()
+
+	if n := failures.Load(); n != 0 {
+		t.Fatalf("expected every request to be handled, failed %d times", n)
+	}
+
+	resp, err := http.Get(admin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the registration to take effect on both servers, got status %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerTouchesMux(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		// none of these may deadlock while a handler is running
+		errMux.GetUnknownHandler()
+		errMux.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {})
+		errMux.UnknownHandler(DefaultUnknownHandler)
+		io.WriteString(w, "1")
+	})
+
+	done := make(chan string)
+	go func() {
+		req := httptest.NewRequest("", "/", nil)
+		recorder := httptest.NewRecorder()
+		errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, errString("A"))
+		})).ServeHTTP(recorder, req)
+		done <- recorder.Body.String()
+	}()
+
+	select {
+	case buf := <-done:
+		if buf != "1" {
+			t.Fatalf("expected 1, got %s", buf)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("handler touching the Mux deadlocked")
+	}
+}
+
+func TestNestedError(t *testing.T) {
+	errA := errString("A")
+	errB := errString("B")
+
+	errMux := NewMux()
+	errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+		// delegates to the handler of another error
+		Error(w, r, errB)
+	})
+	errMux.Handle(errB, func(w http.ResponseWriter, r *http.Request, err error) {
+		matched, _ := Matched(r)
+		io.WriteString(w, "B handled, matched "+matched.Error())
+	})
+	errMux.Handle(errString("Loop"), func(w http.ResponseWriter, r *http.Request, err error) {
+		Error(w, r, err)
+	})
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf   string
+		ExpectedPanic bool
+	}{
+		"Delegate": {
+			Err:         errA,
+			ExpectedBuf: "B handled, matched B",
+		},
+		"Infinite_Recursion": {
+			Err:           errString("Loop"),
+			ExpectedPanic: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tc.ExpectedPanic && r == nil {
+					t.Fatalf("expected to panic, did not panic")
+				} else if !tc.ExpectedPanic && r != nil {
+					t.Fatalf("expected to not panic, did panic: %v", r)
+				}
+			}()
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, tc.Err)
+			})).ServeHTTP(recorder, req)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleExact(t *testing.T) {
+	errA := errString("A_UNWRAP")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"Exact": {
+			Err:         errA,
+			ExpectedBuf: "exact",
+		},
+		"Wrapped_Does_Not_Match_Exact": {
+			Err:         errStringWrapped("A"),
+			ExpectedBuf: "is",
+		},
+		"Unknown": {
+			Err:         errString("B"),
+			ExpectedBuf: "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "unknown")
+			})
+			errMux.HandleExact(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "exact")
+			})
+			// registered later, but exact handlers are checked first
+			errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "is")
+			})
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, tc.Err)
+			})).ServeHTTP(recorder, req)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleMethod(t *testing.T) {
+	errNotFound := errString("NOT_FOUND")
+
+	body := func(s string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, s)
+		}
+	}
+
+	testCases := map[string]struct {
+		Method string
+		Err    error
+
+		ExpectedBuf string
+	}{
+		"GET": {
+			Method:      http.MethodGet,
+			Err:         errNotFound,
+			ExpectedBuf: "get",
+		},
+		"POST": {
+			Method:      http.MethodPost,
+			Err:         fmt.Errorf("creating user: %w", errNotFound),
+			ExpectedBuf: "post",
+		},
+		"Case_Insensitive": {
+			Method:      "delete",
+			Err:         errNotFound,
+			ExpectedBuf: "delete",
+		},
+		"Fallback": {
+			Method:      http.MethodPut,
+			Err:         errNotFound,
+			ExpectedBuf: "any",
+		},
+		"Other_Error": {
+			Method:      http.MethodPost,
+			Err:         errString("OTHER"),
+			ExpectedBuf: "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithStrictDuplicates())
+			errMux.HandleMethod("get", errNotFound, body("get"))
+			errMux.HandleMethod(http.MethodPost, errNotFound, body("post"))
+			errMux.HandleMethod(http.MethodDelete, errNotFound, body("delete"))
+			// registered last, but the handlers of the method win
+			errMux.Handle(errNotFound, body("any"))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest(tc.Method, "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("Match_Ignores_Method", func(t *testing.T) {
+		errMux := NewMux()
+		errMux.HandleMethod(http.MethodGet, errNotFound, body("get"))
+
+		if matched, ok := errMux.Match(errNotFound); ok {
+			t.Fatalf("expected no match, got %v", matched)
+		}
+	})
+}
+
+func TestHandlerWithKey(t *testing.T) {
+	type authKey struct{}
+
+	errAuth := errString("Auth")
+	errBusiness := errString("Business")
+
+	authMux := NewMux()
+	authMux.Handle(errAuth, func(w http.ResponseWriter, r *http.Request, err error) {
+		io.WriteString(w, "auth")
+	})
+
+	businessMux := NewMux()
+	businessMux.Handle(errBusiness, func(w http.ResponseWriter, r *http.Request, err error) {
+		io.WriteString(w, "business")
+	})
+
+	testCases := map[string]struct {
+		Final http.HandlerFunc
+
+		ExpectedBuf   string
+		ExpectedPanic bool
+	}{
+		"Key": {
+			Final: func(w http.ResponseWriter, r *http.Request) {
+				ErrorWithKey(authKey{}, w, r, errAuth)
+			},
+			ExpectedBuf: "auth",
+		},
+		"Default_Key": {
+			Final: func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, errBusiness)
+			},
+			ExpectedBuf: "business",
+		},
+		"Both": {
+			Final: func(w http.ResponseWriter, r *http.Request) {
+				ErrorWithKey(authKey{}, w, r, errAuth)
+				Error(w, r, errBusiness)
+			},
+			ExpectedBuf: "authbusiness",
+		},
+		"Mismatched_Key": {
+			Final: func(w http.ResponseWriter, r *http.Request) {
+				ErrorWithKey("other", w, r, errAuth)
+			},
+			ExpectedPanic: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tc.ExpectedPanic && r == nil {
+					t.Fatalf("expected to panic, did not panic")
+				} else if !tc.ExpectedPanic && r != nil {
+					t.Fatalf("expected to not panic, did panic: %v", r)
+				}
+			}()
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			authMux.HandlerWithKey(authKey{}, businessMux.Handler(tc.Final)).ServeHTTP(recorder, req)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMuxErrorHandler(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("A_UNWRAP"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, err.Error())
+	})
+
+	recorder := httptest.NewRecorder()
+	// no Mux installed in the request
+	errMux.ErrorHandler(errStringWrapped("A")).ServeHTTP(recorder, httptest.NewRequest("", "/preview", nil))
+
+	if recorder.Code != http.StatusTeapot {
+		t.Fatalf("expected status %d, got %d", http.StatusTeapot, recorder.Code)
+	}
+	if expected := "A"; recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+func TestMuxServeError(t *testing.T) {
+	errA := errString("A")
+	errB := errString("B")
+
+	errMux := NewMux()
+	errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+		if getMux(r) != errMux {
+			t.Errorf("expected the Mux to be installed in the request")
+		}
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, "A")
+	})
+	// delegates to the handler of errA, which requires errMux to be installed
+	errMux.Handle(errB, func(w http.ResponseWriter, r *http.Request, err error) {
+		Error(w, r, errA)
+	})
+
+	testCases := map[string]struct {
+		Request *http.Request
+		Err     error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Not_Installed": {
+			Request:        httptest.NewRequest("", "/", nil),
+			Err:            errA,
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "A",
+		},
+		"Not_Installed_Nested_Error": {
+			Request:        httptest.NewRequest("", "/", nil),
+			Err:            errB,
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "A",
+		},
+		"Other_Mux_Installed": {
+			Request:        SetMux(httptest.NewRequest("", "/", nil), NewMux()),
+			Err:            fmt.Errorf("wrapped: %w", errA),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "A",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			errMux.ServeError(recorder, tc.Request, tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestGuardSuccess(t *testing.T) {
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler http.HandlerFunc
+
+		ExpectedPanic  bool
+		ExpectedLogged bool
+		ExpectedStatus int
+	}{
+		"Error_First": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, errString("A"))
+			},
+			ExpectedStatus: http.StatusNotFound,
+		},
+		"Success_Then_Error": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+				Error(w, r, errString("A"))
+			},
+			ExpectedPanic:  true,
+			ExpectedStatus: http.StatusOK,
+		},
+		"Success_Then_Error_Logged": {
+			Opts: []Option{WithGuardLogging()},
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				Error(w, r, errString("A"))
+			},
+			ExpectedLogged: true,
+			ExpectedStatus: http.StatusCreated,
+		},
+		"Redirect_Then_Error": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusFound)
+				Error(w, r, errString("A"))
+			},
+			ExpectedStatus: http.StatusFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+			errMux := NewMux(append(tc.Opts, WithLogger(logger))...)
+			errMux.Handle(errString("A"), NegotiatingHandler(http.StatusNotFound))
+
+			recorder := httptest.NewRecorder()
+			func() {
+				defer func() {
+					if r := recover(); tc.ExpectedPanic != (r != nil) {
+						t.Fatalf("expected panic %t, got %v", tc.ExpectedPanic, r)
+					}
+				}()
+				errMux.Handler(errMux.GuardSuccess(tc.Handler)).ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
+			}()
+
+			logged := strings.Contains(buf.String(), "centra: Error called after a successful response was written")
+			if tc.ExpectedLogged != logged {
+				t.Fatalf("expected logged %t, got %s", tc.ExpectedLogged, buf.String())
+			}
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestMuxAsHandlerFunc(t *testing.T) {
+	errOuter := errString("OUTER")
+	errInner := errString("INNER")
+
+	inner := NewMux()
+	inner.Handle(errInner, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, "inner")
+	})
+	inner.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		if getMux(r) != inner {
+			t.Errorf("expected the inner Mux to be installed in the request")
+		}
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintf(w, "inner unknown: %v", err)
+	})
+
+	outer := NewMux()
+	outer.Handle(errOuter, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "outer")
+	})
+	outer.UnknownHandler(inner.AsHandlerFunc())
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Outer": {
+			Err:            errOuter,
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBuf:    "outer",
+		},
+		"Inner": {
+			Err:            fmt.Errorf("wrapped: %w", errInner),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "inner",
+		},
+		"Inner_Unknown": {
+			Err:            errString("OTHER"),
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "inner unknown: OTHER",
+		},
+		"Nil_Error": {
+			Err:            nil,
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "inner unknown: <nil>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), outer), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMuxHandlerFunc(t *testing.T) {
+	testCases := map[string]struct {
+		Err       error
+		Installed bool
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"No_Error": {
+			Err:            nil,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBuf:    "ok",
+		},
+		"Error_Mux_Installed": {
+			Err:            errString("A"),
+			Installed:      true,
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "installed",
+		},
+		"Error_Mux_Not_Installed": {
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "receiver",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			factory := func(status int, body string) *Mux {
+				m := NewMux()
+				m.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+					w.WriteHeader(status)
+					io.WriteString(w, body)
+				})
+				return m
+			}
+			receiver := factory(http.StatusNotFound, "receiver")
+			installed := factory(http.StatusTeapot, "installed")
+
+			var handler http.Handler = receiver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				if tc.Err == nil {
+					io.WriteString(w, "ok")
+				}
+				return tc.Err
+			})
+			if tc.Installed {
+				handler = installed.Handler(handler)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestNegroni(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	// the signature expected by negroni.HandlerFunc
+	var middleware func(http.ResponseWriter, *http.Request, http.HandlerFunc) = errMux.Negroni
+
+	recorder := httptest.NewRecorder()
+	middleware(recorder, httptest.NewRequest("", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errString("A"))
+	})
+
+	if recorder.Code != http.StatusTeapot {
+		t.Fatalf("expected status %d, got %d", http.StatusTeapot, recorder.Code)
+	}
+}
+
+func TestSetMux(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		io.WriteString(w, "1")
+	})
+
+	recorder := httptest.NewRecorder()
+	req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+
+	Error(recorder, req, errString("A"))
+
+	if recorder.Body.String() != "1" {
+		t.Fatalf("expected 1, got %s", recorder.Body.String())
+	}
+}
+
+func TestIsInstalled(t *testing.T) {
+	errMux := NewMux()
+
+	testCases := map[string]struct {
+		Request func() *http.Request
+
+		ExpectedInstalled bool
+	}{
+		"Not_Installed": {
+			Request:           func() *http.Request { return httptest.NewRequest("", "/", nil) },
+			ExpectedInstalled: false,
+		},
+		"SetMux": {
+			Request:           func() *http.Request { return SetMux(httptest.NewRequest("", "/", nil), errMux) },
+			ExpectedInstalled: true,
+		},
+		"Handler": {
+			Request: func() *http.Request {
+				var installed *http.Request
+				errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					installed = r
+				})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("", "/", nil))
+				return installed
+			},
+			ExpectedInstalled: true,
+		},
+		"HandlerWithKey": {
+			Request: func() *http.Request {
+				var installed *http.Request
+				type customKey struct{}
+				errMux.HandlerWithKey(customKey{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					installed = r
+				})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("", "/", nil))
+				return installed
+			},
+			ExpectedInstalled: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if installed := IsInstalled(tc.Request()); tc.ExpectedInstalled != installed {
+				t.Fatalf("expected IsInstalled %t, got %t", tc.ExpectedInstalled, installed)
+			}
+		})
+	}
+}
+
+func TestErrorNotInstalled(t *testing.T) {
+	defer func() {
+		expected := "centra: no Mux installed in the request, the centra.Handler middleware must be registered before the handlers that call centra.Error, see IsInstalled"
+		if r := recover(); r != expected {
+			t.Fatalf("expected panic %q, got %v", expected, r)
+		}
+	}()
+
+	Error(httptest.NewRecorder(), httptest.NewRequest("", "/", nil), errString("A"))
+}
+
+func TestPanicOnMissingMux(t *testing.T) {
+	defer func(v bool) { PanicOnMissingMux = v }(PanicOnMissingMux)
+
+	testCases := map[string]struct {
+		Panic bool
+
+		ExpectedPanic  any
+		ExpectedStatus int
+	}{
+		"Panic": {
+			Panic:          true,
+			ExpectedPanic:  "centra: no Mux installed in the request, the centra.Handler middleware must be registered before the handlers that call centra.Error, see IsInstalled",
+			ExpectedStatus: http.StatusOK,
+		},
+		"Fallback": {
+			Panic:          false,
+			ExpectedPanic:  nil,
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			PanicOnMissingMux = tc.Panic
+			recorder := httptest.NewRecorder()
+
+			func() {
+				defer func() {
+					if r := recover(); tc.ExpectedPanic != r {
+						t.Fatalf("expected panic %v, got %v", tc.ExpectedPanic, r)
+					}
+				}()
+				Error(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+			}()
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestErrorNilArgs(t *testing.T) {
+	req := SetMux(httptest.NewRequest("", "/", nil), NewMux())
+	recorder := httptest.NewRecorder()
+
+	testCases := map[string]struct {
+		Call func()
+
+		ExpectedPanic string
+	}{
+		"Error_Nil_Request": {
+			Call:          func() { Error(recorder, nil, errString("A")) },
+			ExpectedPanic: "centra: nil *http.Request passed to Error",
+		},
+		"Error_Nil_ResponseWriter": {
+			Call:          func() { Error(nil, req, errString("A")) },
+			ExpectedPanic: "centra: nil http.ResponseWriter passed to Error",
+		},
+		"ErrorStatus_Nil_Request": {
+			Call:          func() { ErrorStatus(recorder, nil, http.StatusBadRequest, errString("A")) },
+			ExpectedPanic: "centra: nil *http.Request passed to ErrorStatus",
+		},
+		"ErrorCtx_Nil_Context": {
+			Call:          func() { ErrorCtx(nil, recorder, errString("A")) },
+			ExpectedPanic: "centra: nil context.Context passed to ErrorCtx",
+		},
+		"ErrorCtx_Nil_ResponseWriter": {
+			Call:          func() { ErrorCtx(req.Context(), nil, errString("A")) },
+			ExpectedPanic: "centra: nil http.ResponseWriter passed to ErrorCtx",
+		},
+		"ServeError_Nil_Request": {
+			Call:          func() { NewMux().ServeError(recorder, nil, errString("A")) },
+			ExpectedPanic: "centra: nil *http.Request passed to ServeError",
+		},
+		"ErrorWithKey_Nil_ResponseWriter": {
+			Call:          func() { ErrorWithKey(keyContext{}, nil, req, errString("A")) },
+			ExpectedPanic: "centra: nil http.ResponseWriter passed to ErrorWithKey",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r != tc.ExpectedPanic {
+					t.Fatalf("expected panic %q, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			tc.Call()
+		})
+	}
+}
+
+func TestNilHandlerPanics(t *testing.T) {
+	errMux := NewMux()
+	errNotFound := errors.New("record not found")
+
+	testCases := map[string]struct {
+		Call func()
+
+		ExpectedPanic string
+	}{
+		"Handle": {
+			Call:          func() { errMux.Handle(errNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error: record not found",
+		},
+		"HandleNamed": {
+			Call:          func() { errMux.HandleNamed("not-found", errNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error: record not found",
+		},
+		"HandleP": {
+			Call:          func() { errMux.HandleP(1, errNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error: record not found",
+		},
+		"HandleExact": {
+			Call:          func() { errMux.HandleExact(errNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error: record not found",
+		},
+		"HandleMatch": {
+			Call:          func() { errMux.HandleMatch(errNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error: record not found",
+		},
+		"HandleStatus": {
+			Call:          func() { errMux.HandleStatus(http.StatusNotFound, nil) },
+			ExpectedPanic: "centra: handler must not be nil for status code 404",
+		},
+		"HandleType": {
+			Call:          func() { HandleType[*NotFoundError](errMux, nil) },
+			ExpectedPanic: "centra: handler must not be nil for error type *centra.NotFoundError",
+		},
+		"UnknownHandlers": {
+			Call:          func() { errMux.UnknownHandlers(DefaultUnknownHandler, nil) },
+			ExpectedPanic: "centra: handler at index 1 must not be nil",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r != tc.ExpectedPanic {
+					t.Fatalf("expected panic %q, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			tc.Call()
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	errA := errString("A_UNWRAP")
+
+	parent := NewMux()
+	parent.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Fatalf("Match must not call handlers")
+	})
+
+	errMux := NewMux()
+	errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Fatalf("Match must not call handlers")
+	})
+
+	testCases := map[string]struct {
+		Parent *Mux
+		Err    error
+
+		ExpectedMatched error
+		ExpectedOk      bool
+	}{
+		"Matched_Wrapped": {
+			Err:             errStringWrapped("A"),
+			ExpectedMatched: errA,
+			ExpectedOk:      true,
+		},
+		"Unknown": {
+			Err:        errString("B"),
+			ExpectedOk: false,
+		},
+		"Nil": {
+			Err:        nil,
+			ExpectedOk: false,
+		},
+		"Parent": {
+			Parent:          parent,
+			Err:             errString("B"),
+			ExpectedMatched: errString("B"),
+			ExpectedOk:      true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux.WithParent(tc.Parent)
+
+			matched, ok := errMux.Match(tc.Err)
+			if tc.ExpectedOk != ok {
+				t.Fatalf("expected ok %v, got %v", tc.ExpectedOk, ok)
+			}
+			if tc.ExpectedMatched != matched {
+				t.Fatalf("expected matched %v, got %v", tc.ExpectedMatched, matched)
+			}
+		})
+	}
+}
+
+func TestUnhandled(t *testing.T) {
+	parent := NewMux()
+	parent.Handle(errString("PARENT"), func(w http.ResponseWriter, r *http.Request, err error) {})
+
+	errMux := NewMux()
+	errMux.WithParent(parent)
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Fatalf("Unhandled must not call handlers")
+	})
+	errMux.HandleStatus(http.StatusNotFound, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+	testCases := map[string]struct {
+		Errs []error
+
+		ExpectedUnhandled []error
+	}{
+		"All_Handled": {
+			Errs:              []error{errString("A"), fmt.Errorf("w: %w", errString("A")), errString("PARENT"), codedError{code: http.StatusNotFound}},
+			ExpectedUnhandled: nil,
+		},
+		"Mixed": {
+			Errs:              []error{errString("B"), fmt.Errorf("w: %w", errString("A")), fmt.Errorf("w: %w", errString("C")), nil},
+			ExpectedUnhandled: []error{errString("B"), fmt.Errorf("w: %w", errString("C")), nil},
+		},
+		"Empty": {
+			Errs:              nil,
+			ExpectedUnhandled: nil,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			unhandled := errMux.Unhandled(tc.Errs...)
+			if !slices.EqualFunc(tc.ExpectedUnhandled, unhandled, func(a, b error) bool {
+				return fmt.Sprint(a) == fmt.Sprint(b)
+			}) {
+				t.Fatalf("expected %v, got %v", tc.ExpectedUnhandled, unhandled)
+			}
+		})
+	}
+}
+
+func TestMatchedName(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedName string
+	}{
+		"Named": {
+			Err:          errString("A"),
+			ExpectedName: "a_error",
+		},
+		"Unnamed": {
+			Err:          errString("B"),
+			ExpectedName: "B",
+		},
+		"Unknown": {
+			Err:          errString("C"),
+			ExpectedName: UnknownName,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got string
+			record := func(w http.ResponseWriter, r *http.Request, err error) {
+				got = MatchedName(r)
+			}
+
+			errMux := NewMux()
+			errMux.UnknownHandler(record)
+			errMux.HandleNamed("a_error", errString("A"), record)
+			errMux.Handle(errString("B"), record)
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedName != got {
+				t.Fatalf("expected name %s, got %s", tc.ExpectedName, got)
+			}
+		})
+	}
+}
+
+func TestCurrentError(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedOk bool
+	}{
+		"Registered": {
+			Err:        errStringWrapped("A"),
+			ExpectedOk: true,
+		},
+		"Unknown": {
+			Err:        errString("B"),
+			ExpectedOk: true,
+		},
+		"Nil_Error": {
+			Err:        nil,
+			ExpectedOk: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				got   error
+				gotOk bool
+			)
+			page := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, gotOk = CurrentError(r)
+			})
+
+			errMux := NewMux()
+			errMux.UnknownHandler(HandlerFromHTTP(page))
+			errMux.Handle(errString("A_UNWRAP"), HandlerFromHTTP(page))
+
+			r := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			Error(httptest.NewRecorder(), r, tc.Err)
+
+			if tc.ExpectedOk != gotOk {
+				t.Fatalf("expected ok %v, got %v", tc.ExpectedOk, gotOk)
+			}
+			if tc.Err != got {
+				t.Fatalf("expected error %v, got %v", tc.Err, got)
+			}
+
+			// the request passed to Error never sees the error
+			if err, ok := CurrentError(r); ok || err != nil {
+				t.Fatalf("expected no current error after Error returned, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Nested_Error", func(t *testing.T) {
+		var got []error
+		record := func(w http.ResponseWriter, r *http.Request, err error) {
+			current, _ := CurrentError(r)
+			got = append(got, current)
+			if err == errString("A") {
+				Error(w, r, errString("B"))
+			}
+		}
+
+		errMux := NewMux()
+		errMux.UnknownHandler(record)
+
+		Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+		if expected := "[A B]"; fmt.Sprint(got) != expected {
+			t.Fatalf("expected %s, got %v", expected, got)
+		}
+	})
+}
+
+func TestDefaultUnknown(t *testing.T) {
+	before := NewMux()
+
+	defer func(old ErrorHandlerFunc) { DefaultUnknown = old }(DefaultUnknown)
+	DefaultUnknown = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, "swapped")
+	}
+
+	testCases := map[string]struct {
+		Mux *Mux
+
+		ExpectedBuf string
+	}{
+		"Created_After": {
+			Mux:         NewMux(),
+			ExpectedBuf: "swapped",
+		},
+		"Created_Before": {
+			Mux:         before,
+			ExpectedBuf: "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), tc.Mux), errString("A"))
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestDefaultUnknownBody(t *testing.T) {
+	defer func(status int, body string) {
+		DefaultUnknownStatus, DefaultUnknownBody = status, body
+	}(DefaultUnknownStatus, DefaultUnknownBody)
+
+	testCases := map[string]struct {
+		Status int
+		Body   string
+		Hint   int
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Defaults": {
+			Status:         http.StatusInternalServerError,
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+		"Body": {
+			Status:         http.StatusInternalServerError,
+			Body:           "<h1>Oops</h1>",
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Oops</h1>",
+		},
+		"Status": {
+			Status:         http.StatusServiceUnavailable,
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedBuf:    "<h1>Service Unavailable</h1>",
+		},
+		"Hinted_Status_Ignores_Body": {
+			Status:         http.StatusInternalServerError,
+			Body:           "<h1>Oops</h1>",
+			Hint:           http.StatusBadGateway,
+			ExpectedStatus: http.StatusBadGateway,
+			ExpectedBuf:    "<h1>Bad Gateway</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			DefaultUnknownStatus, DefaultUnknownBody = tc.Status, tc.Body
+
+			recorder := httptest.NewRecorder()
+			r := SetMux(httptest.NewRequest("", "/", nil), NewMux())
+			if tc.Hint != 0 {
+				ErrorStatus(recorder, r, tc.Hint, errString("A"))
+			} else {
+				Error(recorder, r, errString("A"))
+			}
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWith(t *testing.T) {
+	handler := func(body string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, body)
+		}
+	}
+
+	errMux := NewMux()
+	errMux.Handle(errString("A"), handler("A"))
+
+	assert := func(err error, expected string) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), err)
+		if expected != recorder.Body.String() {
+			t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+		}
+	}
+
+	restoreOuter := errMux.With(func(m *Mux) {
+		m.Handle(errString("B"), handler("B"))
+	})
+	assert(errString("B"), "B")
+
+	restoreInner := errMux.With(func(m *Mux) {
+		m.Handle(errString("A"), handler("A inner"))
+		m.UnknownHandler(handler("unknown inner"))
+	})
+	assert(errString("A"), "A inner")
+	assert(errString("C"), "unknown inner")
+
+	restoreInner()
+	assert(errString("A"), "A")
+	assert(errString("B"), "B")
+	assert(errString("C"), "<h1>Internal Server Error</h1>")
+
+	// registered outside of fn, undone anyway since restore replaces wholesale
+	errMux.Handle(errString("C"), handler("C"))
+
+	restoreOuter()
+	assert(errString("A"), "A")
+	assert(errString("B"), "<h1>Internal Server Error</h1>")
+	assert(errString("C"), "<h1>Internal Server Error</h1>")
+
+	restore := errMux.With(func(m *Mux) {})
+	errMux.Seal()
+	defer func() {
+		expected := "centra: Mux is sealed, cannot call With() after Seal()"
+		if r := recover(); r != expected {
+			t.Fatalf("expected panic %q, got %v", expected, r)
+		}
+	}()
+	restore()
+}
+
+func TestErrorCtx(t *testing.T) {
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Registered": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, err.Error())
+			},
+
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "A",
+		},
+		"NegotiatingHandler": {
+			Handler: NegotiatingHandler(http.StatusNotFound),
+
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "<h1>Not Found</h1>",
+		},
+		"ProblemDetailsHandler": {
+			Handler: ProblemDetailsHandler(http.StatusNotFound),
+
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    `{"instance":"","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(errString("A"), tc.Handler)
+
+			// only the context is passed down to the code calling ErrorCtx
+			doWork := func(ctx context.Context, w http.ResponseWriter) {
+				ErrorCtx(ctx, w, errString("A"))
+			}
+
+			recorder := httptest.NewRecorder()
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				doWork(r.Context(), w)
+			})).ServeHTTP(recorder, httptest.NewRequest("", "/users/1", nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleP(t *testing.T) {
+	errBase := errString("base")
+	errWrapped := fmt.Errorf("wrapped: %w", errBase)
+
+	testCases := map[string]struct {
+		Register func(m *Mux, h func(string) ErrorHandlerFunc)
+
+		ExpectedBuf      string
+		ExpectedHandlers string
+	}{
+		"Higher_Priority_Registered_First": {
+			Register: func(m *Mux, h func(string) ErrorHandlerFunc) {
+				m.HandleP(10, errWrapped, h("high"))
+				m.Handle(errBase, h("default"))
+			},
+			ExpectedBuf:      "high",
+			ExpectedHandlers: "[base wrapped: base]",
+		},
+		"Lower_Priority_Registered_Last": {
+			Register: func(m *Mux, h func(string) ErrorHandlerFunc) {
+				m.Handle(errWrapped, h("default"))
+				m.HandleP(-1, errBase, h("low"))
+			},
+			ExpectedBuf:      "default",
+			ExpectedHandlers: "[base wrapped: base]",
+		},
+		"Interleaved": {
+			Register: func(m *Mux, h func(string) ErrorHandlerFunc) {
+				m.HandleP(5, errBase, h("5 first"))
+				m.HandleP(1, errWrapped, h("1"))
+				m.HandleP(5, errWrapped, h("5 last"))
+				m.Handle(errBase, h("default"))
+				m.HandleP(3, errBase, h("3"))
+			},
+			ExpectedBuf:      "5 last",
+			ExpectedHandlers: "[base wrapped: base base base wrapped: base]",
+		},
+		"Same_Priority_Last_Wins": {
+			Register: func(m *Mux, h func(string) ErrorHandlerFunc) {
+				m.HandleP(2, errWrapped, h("first"))
+				m.HandleP(2, errBase, h("last"))
+			},
+			ExpectedBuf:      "last",
+			ExpectedHandlers: "[wrapped: base base]",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			tc.Register(errMux, func(body string) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, body)
+				}
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errWrapped)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if handlers := fmt.Sprint(errMux.Handlers()); tc.ExpectedHandlers != handlers {
+				t.Fatalf("expected handlers %s, got %s", tc.ExpectedHandlers, handlers)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+	errBase := errString("base")
+
+	testCases := map[string]struct {
+		Mux func() *Mux
+
+		ExpectedErr string
+	}{
+		"Valid": {
+			Mux: func() *Mux {
+				m := NewMux()
+				m.Handle(errString("A"), noopHandler)
+				// the wrapped error is registered after the base, so it's reachable
+				m.Handle(errBase, noopHandler)
+				m.Handle(fmt.Errorf("wrapped: %w", errBase), noopHandler)
+				m.HandleExact(errString("A"), noopHandler)
+				return m
+			},
+		},
+		"Not_Initialized": {
+			Mux:         func() *Mux { return &Mux{} },
+			ExpectedErr: "centra: Mux has not been initialized correctly, please call NewMux()",
+		},
+		"Duplicates_Allowed": {
+			Mux: func() *Mux {
+				m := NewMux()
+				m.Handle(errString("A"), noopHandler)
+				m.Handle(errString("A"), noopHandler)
+				return m
+			},
+		},
+		"Duplicates_Reported": {
+			Mux: func() *Mux {
+				m := NewMux(WithOnDuplicate(func(error) {}))
+				m.Handle(errString("A"), noopHandler)
+				m.Handle(errString("A"), noopHandler)
+				m.Handle(errString("B"), noopHandler)
+				m.Handle(errString("B"), noopHandler)
+				return m
+			},
+			ExpectedErr: "centra: duplicate handler registration for error: A\n" +
+				"centra: duplicate handler registration for error: B",
+		},
+		"Shadowed": {
+			Mux: func() *Mux {
+				m := NewMux()
+				m.HandleNamed("wrapped", fmt.Errorf("wrapped: %w", errBase), noopHandler)
+				m.Handle(errBase, noopHandler)
+				return m
+			},
+			ExpectedErr: `centra: handler for "wrapped" is shadowed by the handler for "base", which takes precedence`,
+		},
+		"Shadowed_By_Type": {
+			Mux: func() *Mux {
+				m := NewMux()
+				m.HandleNamed("funds", fmt.Errorf("wrapped: %w", insufficientFundsError{}), noopHandler)
+				HandleType(m, func(w http.ResponseWriter, r *http.Request, err insufficientFundsError) {})
+				return m
+			},
+			ExpectedErr: `centra: handler for "funds" is shadowed by the handler for "centra: errors of type centra.insufficientFundsError", which takes precedence`,
+		},
+		"Higher_Priority_Reachable": {
+			Mux: func() *Mux {
+				m := NewMux()
+				m.HandleP(1, fmt.Errorf("wrapped: %w", errBase), noopHandler)
+				m.Handle(errBase, noopHandler)
+				HandleType(m, func(w http.ResponseWriter, r *http.Request, err insufficientFundsError) {})
+				return m
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.Mux().Validate()
+
+			if tc.ExpectedErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || tc.ExpectedErr != err.Error() {
+				t.Fatalf("expected error %q, got %v", tc.ExpectedErr, err)
+			}
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	errMux := NewMux()
+	if handlers := errMux.Handlers(); len(handlers) != 0 {
+		t.Fatalf("expected no handlers, got %v", handlers)
+	}
+
+	expected := []error{errString("A"), errString("B"), errString("C"), errString("A")}
+
+	errMux.Handle(expected[0], noopHandler)
+	errMux.HandleExact(expected[1], noopHandler)
+	errMux.UnknownHandler(noopHandler)
+	errMux.HandleNamed("c", expected[2], noopHandler)
+	errMux.Handle(expected[3], noopHandler)
+
+	handlers := errMux.Handlers()
+	if len(expected) != len(handlers) {
+		t.Fatalf("expected %v, got %v", expected, handlers)
+	}
+	for i := range expected {
+		if expected[i] != handlers[i] {
+			t.Fatalf("expected %v, got %v", expected, handlers)
+		}
+	}
+}
+
+func TestErrorNil(t *testing.T) {
+	parent := NewMux()
+	parent.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		io.WriteString(w, "parent unknown")
+	})
+
+	testCases := map[string]struct {
+		Parent *Mux
+		Call   func(w http.ResponseWriter, r *http.Request)
+
+		ExpectedBuf string
+	}{
+		"Error_Nil": {
+			Call:        func(w http.ResponseWriter, r *http.Request) { Error(w, r, nil) },
+			ExpectedBuf: "unknown",
+		},
+		"ErrorUnknown": {
+			Call:        ErrorUnknown,
+			ExpectedBuf: "unknown",
+		},
+		"ErrorUnknown_Parent": {
+			Parent:      parent,
+			Call:        ErrorUnknown,
+			ExpectedBuf: "parent unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithStatusMapper(func(err error) (int, bool) {
+				t.Fatalf("status mapper must not be called for nil errors")
+				return 0, false
+			}))
+			errMux.WithParent(tc.Parent)
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				if err != nil {
+					t.Fatalf("expected nil error, got %v", err)
+				}
+				io.WriteString(w, "unknown")
+			})
+			HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err error) {
+				t.Fatalf("registered handlers must not be called for nil errors")
+			})
+
+			recorder := httptest.NewRecorder()
+			tc.Call(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux))
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestErrorAllocs guards the allocations documented in Mux: none to match an error, and one to
+// dispatch it, or to install the Mux with the middleware, for the request passed on.
+func TestErrorAllocs(t *testing.T) {
+	errA := errString("A")
+	errMux := NewMux()
+	errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {})
+	for i := 0; i < 10; i++ {
+		errMux.Handle(errString(strconv.Itoa(i)), func(w http.ResponseWriter, r *http.Request, err error) {})
+	}
+	errMux.Handle(errA, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+	req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+	recorder := httptest.NewRecorder()
+	wrapped := fmt.Errorf("wrapped: %w", errString("0"))
+	plain := httptest.NewRequest("", "/", nil)
+	middleware := errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := map[string]struct {
+		Call func()
+
+		ExpectedAllocs float64
+	}{
+		"Match": {
+			Call:           func() { errMux.Match(wrapped) },
+			ExpectedAllocs: 0,
+		},
+		"Error_Matched": {
+			Call:           func() { Error(recorder, req, errA) },
+			ExpectedAllocs: 1,
+		},
+		"Error_Matched_Wrapped": {
+			Call:           func() { Error(recorder, req, wrapped) },
+			ExpectedAllocs: 1,
+		},
+		"ErrorUnknown": {
+			Call:           func() { ErrorUnknown(recorder, req) },
+			ExpectedAllocs: 1,
+		},
+		"Handler_Middleware": {
+			Call:           func() { middleware.ServeHTTP(recorder, plain) },
+			ExpectedAllocs: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if allocs := testing.AllocsPerRun(100, tc.Call); allocs > tc.ExpectedAllocs {
+				t.Fatalf("expected at most %v allocations, got %v", tc.ExpectedAllocs, allocs)
+			}
+		})
+	}
+}
+
+// BenchmarkMatch measures the matching of a wrapped error against 10 handlers, which must not
+// allocate, see TestErrorAllocs.
+func BenchmarkMatch(b *testing.B) {
+	errMux := NewMux()
+	for i := 0; i < 10; i++ {
+		errMux.Handle(errString(strconv.Itoa(i)), func(w http.ResponseWriter, r *http.Request, err error) {})
+	}
+	err := fmt.Errorf("wrapped: %w", errString("0"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		errMux.Match(err)
+	}
+}
+
+func BenchmarkErrorNil(b *testing.B) {
+	errMux := NewMux()
+	errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {})
+	for i := 0; i < 10; i++ {
+		errMux.Handle(errString(strconv.Itoa(i)), func(w http.ResponseWriter, r *http.Request, err error) {})
+	}
+
+	req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+	recorder := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ErrorUnknown(recorder, req)
+	}
+}
+
+// BenchmarkErrorHandlers measures the dispatch of Error with n registered handlers, for a target
+// that is the first registered one, the last registered one and an unknown one.
+//
+// Matching scans the handlers from the last registered to the first calling errors.Is, so the
+// cost grows linearly with the number of handlers skipped: the last registered target costs about
+// the same regardless of n, while the first registered and the unknown ones pay a full scan. At
+// the time of writing, a dispatch costs ~350ns with 1 handler, almost all of it deriving the
+// request for the handler, and a full scan of 100 handlers adds ~1.7µs. A map lookup would only
+// help Mux with hundreds of handlers, and it cannot express errors.Is matching of wrapped errors,
+// so the scan is kept.
+func BenchmarkErrorHandlers(b *testing.B) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	for _, n := range []int{1, 10, 100} {
+		errMux := NewMux()
+		errMux.UnknownHandler(noopHandler)
+
+		errs := make([]error, n)
+		for i := range errs {
+			errs[i] = errString("error " + strconv.Itoa(i))
+			errMux.Handle(errs[i], noopHandler)
+		}
+
+		targets := map[string]error{
+			"First":   errs[0],
+			"Last":    errs[n-1],
+			"Unknown": errString("unknown"),
+		}
+
+		for name, target := range targets {
+			b.Run(strconv.Itoa(n)+"/"+name, func(b *testing.B) {
+				req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+				w := httptest.NewRecorder()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					Error(w, req, target)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package centragrpc reuses the errors registered in a centra Mux to map the errors returned by
+// gRPC handlers to gRPC status codes, so one registration drives both the HTTP response and the
+// gRPC status of an error.
+//
+// It lives in its own module so the gRPC dependency is only pulled by users that need it.
+package centragrpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/otaxhu/centra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mapping struct {
+	err  error
+	code codes.Code
+}
+
+// Registry maps the errors registered in a [centra.Mux] to gRPC codes.
+type Registry struct {
+	mux *centra.Mux
+
+	mu       sync.RWMutex
+	mappings []mapping
+}
+
+// Returns a new Registry that registers its errors in m.
+func NewRegistry(m *centra.Mux) *Registry {
+	if m == nil {
+		panic("centragrpc: m must not be nil")
+	}
+
+	return &Registry{mux: m}
+}
+
+// Registers handler for err in the Mux of reg, see [centra.Mux.Handle], and code as the gRPC
+// code of the errors handled by handler.
+func (reg *Registry) Handle(err error, code codes.Code, handler centra.ErrorHandlerFunc) {
+	reg.mux.Handle(err, handler)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.mappings = append(reg.mappings, mapping{err: err, code: code})
+}
+
+// Returns the gRPC code registered for the error of the Mux that matches err, the same one
+// [centra.Error] would pick, see [centra.Mux.Match]. Returns false if no registered error matches
+// err or if the matching error has no code registered with [Registry.Handle], or with
+// [centra.Mux.Register] in the Mux of reg.
+func (reg *Registry) Code(err error) (codes.Code, bool) {
+	matched, ok := reg.mux.Match(err)
+	if !ok {
+		return codes.Unknown, false
+	}
+
+	if spec, ok := reg.mux.Outcome(err); ok {
+		if spec.GRPCCode == uint32(codes.OK) {
+			return codes.Unknown, false
+		}
+		return codes.Code(spec.GRPCCode), true
+	}
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	for i := len(reg.mappings) - 1; i >= 0; i-- {
+		if identical(reg.mappings[i].err, matched) {
+			return reg.mappings[i].code, true
+		}
+	}
+	return codes.Unknown, false
+}
+
+// Converts err to a gRPC status error with the code returned by [Registry.Code] and err.Error() as
+// message, or the message of the spec registered with [centra.Mux.Register] if it has one. err is
+// returned as is if it's nil, if it already carries a gRPC status, or if there is no code for it.
+func (reg *Registry) Status(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return err
+	}
+
+	code, ok := reg.Code(err)
+	if !ok {
+		return err
+	}
+	message := err.Error()
+	if spec, ok := reg.mux.Outcome(err); ok && spec.Message != "" {
+		message = spec.Message
+	}
+	return status.Error(code, message)
+}
+
+// Returns a unary server interceptor that converts the errors returned by the handlers with
+// [Registry.Status].
+func (reg *Registry) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		return resp, reg.Status(err)
+	}
+}
+
+// Returns a stream server interceptor that converts the errors returned by the handlers with
+// [Registry.Status].
+func (reg *Registry) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return reg.Status(handler(srv, ss))
+	}
+}
+
+// identical reports whether a == b, without panicking if they are not comparable.
+func identical(a, b error) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb || ta == nil || !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centragrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/otaxhu/centra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errInvalid  = errors.New("invalid")
+)
+
+func TestRegistry(t *testing.T) {
+	errMux := centra.NewMux()
+	reg := NewRegistry(errMux)
+
+	reg.Handle(errNotFound, codes.NotFound, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	reg.Handle(errInvalid, codes.InvalidArgument, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	// registered only for HTTP
+	errMux.Handle(errString("http only"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	interceptor := reg.UnaryServerInterceptor()
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedHTTPStatus int
+		ExpectedCode       codes.Code
+		ExpectedUnchanged  bool
+	}{
+		"Not_Found": {
+			Err:                errNotFound,
+			ExpectedHTTPStatus: http.StatusNotFound,
+			ExpectedCode:       codes.NotFound,
+		},
+		"Wrapped_Invalid": {
+			Err:                fmt.Errorf("field name: %w", errInvalid),
+			ExpectedHTTPStatus: http.StatusBadRequest,
+			ExpectedCode:       codes.InvalidArgument,
+		},
+		"HTTP_Only": {
+			Err:                errString("http only"),
+			ExpectedHTTPStatus: http.StatusTeapot,
+			ExpectedUnchanged:  true,
+		},
+		"Unknown": {
+			Err:                errors.New("unknown"),
+			ExpectedHTTPStatus: http.StatusInternalServerError,
+			ExpectedUnchanged:  true,
+		},
+		"Already_Status": {
+			Err:                status.Error(codes.Aborted, "aborted"),
+			ExpectedHTTPStatus: http.StatusInternalServerError,
+			ExpectedCode:       codes.Aborted,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				centra.Error(w, r, tc.Err)
+			})).ServeHTTP(recorder, req)
+
+			if tc.ExpectedHTTPStatus != recorder.Code {
+				t.Fatalf("expected HTTP status %d, got %d", tc.ExpectedHTTPStatus, recorder.Code)
+			}
+
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req any) (any, error) {
+					return nil, tc.Err
+				})
+
+			if tc.ExpectedUnchanged {
+				if err != tc.Err {
+					t.Fatalf("expected error to be returned unchanged, got %v", err)
+				}
+				return
+			}
+
+			st, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("expected a status error, got %v", err)
+			}
+			if tc.ExpectedCode != st.Code() {
+				t.Fatalf("expected code %v, got %v", tc.ExpectedCode, st.Code())
+			}
+			if msg := status.Convert(tc.Err).Message(); msg != st.Message() {
+				t.Fatalf("expected message %s, got %s", msg, st.Message())
+			}
+		})
+	}
+}
+
+func TestRegistryOutcome(t *testing.T) {
+	errGone := errors.New("gone")
+	errInternal := errors.New("internal")
+
+	errMux := centra.NewMux()
+	errMux.Register(errNotFound, centra.OutcomeSpec{
+		Status:   http.StatusNotFound,
+		GRPCCode: uint32(codes.NotFound),
+	})
+	errMux.Register(errGone, centra.OutcomeSpec{
+		Status:   http.StatusGone,
+		GRPCCode: uint32(codes.NotFound),
+		Message:  "resource removed",
+	})
+	// HTTP only
+	errMux.Register(errInternal, centra.OutcomeSpec{Status: http.StatusInternalServerError})
+
+	interceptor := NewRegistry(errMux).UnaryServerInterceptor()
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedHTTPStatus int
+		ExpectedCode       codes.Code
+		ExpectedMessage    string
+		ExpectedUnchanged  bool
+	}{
+		"Not_Found": {
+			Err:                fmt.Errorf("user 42: %w", errNotFound),
+			ExpectedHTTPStatus: http.StatusNotFound,
+			ExpectedCode:       codes.NotFound,
+			ExpectedMessage:    "user 42: not found",
+		},
+		"Message": {
+			Err:                errGone,
+			ExpectedHTTPStatus: http.StatusGone,
+			ExpectedCode:       codes.NotFound,
+			ExpectedMessage:    "resource removed",
+		},
+		"No_Code": {
+			Err:                errInternal,
+			ExpectedHTTPStatus: http.StatusInternalServerError,
+			ExpectedUnchanged:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			errMux.ServeError(recorder, httptest.NewRequest("", "/", nil), tc.Err)
+
+			if tc.ExpectedHTTPStatus != recorder.Code {
+				t.Fatalf("expected HTTP status %d, got %d", tc.ExpectedHTTPStatus, recorder.Code)
+			}
+
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req any) (any, error) {
+					return nil, tc.Err
+				})
+
+			if tc.ExpectedUnchanged {
+				if err != tc.Err {
+					t.Fatalf("expected error to be returned unchanged, got %v", err)
+				}
+				return
+			}
+
+			st, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("expected a status error, got %v", err)
+			}
+			if tc.ExpectedCode != st.Code() {
+				t.Fatalf("expected code %v, got %v", tc.ExpectedCode, st.Code())
+			}
+			if tc.ExpectedMessage != st.Message() {
+				t.Fatalf("expected message %s, got %s", tc.ExpectedMessage, st.Message())
+			}
+		})
+	}
+}
+
+type errString string
+
+func (e errString) Error() string {
+	return string(e)
+}
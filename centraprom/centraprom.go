@@ -0,0 +1,108 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package centraprom provides Prometheus instrumentation for centra error handlers.
+//
+// It lives in its own module so the Prometheus dependency is only pulled by users that need it.
+package centraprom
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/otaxhu/centra"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label value used for errors that did not match any registered error.
+const UnknownLabel = centra.UnknownName
+
+// Returns a middleware to be passed to [centra.Mux.Use], it increments the "centra_errors_total"
+// counter registered in reg, labeled by the matched error and the response status.
+//
+// The "error" label is the name of the handler as returned by [centra.MatchedName], that is the
+// name given to [centra.Mux.HandleNamed] or the Error() string of the registered error that
+// matched, or [UnknownLabel] if the error was handled by the UnknownHandler. So the label only
+// takes values from the registrations and never from dynamically generated errors.
+//
+// If reg is nil, [prometheus.DefaultRegisterer] is used. If the counter was already registered
+// in reg, the existing one is reused, so CountErrors can be called for several Mux.
+func CountErrors(reg prometheus.Registerer) func(centra.ErrorHandlerFunc) centra.ErrorHandlerFunc {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "centra",
+		Name:      "errors_total",
+		Help:      "Total number of errors handled by centra, by matched error and response status.",
+	}, []string{"error", "status"})
+
+	if err := reg.Register(counter); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			panic("centraprom: cannot register counter: " + err.Error())
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.CounterVec)
+		if !ok {
+			panic("centraprom: a collector with the same name but different type is already registered")
+		}
+		counter = existing
+	}
+
+	return func(next centra.ErrorHandlerFunc) centra.ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next(rec, r, err)
+
+			counter.WithLabelValues(centra.MatchedName(r), strconv.Itoa(rec.statusCode())).Inc()
+		}
+	}
+}
+
+// statusRecorder records the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, so [http.ResponseController] can reach its
+// Flusher, Hijacker and deadline capabilities.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) statusCode() int {
+	if s.status == 0 {
+		// net/http sends 200 if the handler didn't write anything
+		return http.StatusOK
+	}
+	return s.status
+}
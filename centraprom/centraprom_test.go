@@ -0,0 +1,109 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centraprom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/otaxhu/centra"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("conflict")
+)
+
+func TestCountErrors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	errMux := centra.NewMux()
+	errMux.Use(CountErrors(reg))
+	errMux.Handle(errNotFound, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	errMux.HandleNamed("conflict_error", errConflict, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Write([]byte("conflict"))
+	})
+
+	errs := []error{
+		errNotFound,
+		// dynamically generated errors are labeled with the registered error
+		fmt.Errorf("user 1: %w", errNotFound),
+		errConflict,
+		errors.New("dynamic unknown 1"),
+		errors.New("dynamic unknown 2"),
+	}
+
+	for _, e := range errs {
+		req := httptest.NewRequest("", "/", nil)
+		errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			centra.Error(w, r, e)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := `
+# HELP centra_errors_total Total number of errors handled by centra, by matched error and response status.
+# TYPE centra_errors_total counter
+centra_errors_total{error="conflict_error",status="200"} 1
+centra_errors_total{error="not found",status="404"} 2
+centra_errors_total{error="unknown",status="500"} 2
+`
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountErrors_AlreadyRegistered(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("expected to not panic, did panic: %v", r)
+		}
+	}()
+
+	reg := prometheus.NewRegistry()
+
+	CountErrors(reg)
+	CountErrors(reg)
+}
+
+func TestCountErrors_ResponseController(t *testing.T) {
+	errMux := centra.NewMux()
+	errMux.Use(CountErrors(prometheus.NewRegistry()))
+	errMux.Handle(errNotFound, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusNotFound)
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Fatalf("expected Flush to reach the underlying writer: %v", err)
+		}
+	})
+
+	req := httptest.NewRequest("", "/", nil)
+	recorder := httptest.NewRecorder()
+
+	errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		centra.Error(w, r, errNotFound)
+	})).ServeHTTP(recorder, req)
+
+	if !recorder.Flushed {
+		t.Fatalf("expected recorder to be flushed")
+	}
+}
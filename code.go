@@ -0,0 +1,70 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Coder is implemented by the errors that carry a stable machine-readable code, like "NOT_FOUND",
+// see [CodeJSONHandler].
+type Coder interface {
+	error
+	Code() string
+}
+
+// Code written by [CodeJSONHandler] for the errors without a [Coder] in their chain.
+const UnknownCode = "UNKNOWN"
+
+// Returns an error handler that writes the compact JSON schema used by many APIs, with
+// Content-Type "application/json" and status code status, so the clients switch on a stable code
+// instead of the messages:
+//
+//	{"code":"NOT_FOUND","message":"Not Found"}
+//
+// The code is the one of the first [Coder] in the chain of err, as reported by errors.As, or
+// [UnknownCode] if there is none. The message is the status text of status, or the message of err
+// if [WithVerboseErrors] is enabled, since it may leak internal details. A status of 0 means 500,
+// if a status has been hinted with [ErrorStatus], it's written instead.
+func CodeJSONHandler(status int) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		status := resolveStatus(r, status)
+
+		code := UnknownCode
+		var coder Coder
+		if errors.As(err, &coder) && coder.Code() != "" {
+			code = coder.Code()
+		}
+
+		message := statusText(r, status)
+		if detail, ok := errorDetail(r, err); ok {
+			message = detail
+		}
+
+		b, _ := json.Marshal(codeBody{Code: code, Message: message})
+		writeResponse(w, r, status, "application/json", b)
+	}
+}
+
+type codeBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stableCodeError struct {
+	code string
+}
+
+func (e stableCodeError) Error() string {
+	return "coded " + e.code
+}
+
+func (e stableCodeError) Code() string {
+	return e.code
+}
+
+func TestCodeJSONHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Status  int
+		Err     error
+		Verbose bool
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Coder": {
+			Status:         http.StatusNotFound,
+			Err:            stableCodeError{code: "NOT_FOUND"},
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    `{"code":"NOT_FOUND","message":"Not Found"}`,
+		},
+		"Coder_Wrapped": {
+			Status:         http.StatusConflict,
+			Err:            fmt.Errorf("saving: %w", stableCodeError{code: "VERSION_CONFLICT"}),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    `{"code":"VERSION_CONFLICT","message":"Conflict"}`,
+		},
+		"No_Coder": {
+			Status:         http.StatusBadRequest,
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBuf:    `{"code":"UNKNOWN","message":"Bad Request"}`,
+		},
+		"Empty_Code": {
+			Status:         0,
+			Err:            stableCodeError{},
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    `{"code":"UNKNOWN","message":"Internal Server Error"}`,
+		},
+		"Verbose": {
+			Status:         http.StatusNotFound,
+			Err:            stableCodeError{code: "NOT_FOUND"},
+			Verbose:        true,
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    `{"code":"NOT_FOUND","message":"coded NOT_FOUND"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(tc.Verbose))
+			errMux.UnknownHandler(CodeJSONHandler(tc.Status))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("expected Content-Type application/json, got %s", ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
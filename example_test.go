@@ -0,0 +1,101 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/otaxhu/centra"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+func ExampleMux_HandlerFunc() {
+	errMux := centra.NewMux()
+	errMux.Handle(errUserNotFound, centra.NotFoundHandler("<h1>No such user</h1>"))
+
+	router := http.NewServeMux()
+	router.Handle("GET /users/{id}", errMux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") != "1" {
+			return fmt.Errorf("loading user %s: %w", r.PathValue("id"), errUserNotFound)
+		}
+		_, err := fmt.Fprint(w, "user 1")
+		return err
+	}))
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		fmt.Println(recorder.Code, recorder.Body.String())
+	}
+	// Output:
+	// 200 user 1
+	// 404 <h1>No such user</h1>
+}
+
+// The package doesn't ship a panic recovery middleware, the one of the router, or a few lines
+// like these, convert the panics into errors handled by the Mux as any other.
+func Example_recoverer() {
+	errMux := centra.NewMux()
+	errMux.UnknownHandler(centra.DefaultUnknownJSONHandler)
+
+	recoverer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if v := recover(); v != nil {
+					centra.Error(w, r, fmt.Errorf("panic: %v", v))
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler := errMux.Handler(recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	fmt.Println(recorder.Code, recorder.Header().Get("Content-Type"))
+	fmt.Println(recorder.Body.String())
+	// Output:
+	// 500 application/json
+	// {"error":"internal server error"}
+}
+
+func ExampleNegotiatingHandler() {
+	errMux := centra.NewMux()
+	errMux.Handle(errUserNotFound, centra.NegotiatingHandler(http.StatusNotFound))
+
+	handler := errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		centra.Error(w, r, errUserNotFound)
+	}))
+
+	for _, accept := range []string{"text/html", "application/json", "text/plain"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		fmt.Println(recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	// Output:
+	// 404 text/html; charset=utf-8 <h1>Not Found</h1>
+	// 404 application/json {"error":"not found"}
+	// 404 text/plain; charset=utf-8 Not Found
+}
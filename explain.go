@@ -0,0 +1,99 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Explanation describes how an error would be routed by a Mux, see [Mux.Explain]. It can be
+// marshaled as JSON, for example to be served by an admin endpoint.
+type Explanation struct {
+	// Message of the explained error, empty if it's nil.
+	Error string `json:"error"`
+
+	// Handlers tested, in the order they were tested.
+	Steps []ExplanationStep `json:"steps"`
+
+	// Name of the selected handler, see [MatchedName].
+	Selected string `json:"selected"`
+
+	// Whether the selected handler is the UnknownHandler.
+	Unknown bool `json:"unknown"`
+}
+
+// ExplanationStep is a handler tested while routing an error, see [Explanation].
+type ExplanationStep struct {
+	// Mux the handler is registered in, 0 for the explaining Mux, 1 for its parent, and so on.
+	Depth int `json:"depth"`
+
+	// Name of the handler, see [MatchedName].
+	Handler string `json:"handler"`
+
+	// Message of the error tested against the handler, which differs from the explained one for
+	// the errors joined with errors.Join.
+	Target string `json:"target"`
+
+	// Whether the handler matched Target.
+	Matched bool `json:"matched"`
+}
+
+// Returns a human-readable trace of the explanation, one line per step.
+func (e Explanation) String() string {
+	var b strings.Builder
+	b.WriteString("error: " + strconv.Quote(e.Error) + "\n")
+	for _, step := range e.Steps {
+		result := "no match"
+		if step.Matched {
+			result = "match"
+		}
+		b.WriteString("  [" + strconv.Itoa(step.Depth) + "] " + strconv.Quote(step.Handler) +
+			" against " + strconv.Quote(step.Target) + ": " + result + "\n")
+	}
+	b.WriteString("selected: " + strconv.Quote(e.Selected))
+	if e.Unknown {
+		b.WriteString(" (UnknownHandler)")
+	}
+	return b.String()
+}
+
+// Returns how err would be routed if [Error] was called with it: the handlers tested, including
+// the ones of the parent Mux, whether they matched, and the selected one, without calling any
+// handler. It's meant for debugging registrations whose errors.Is interactions are confusing.
+func (m *Mux) Explain(err error) Explanation {
+	var e Explanation
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	err = boundChain(err)
+	_, _, selected := m.resolveTrace("", err, func(owner *Mux, h handlerStruct, target error, matched bool) {
+		depth := 0
+		for p := m; p != owner; p = p.load().parent {
+			depth++
+		}
+		e.Steps = append(e.Steps, ExplanationStep{
+			Depth:   depth,
+			Handler: h.label(),
+			Target:  target.Error(),
+			Matched: matched,
+		})
+	})
+
+	e.Selected = selected.label()
+	e.Unknown = selected.err == nil
+	return e
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Fatalf("expected no handler to be called")
+	}
+
+	parent := NewMux()
+	parent.Handle(errString("P"), noopHandler)
+
+	errMux := NewMux()
+	errMux.WithParent(parent)
+	errMux.Handle(errString("A"), noopHandler)
+	errMux.HandleNamed("b_error", errString("B"), noopHandler)
+	errMux.HandleStatus(http.StatusNotFound, noopHandler)
+
+	testCases := map[string]struct {
+		Err error
+
+		Expected string
+	}{
+		"Matched": {
+			Err: fmt.Errorf("wrapped: %w", errString("A")),
+			Expected: `error: "wrapped: A"
+  [0] "b_error" against "wrapped: A": no match
+  [0] "A" against "wrapped: A": match
+selected: "A"`,
+		},
+		"Joined": {
+			Err: errors.Join(errString("other"), errString("A")),
+			Expected: `error: "other\nA"
+  [0] "b_error" against "other": no match
+  [0] "A" against "other": no match
+  [0] "b_error" against "A": no match
+  [0] "A" against "A": match
+selected: "A"`,
+		},
+		"Status": {
+			Err: codedError{code: http.StatusNotFound},
+			Expected: `error: "coded 404"
+  [0] "b_error" against "coded 404": no match
+  [0] "A" against "coded 404": no match
+  [0] "centra: errors mapped to status 404" against "coded 404": match
+selected: "centra: errors mapped to status 404"`,
+		},
+		"Parent_Then_Unknown": {
+			Err: errString("other"),
+			Expected: `error: "other"
+  [0] "b_error" against "other": no match
+  [0] "A" against "other": no match
+  [1] "P" against "other": no match
+selected: "unknown" (UnknownHandler)`,
+		},
+		"Nil": {
+			Err: nil,
+			Expected: `error: ""
+selected: "unknown" (UnknownHandler)`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := errMux.Explain(tc.Err).String(); tc.Expected != got {
+				t.Fatalf("expected\n%s\ngot\n%s", tc.Expected, got)
+			}
+		})
+	}
+}
+
+func TestExplain_JSON(t *testing.T) {
+	errMux := NewMux()
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+
+	b, err := json.Marshal(errMux.Explain(errString("A")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"error":"A","steps":[{"depth":0,"handler":"A","target":"A","matched":true}],"selected":"A","unknown":false}`
+	if expected != string(b) {
+		t.Fatalf("expected %s, got %s", expected, b)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+)
+
+// Matcher error, meant to be registered with [Mux.HandleMatch], that matches the errors that are
+// fs.ErrNotExist or fs.ErrPermission as reported by errors.Is, like the *fs.PathError wrapping
+// ENOENT or EACCES returned by os.Open, typically along with [FSErrorHandler]:
+//
+//	errMux.HandleMatch(centra.FSErrors, centra.FSErrorHandler())
+var FSErrors error = fsErrors{}
+
+type fsErrors struct{}
+
+func (fsErrors) Error() string {
+	return "centra: file system errors"
+}
+
+func (fsErrors) Is(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+// Returns an error handler for the errors of file-serving endpoints, it writes 404 Not Found if
+// err is fs.ErrNotExist and 403 Forbidden if err is fs.ErrPermission, as reported by errors.Is.
+// The response is rendered by [NegotiatingHandler].
+//
+// The other errors are handled by the UnknownHandler.
+func FSErrorHandler() ErrorHandlerFunc {
+	notFound := NegotiatingHandler(http.StatusNotFound)
+	forbidden := NegotiatingHandler(http.StatusForbidden)
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			notFound(w, r, err)
+		case errors.Is(err, fs.ErrPermission):
+			forbidden(w, r, err)
+		default:
+			callUnknown(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFSErrorHandler(t *testing.T) {
+	_, errOpen := os.Open(filepath.Join(t.TempDir(), "missing.html"))
+	if errOpen == nil {
+		t.Fatal("expected opening a missing file to fail")
+	}
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+	}{
+		"Not_Exist_Open": {
+			Err:            fmt.Errorf("serving page: %w", errOpen),
+			ExpectedStatus: http.StatusNotFound,
+		},
+		"Not_Exist_Deep": {
+			Err: fmt.Errorf("a: %w", fmt.Errorf("b: %w", &fs.PathError{
+				Op: "open", Path: "/srv/page.html", Err: syscall.ENOENT,
+			})),
+			ExpectedStatus: http.StatusNotFound,
+		},
+		"Permission": {
+			Err:            &fs.PathError{Op: "open", Path: "/srv/secret", Err: syscall.EACCES},
+			ExpectedStatus: http.StatusForbidden,
+		},
+		"Other": {
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusTeapot,
+		},
+		"Other_Handled_By_FSErrorHandler": {
+			Err:            errString("B"),
+			ExpectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+			errMux.HandleMatch(FSErrors, FSErrorHandler())
+			errMux.Handle(errString("B"), FSErrorHandler())
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
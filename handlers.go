@@ -0,0 +1,759 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Data passed to the template executed by [TemplateHandler].
+type TemplateData struct {
+	// Status code written to the response.
+	Status int
+
+	// Message of the error being handled, err.Error() passed through the sanitizer set with
+	// WithSanitizer, or the status text if err is nil.
+	Message string
+
+	// Path of the request, r.URL.Path.
+	Path string
+}
+
+// Returns an error handler that executes the template named name from t with a [TemplateData]
+// and writes the result with Content-Type "text/html; charset=utf-8" and status code status.
+//
+// If a status has been hinted with [ErrorStatus], it's written instead of status, a status of 0
+// means 500.
+//
+// The template is rendered to a buffer first, if its execution fails, a plain 500 response is
+// written instead, so a half-rendered page is never sent. See [WithETags] to let the clients cache
+// the pages rendered from static templates.
+func TemplateHandler(t *template.Template, name string, status int) ErrorHandlerFunc {
+	if t == nil {
+		panic("centra: t must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		status := resolveStatus(r, status)
+
+		data := TemplateData{
+			Status:  status,
+			Message: statusText(r, status),
+			Path:    r.URL.Path,
+		}
+		if err != nil {
+			data.Message = sanitize(r, err.Error())
+		}
+
+		var buf bytes.Buffer
+		if execErr := t.ExecuteTemplate(&buf, name, data); execErr != nil {
+			writePlainInternalServerError(w, r)
+			return
+		}
+
+		if notModified(w, r, buf.Bytes()) {
+			return
+		}
+
+		writeResponse(w, r, status, "text/html", buf.Bytes())
+	}
+}
+
+// Returns an error handler that writes the file named name from fsys with status code status, so
+// prebuilt error pages can be shipped with go:embed. Content-Type is set by the extension of name,
+// "application/octet-stream" if it's unknown, and Content-Length by the size of the file.
+//
+// If a status has been hinted with [ErrorStatus], it's written instead of status, a status of 0
+// means 500.
+//
+// If the file cannot be opened, for example because it doesn't exist, a plain 500 response is
+// written instead, without leaking the error. See [WithETags] to let the clients cache the file.
+// The file is not read for HEAD requests, only its headers are written.
+func FileHandler(fsys fs.FS, name string, status int) ErrorHandlerFunc {
+	if fsys == nil {
+		panic("centra: fsys must not be nil")
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		f, openErr := fsys.Open(name)
+		if openErr != nil {
+			writePlainInternalServerError(w, r)
+			return
+		}
+		defer f.Close()
+
+		info, statErr := f.Stat()
+		if statErr != nil || !info.Mode().IsRegular() {
+			writePlainInternalServerError(w, r)
+			return
+		}
+
+		if m := getDispatchInfo(r).mux; m != nil && m.cfg.etags {
+			body, readErr := io.ReadAll(f)
+			if readErr != nil {
+				writePlainInternalServerError(w, r)
+				return
+			}
+			if notModified(w, r, body) {
+				return
+			}
+			writeResponse(w, r, resolveStatus(r, status), contentType, body)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		setContentLength(w, info.Size())
+
+		w.WriteHeader(resolveStatus(r, status))
+
+		if r.Method != http.MethodHead {
+			io.Copy(reportingWriter{w}, f)
+		}
+	}
+}
+
+// Returns an error handler that copies the reader returned by body for the error being handled
+// to the response, with Content-Type contentType and status code status, for the bodies that are
+// too large to be held in memory or not known up front, like the error document of an upstream
+// service:
+//
+//	errMux.Handle(ErrUpstream, centra.ReaderHandler(http.StatusBadGateway, "text/html", func(err error) io.Reader {
+//		var upstream *UpstreamError
+//		errors.As(err, &upstream)
+//		return upstream.Body
+//	}))
+//
+// Content-Length is not set, since the size of the body is unknown, and the reader is closed once
+// copied if it implements io.Closer, even for HEAD requests whose body is not written. A nil
+// reader writes no body. A status of 0 means 500, if a status has been hinted with
+// [ErrorStatus], it's written instead.
+func ReaderHandler(status int, contentType string, body func(err error) io.Reader) ErrorHandlerFunc {
+	if body == nil {
+		panic("centra: body must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		reader := body(err)
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Del("Content-Length")
+
+		w.WriteHeader(resolveStatus(r, status))
+
+		if reader != nil && r.Method != http.MethodHead {
+			io.Copy(reportingWriter{w}, reader)
+		}
+	}
+}
+
+// Marshals v as JSON and writes it to w with Content-Type "application/json", its Content-Length
+// and status code status.
+//
+// If v cannot be marshaled, for example because it contains a func, a minimal JSON document is
+// written instead with status code 500, so the response is never malformed, and the marshaling
+// error is returned:
+//
+//	{"error":"internal server error"}
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	return writeJSON(w, nil, status, "application/json", v)
+}
+
+// writeJSON is WriteJSON with a custom Content-Type.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, contentType string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		reportWriteError(w, err)
+		writeResponse(w, r, http.StatusInternalServerError, "application/json", marshalFailedBody)
+		return err
+	}
+
+	writeResponse(w, r, status, contentType, body)
+	return nil
+}
+
+// body written by writeJSON when the value cannot be marshaled
+var marshalFailedBody = []byte(`{"error":"internal server error"}`)
+
+// Returns an error handler for rate limiting errors, it sets the Retry-After header to the
+// delay returned by retry for the error being handled, in seconds rounded up, and writes the
+// status text of status with Content-Type "text/plain; charset=utf-8" and status code status.
+//
+// retry usually extracts the delay from a typed error with errors.As, a delay less than or equal
+// to 0 is written as "0". A status of 0 means 429, if a status has been hinted with
+// [ErrorStatus], it's written instead.
+func RetryAfterHandler(status int, retry func(error) time.Duration) ErrorHandlerFunc {
+	if retry == nil {
+		panic("centra: retry must not be nil")
+	}
+
+	return retryHandler(status, func(r *http.Request, err error) time.Duration {
+		return retry(err)
+	})
+}
+
+// Same as [RetryAfterHandler], but the client is told to retry at the time returned by at for
+// the error being handled, for example the end of the rate limiting window, the delay being
+// computed from the clock set with [WithClock].
+func RetryAtHandler(status int, at func(error) time.Time) ErrorHandlerFunc {
+	if at == nil {
+		panic("centra: at must not be nil")
+	}
+
+	return retryHandler(status, func(r *http.Request, err error) time.Duration {
+		return at(err).Sub(Now(r))
+	})
+}
+
+// retryHandler returns the handler of RetryAfterHandler, with the delay computed by retry.
+func retryHandler(status int, retry func(r *http.Request, err error) time.Duration) ErrorHandlerFunc {
+	if status == 0 {
+		status = http.StatusTooManyRequests
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		status := resolveStatus(r, status)
+
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfterSeconds(retry(r, err)), 10))
+
+		writeResponse(w, r, status, "text/plain", []byte(statusText(r, status)))
+	}
+}
+
+// retryAfterSeconds returns d in seconds rounded up, or 0 if d is negative.
+func retryAfterSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Returns an error handler that writes the status text of status as HTML, as JSON or as plain
+// text, whichever is preferred by the request's Accept header, with status code status:
+//
+//   - "text/html; charset=utf-8": "<h1>Not Found</h1>"
+//   - "application/json": {"error":"not found"}
+//   - "text/plain; charset=utf-8": "Not Found", see [TextHandler]
+//
+// HTML is written if the client accepts several of them equally or none of them. A status of 0
+// means 500, if a status has been hinted with [ErrorStatus], it's written instead. If
+// [WithVerboseErrors] is enabled, the message of err is included, in a paragraph, as "detail" or
+// after the status text.
+func NegotiatingHandler(status int) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		status := resolveStatus(r, status)
+
+		switch PreferredMediaType(r.Header.Get("Accept"), negotiatedMediaTypes) {
+		case "application/json":
+			writeJSONStatus(w, r, err, status)
+		case "text/plain":
+			writeTextStatus(w, r, err, status)
+		default:
+			writeHTMLStatus(w, r, err, status)
+		}
+	}
+}
+
+// Sentinel error for the resources that don't exist, handled with [NotFoundHandler] once
+// registered, nothing registers it by default:
+//
+//	errMux.Handle(centra.ErrNotFound, centra.NotFoundHandler("<h1>Page not found</h1>"))
+//
+//	// in the handlers
+//	centra.Error(w, r, centra.ErrNotFound)
+var ErrNotFound = errors.New("centra: not found")
+
+// Returns an error handler that writes body with status code 404, and Content-Type detected from
+// body with http.DetectContentType. If body is empty, the status text is written by
+// [NegotiatingHandler] instead. If a status has been hinted with [ErrorStatus], it's written
+// instead of 404.
+func NotFoundHandler(body string) ErrorHandlerFunc {
+	if body == "" {
+		return NegotiatingHandler(http.StatusNotFound)
+	}
+
+	b := []byte(body)
+	contentType := http.DetectContentType(b)
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		writeResponse(w, r, resolveStatus(r, http.StatusNotFound), contentType, b)
+	}
+}
+
+// Sentinel error for the requests whose method is not supported by the resource, handled with
+// [MethodNotAllowedHandler] once registered, nothing registers it by default:
+//
+//	errMux.Handle(centra.ErrMethodNotAllowed, centra.MethodNotAllowedHandler(http.MethodGet, http.MethodHead))
+var ErrMethodNotAllowed = errors.New("centra: method not allowed")
+
+// Returns an error handler that sets the Allow header, required by HTTP for the 405 responses, to
+// the methods in allowed, in uppercase and separated by commas, as in "GET, HEAD", and writes 405
+// Method Not Allowed, rendered by [NegotiatingHandler]. An empty allowed writes an empty Allow
+// header, meaning the resource doesn't allow any method.
+func MethodNotAllowedHandler(allowed ...string) ErrorHandlerFunc {
+	methods := make([]string, len(allowed))
+	for i, method := range allowed {
+		if method == "" {
+			panic("centra: allowed methods must not be empty")
+		}
+		methods[i] = strings.ToUpper(method)
+	}
+	allow := strings.Join(methods, ", ")
+	notAllowed := NegotiatingHandler(http.StatusMethodNotAllowed)
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Allow", allow)
+		notAllowed(w, r, err)
+	}
+}
+
+// Matcher error, meant to be registered with [Mux.HandleMatch], that matches the errors that have
+// a *http.MaxBytesError in their chain, returned by reading the body of a request limited with
+// http.MaxBytesReader beyond its limit, typically along with [MaxBytesHandler]:
+//
+//	errMux.HandleMatch(centra.MaxBytesErrors, centra.MaxBytesHandler())
+var MaxBytesErrors error = maxBytesErrors{}
+
+type maxBytesErrors struct{}
+
+func (maxBytesErrors) Error() string {
+	return "centra: request body too large errors"
+}
+
+func (maxBytesErrors) Is(err error) bool {
+	_, ok := err.(*http.MaxBytesError)
+	return ok
+}
+
+// Returns an error handler for the request bodies larger than allowed by http.MaxBytesReader, it
+// writes 413 Request Entity Too Large, rendered by [NegotiatingHandler]. If [WithVerboseErrors]
+// is enabled, the detail is the limit exceeded, as in "request body larger than 1048576 bytes",
+// instead of the message of the error.
+//
+// The errors without a *http.MaxBytesError in their chain are handled by the UnknownHandler.
+func MaxBytesHandler() ErrorHandlerFunc {
+	tooLarge := NegotiatingHandler(http.StatusRequestEntityTooLarge)
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var maxErr *http.MaxBytesError
+		if !errors.As(err, &maxErr) {
+			callUnknown(w, r, err)
+			return
+		}
+		tooLarge(w, r, fmt.Errorf("request body larger than %d bytes", maxErr.Limit))
+	}
+}
+
+// Returns an error handler that writes only the status code code, without body, nor Content-Type
+// and Content-Length headers, for the statuses a body is inappropriate for, like 304 Not
+// Modified. A code of 0 means 500, if a status has been hinted with [ErrorStatus], it's written
+// instead.
+func StatusOnlyHandler(code int) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(resolveStatus(r, code))
+	}
+}
+
+// Error handler that writes nothing, making explicit that an error is swallowed on purpose, for
+// example to register it for an error whose response is written elsewhere. The status code 200 is
+// sent if nothing else writes the response, see [Mux.Ignore] for a bare status instead.
+var NoopHandler ErrorHandlerFunc = func(w http.ResponseWriter, r *http.Request, err error) {}
+
+// writeHTMLStatus writes the status text of status as an HTML heading, followed by the detail of
+// err if it's enabled.
+func writeHTMLStatus(w http.ResponseWriter, r *http.Request, err error, status int) {
+	page := "<h1>" + statusText(r, status) + "</h1>"
+	if detail, ok := errorDetail(r, err); ok {
+		page += "<p>" + html.EscapeString(detail) + "</p>"
+	}
+	writeResponse(w, r, status, "text/html", []byte(page))
+}
+
+// writeTextStatus writes the status text of status as plain text, followed by the detail of err if
+// it's enabled.
+func writeTextStatus(w http.ResponseWriter, r *http.Request, err error, status int) {
+	text := statusText(r, status)
+	if detail, ok := errorDetail(r, err); ok {
+		text += ": " + detail
+	}
+	writeResponse(w, r, status, "text/plain", []byte(text))
+}
+
+// writeJSONStatus writes the status text of status in lowercase as "error", along with the detail
+// of err if it's enabled.
+func writeJSONStatus(w http.ResponseWriter, r *http.Request, err error, status int) {
+	body := map[string]string{"error": strings.ToLower(http.StatusText(status))}
+	if detail, ok := errorDetail(r, err); ok {
+		body["detail"] = detail
+	}
+	b, _ := json.Marshal(body)
+	writeResponse(w, r, status, "application/json", b)
+}
+
+// media types offered by NegotiatingHandler, in order of preference
+var negotiatedMediaTypes = []string{"text/html", "application/json", "text/plain"}
+
+// Returns an error handler that writes the status text of status as plain text, for CLI clients
+// and curl users, with Content-Type "text/plain; charset=utf-8" and status code status:
+//
+//	Not Found
+//
+// A status of 0 means 500, if a status has been hinted with [ErrorStatus], it's written instead.
+// If [WithVerboseErrors] is enabled, the message of err is written after the status text, as in
+// "Not Found: user 42 not found".
+func TextHandler(status int) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		writeTextStatus(w, r, err, resolveStatus(r, status))
+	}
+}
+
+// Implemented by validation errors, used by [ValidationHandler].
+type FieldsError interface {
+	error
+
+	// Returns the validation messages keyed by the name of the invalid field.
+	Fields() map[string]string
+}
+
+// Returns an error handler for validation errors, it extracts the first [FieldsError] in the
+// chain of the error being handled with errors.As, and writes its fields as JSON with status code
+// status:
+//
+//	{"errors":{"email":"must be a valid email"}}
+//
+// If the error has no FieldsError in its chain, it's handled by the UnknownHandler instead of
+// writing an empty object. A status of 0 means 422, if a status has been hinted with
+// [ErrorStatus], it's written instead.
+func ValidationHandler(status int) ErrorHandlerFunc {
+	if status == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		var fe FieldsError
+		if !errors.As(err, &fe) {
+			callUnknown(w, r, err)
+			return
+		}
+
+		body := struct {
+			Errors map[string]string `json:"errors"`
+		}{Errors: fe.Fields()}
+		if body.Errors == nil {
+			body.Errors = map[string]string{}
+		}
+
+		// writeJSON writes its own fallback if body cannot be marshaled
+		writeJSON(w, r, resolveStatus(r, status), "application/json", body)
+	}
+}
+
+// Returns an error handler that calls handlers in order with the same arguments. All of them are
+// called, so the ones meant for side effects, like logging or setting headers, should come first,
+// and the ones that may write the response should use [Written] to avoid writing it if a
+// previous handler already did.
+func Chain(handlers ...ErrorHandlerFunc) ErrorHandlerFunc {
+	for _, h := range handlers {
+		if h == nil {
+			panic("centra: handler must not be nil")
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		// makes Written work when the chain is not called by Error
+		w = wrapWriter(w)
+
+		for _, h := range handlers {
+			h(w, r, err)
+		}
+	}
+}
+
+// Returns an error handler that calls h.ServeHTTP(w, r), ignoring the error, so existing
+// http.Handler can be reused as error pages, for example a file server serving a static 404 page.
+// h can retrieve the error with [CurrentError].
+func HandlerFromHTTP(h http.Handler) ErrorHandlerFunc {
+	if h == nil {
+		panic("centra: handler must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		h.ServeHTTP(w, r)
+	}
+}
+
+// Returns an error handler that redirects the client to location with code, which must be a 3xx
+// status code, writing the status text as body, for example to redirect to a login page the
+// requests failing with a not-authenticated error.
+func RedirectHandler(code int, location string) ErrorHandlerFunc {
+	if location == "" {
+		panic("centra: location must not be empty")
+	}
+	return RedirectFunc(code, func(r *http.Request) string {
+		return location
+	})
+}
+
+// Same as [RedirectHandler], but the location is computed by fn for every request, for example to
+// include a return-to query param. If fn returns an empty location, the error is handled by the
+// UnknownHandler.
+func RedirectFunc(code int, fn func(r *http.Request) string) ErrorHandlerFunc {
+	if code < 300 || code > 399 {
+		panic("centra: invalid redirect status code " + strconv.Itoa(code))
+	}
+
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		location := fn(r)
+		if location == "" {
+			callUnknown(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", location)
+		writeResponse(w, r, code, "text/plain", []byte(statusText(r, code)))
+	}
+}
+
+// callUnknown calls the UnknownHandler of the Mux handling r, used by the built-in handlers that
+// cannot handle err. If r is not being handled by a Mux, DefaultUnknown is called.
+func callUnknown(w http.ResponseWriter, r *http.Request, err error) {
+	m := getDispatchInfo(r).mux
+	if m == nil {
+		if DefaultUnknown != nil {
+			DefaultUnknown(w, r, err)
+		} else {
+			DefaultUnknownHandler(w, r, err)
+		}
+		return
+	}
+	owner, _, h := m.resolve("", nil)
+	owner.selectUnknown(r, h).handler(w, r, err)
+}
+
+// Returns the cause of the cancellation of the context of r, as reported by context.Cause, if err
+// is a context.Canceled or context.DeadlineExceeded error and the context has been canceled with
+// a cause, like the ones created with context.WithCancelCause, so the handlers can report the
+// actual reason of the cancellation, like "quota exceeded", instead of "context canceled".
+// Returns err otherwise.
+//
+// The built-in handlers use it for the messages included by [WithVerboseErrors].
+func CauseOf(r *http.Request, err error) error {
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	ctx := r.Context()
+	if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+		return cause
+	}
+	return err
+}
+
+// errorDetail returns the message of err, or of its cause, see CauseOf, followed by the
+// annotations of the context of r, see Annotate, sanitized and truncated as configured with
+// WithSanitizer and WithMaxDetailLength, if the Mux handling r was created with
+// WithVerboseErrors(true), reporting false otherwise or if err is nil.
+func errorDetail(r *http.Request, err error) (string, bool) {
+	m := getDispatchInfo(r).mux
+	if m == nil || !m.cfg.verbose || err == nil {
+		return "", false
+	}
+	detail := CauseOf(r, err).Error()
+	if annotations := Annotations(r.Context()); len(annotations) != 0 {
+		detail += " (" + formatAnnotations(annotations) + ")"
+	}
+	return truncate(sanitize(r, detail), m.cfg.maxDetailLength), true
+}
+
+// sanitize returns message passed through the sanitizer of the Mux handling r, see WithSanitizer,
+// or message itself if there is none.
+func sanitize(r *http.Request, message string) string {
+	if m := getDispatchInfo(r).mux; m != nil && m.cfg.sanitizer != nil {
+		return m.cfg.sanitizer(message)
+	}
+	return message
+}
+
+// truncate returns s truncated to n bytes, ending with "..." and without splitting a UTF-8
+// encoded rune, or s itself if it's not longer or n is 0.
+func truncate(s string, n int) string {
+	const ellipsis = "..."
+	if n == 0 || len(s) <= n {
+		return s
+	}
+	if n <= len(ellipsis) {
+		return ellipsis[:n]
+	}
+	end := n - len(ellipsis)
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + ellipsis
+}
+
+// resolveStatus returns the status hinted with ErrorStatus if any, otherwise status, defaulting
+// to 500 if it's 0.
+func resolveStatus(r *http.Request, status int) int {
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	return statusOr(r, status)
+}
+
+// writeResponse sets Content-Type and Content-Length headers, and writes status and body to w.
+// All the built-in handlers write their responses through it, so both headers are always set
+// before WriteHeader, some proxies and HTTP/1.0 clients misbehave without Content-Length. See
+// setContentLength for the exception.
+//
+// The body is not written if r is a HEAD request, since its response must not have one, the
+// headers still describe it. The body is always written if r is nil.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", withCharset(r, contentType))
+	setContentLength(w, int64(len(body)))
+
+	w.WriteHeader(status)
+
+	if r != nil && r.Method == http.MethodHead {
+		return
+	}
+	MustWrite(w, body)
+}
+
+// withCharset returns contentType with the charset set with WithCharset for the Mux handling r,
+// utf-8 by default, if it's "text/html" or "text/plain" without a charset parameter.
+func withCharset(r *http.Request, contentType string) string {
+	mediaType, params, _ := strings.Cut(contentType, ";")
+	if mediaType != "text/html" && mediaType != "text/plain" || strings.Contains(params, "charset=") {
+		return contentType
+	}
+
+	if r != nil {
+		if m := getDispatchInfo(r).mux; m != nil && m.cfg.charset != "" {
+			return contentType + "; charset=" + m.cfg.charset
+		}
+	}
+	// constants for the default charset, so the responses don't allocate a Content-Type
+	switch contentType {
+	case "text/html":
+		return "text/html; charset=utf-8"
+	case "text/plain":
+		return "text/plain; charset=utf-8"
+	}
+	return contentType + "; charset=utf-8"
+}
+
+// notModified sets the weak ETag of body if the Mux handling r was created with WithETags, and
+// writes a 304 Not Modified response and reports true if the If-None-Match header of r matches it.
+func notModified(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	m := getDispatchInfo(r).mux
+	if m == nil || !m.cfg.etags {
+		return false
+	}
+
+	h := fnv.New64a()
+	h.Write(body)
+	etag := fmt.Sprintf(`W/"%016x"`, h.Sum64())
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(strings.Join(r.Header.Values("If-None-Match"), ","), ",") {
+		candidate = strings.TrimSpace(candidate)
+		// weak comparison, see RFC 9110 section 13.1.2
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag[2:] {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// shed writes a cheap 503 Service Unavailable response and reports true if the Mux handling r was
+// created with WithDeadlineGuard and the deadline of the context of r is too close to render the
+// response of the built-in handlers.
+func shed(w http.ResponseWriter, r *http.Request) bool {
+	m := getDispatchInfo(r).mux
+	if m == nil || m.cfg.deadlineGuard == 0 {
+		return false
+	}
+	deadline, ok := r.Context().Deadline()
+	if !ok || deadline.Sub(Now(r)) >= m.cfg.deadlineGuard {
+		return false
+	}
+	writeResponse(w, r, http.StatusServiceUnavailable, "text/plain",
+		[]byte(http.StatusText(http.StatusServiceUnavailable)))
+	return true
+}
+
+// setContentLength sets the Content-Length header of w to n, unless a Content-Encoding has already
+// been set, since the compression middleware setting it changes the length of the body, and the
+// clients would see it truncated.
+func setContentLength(w http.ResponseWriter, n int64) {
+	if w.Header().Get("Content-Encoding") != "" {
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+}
+
+// writePlainInternalServerError is the last resort response of built-in handlers that failed to
+// render their response.
+func writePlainInternalServerError(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, http.StatusInternalServerError, "text/plain",
+		[]byte(http.StatusText(http.StatusInternalServerError)))
+}
@@ -0,0 +1,1212 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestTemplateHandler(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(
+		`{{define "ok"}}<h1>{{.Status}}</h1><p>{{.Message}}</p><p>{{.Path}}</p>{{end}}` +
+			`{{define "fail"}}<h1>{{.Status}}</h1>{{.Missing}}{{end}}`,
+	))
+
+	testCases := map[string]struct {
+		Name string
+		Err  error
+
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"Render": {
+			Name: "ok",
+			Err:  errString("<not found>"),
+
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>404</h1><p>&lt;not found&gt;</p><p>/users/1</p>",
+		},
+		"Render_Nil_Error": {
+			Name: "ok",
+			Err:  nil,
+
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>404</h1><p>Not Found</p><p>/users/1</p>",
+		},
+		"Execution_Fails": {
+			Name: "fail",
+			Err:  errString("err"),
+
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Internal Server Error",
+		},
+		"Template_Not_Found": {
+			Name: "missing",
+			Err:  errString("err"),
+
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Internal Server Error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/users/1", nil)
+			recorder := httptest.NewRecorder()
+
+			TemplateHandler(tmpl, tc.Name, http.StatusNotFound)(recorder, req, tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	testCases := map[string]struct {
+		Value any
+
+		ExpectedErr           bool
+		ExpectedStatus        int
+		ExpectedContentType   string
+		ExpectedContentLength string
+		ExpectedBuf           string
+	}{
+		"Marshal": {
+			Value: map[string]string{"error": "not found"},
+
+			ExpectedStatus:        http.StatusNotFound,
+			ExpectedContentType:   "application/json",
+			ExpectedContentLength: "21",
+			ExpectedBuf:           `{"error":"not found"}`,
+		},
+		"Marshal_Fails": {
+			Value: map[string]any{"fn": func() {}},
+
+			ExpectedErr:           true,
+			ExpectedStatus:        http.StatusInternalServerError,
+			ExpectedContentType:   "application/json",
+			ExpectedContentLength: "33",
+			ExpectedBuf:           `{"error":"internal server error"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			err := WriteJSON(recorder, http.StatusNotFound, tc.Value)
+			if tc.ExpectedErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.ExpectedErr, err)
+			}
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if cl := recorder.Header().Get("Content-Length"); tc.ExpectedContentLength != cl {
+				t.Fatalf("expected Content-Length %s, got %s", tc.ExpectedContentLength, cl)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteJSONMarshalFailsThroughServer(t *testing.T) {
+	errMux := NewMux()
+	errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		WriteJSON(w, http.StatusNotFound, map[string]any{"fn": func() {}})
+	})
+
+	var serverLog bytes.Buffer
+	server := httptest.NewUnstartedServer(errMux.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errString("A")
+	}))
+	server.Config.ErrorLog = log.New(&serverLog, "", 0)
+	server.Start()
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	buf, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, res.StatusCode)
+	}
+	if expected := `{"error":"internal server error"}`; expected != string(buf) {
+		t.Fatalf("expected %s, got %s", expected, buf)
+	}
+	if serverLog.Len() != 0 {
+		t.Fatalf("expected no server log, got %s", serverLog.String())
+	}
+}
+
+type errRateLimited struct {
+	RetryIn time.Duration
+}
+
+func (e errRateLimited) Error() string {
+	return "rate limited"
+}
+
+func TestRetryAfterHandler(t *testing.T) {
+	retry := func(err error) time.Duration {
+		var rl errRateLimited
+		if errors.As(err, &rl) {
+			return rl.RetryIn
+		}
+		return time.Minute
+	}
+
+	testCases := map[string]struct {
+		Status int
+		Err    error
+
+		ExpectedStatus     int
+		ExpectedRetryAfter string
+	}{
+		"Default_Status": {
+			Err: errRateLimited{RetryIn: 30 * time.Second},
+
+			ExpectedStatus:     http.StatusTooManyRequests,
+			ExpectedRetryAfter: "30",
+		},
+		"Rounded_Up": {
+			Err: fmt.Errorf("wrapped: %w", errRateLimited{RetryIn: 1500 * time.Millisecond}),
+
+			ExpectedStatus:     http.StatusTooManyRequests,
+			ExpectedRetryAfter: "2",
+		},
+		"Negative": {
+			Err: errRateLimited{RetryIn: -time.Second},
+
+			ExpectedStatus:     http.StatusTooManyRequests,
+			ExpectedRetryAfter: "0",
+		},
+		"Custom_Status": {
+			Status: http.StatusServiceUnavailable,
+			Err:    errString("err"),
+
+			ExpectedStatus:     http.StatusServiceUnavailable,
+			ExpectedRetryAfter: "60",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			RetryAfterHandler(tc.Status, retry)(recorder, req, tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ra := recorder.Header().Get("Retry-After"); tc.ExpectedRetryAfter != ra {
+				t.Fatalf("expected Retry-After %s, got %s", tc.ExpectedRetryAfter, ra)
+			}
+			if body := http.StatusText(tc.ExpectedStatus); body != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", body, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRetryAtHandler(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		At time.Time
+
+		ExpectedRetryAfter string
+	}{
+		"Future": {
+			At:                 now.Add(90 * time.Second),
+			ExpectedRetryAfter: "90",
+		},
+		"Rounded_Up": {
+			At:                 now.Add(2500 * time.Millisecond),
+			ExpectedRetryAfter: "3",
+		},
+		"Past": {
+			At:                 now.Add(-time.Minute),
+			ExpectedRetryAfter: "0",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithClock(func() time.Time { return now }))
+			errMux.Handle(errString("A"), RetryAtHandler(0, func(error) time.Time { return tc.At }))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if recorder.Code != http.StatusTooManyRequests {
+				t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, recorder.Code)
+			}
+			if ra := recorder.Header().Get("Retry-After"); tc.ExpectedRetryAfter != ra {
+				t.Fatalf("expected Retry-After %s, got %s", tc.ExpectedRetryAfter, ra)
+			}
+		})
+	}
+}
+
+func TestNegotiatingHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Accept string
+
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"No_Accept": {
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"JSON": {
+			Accept:              "application/json",
+			ExpectedContentType: "application/json",
+			ExpectedBuf:         `{"error":"not found"}`,
+		},
+		"HTML_Preferred": {
+			Accept:              "application/json;q=0.5, text/html",
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"Text": {
+			Accept:              "text/plain",
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Not Found",
+		},
+		"HTML_Preferred_Over_Text": {
+			Accept:              "text/*",
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"None_Acceptable": {
+			Accept:              "image/png",
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/", nil)
+			req.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+
+			NegotiatingHandler(http.StatusNotFound)(recorder, req, errString("err"))
+
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestTextHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Status  int
+		Verbose bool
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Status": {
+			Status:         http.StatusNotFound,
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "Not Found",
+		},
+		"Default_Status": {
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "Internal Server Error",
+		},
+		"Verbose": {
+			Status:         http.StatusNotFound,
+			Verbose:        true,
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "Not Found: user 42 not found",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(tc.Verbose), WithUnknownHandler(TextHandler(tc.Status)))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("user 42 not found"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+				t.Fatalf("expected Content-Type %s, got %s", "text/plain; charset=utf-8", ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			assertResponseHeaders(t, recorder)
+		})
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Body string
+		Err  error
+
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"HTML": {
+			Body:                "<h1>Page not found</h1>",
+			Err:                 ErrNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Page not found</h1>",
+		},
+		"Text": {
+			Body:                "nothing here",
+			Err:                 fmt.Errorf("loading user: %w", ErrNotFound),
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "nothing here",
+		},
+		"Empty_Body": {
+			Err:                 ErrNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(ErrNotFound, NotFoundHandler(tc.Body))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			assertResponseHeaders(t, recorder)
+		})
+	}
+}
+
+func TestMaxBytesHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Wrapped": {
+			Err:            fmt.Errorf("decoding body: %w", &http.MaxBytesError{Limit: 1024}),
+			ExpectedStatus: http.StatusRequestEntityTooLarge,
+			ExpectedBuf:    "<h1>Request Entity Too Large</h1><p>request body larger than 1024 bytes</p>",
+		},
+		"Read_From_MaxBytesReader": {
+			Err: func() error {
+				body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader("too long")), 4)
+				_, err := io.ReadAll(body)
+				return fmt.Errorf("decoding body: %w", err)
+			}(),
+			ExpectedStatus: http.StatusRequestEntityTooLarge,
+			ExpectedBuf:    "<h1>Request Entity Too Large</h1><p>request body larger than 4 bytes</p>",
+		},
+		"Other": {
+			Err:            errString("other"),
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(true))
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, "unknown")
+			})
+			errMux.HandleMatch(MaxBytesErrors, MaxBytesHandler())
+			// so the errors without a *http.MaxBytesError reach MaxBytesHandler too
+			errMux.Handle(errString("other"), MaxBytesHandler())
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowedHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Allowed []string
+
+		ExpectedAllow []string
+	}{
+		"Methods": {
+			Allowed:       []string{http.MethodGet, http.MethodHead},
+			ExpectedAllow: []string{"GET, HEAD"},
+		},
+		"Lowercase": {
+			Allowed:       []string{"get", "post"},
+			ExpectedAllow: []string{"GET, POST"},
+		},
+		"None": {
+			Allowed:       nil,
+			ExpectedAllow: []string{""},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(ErrMethodNotAllowed, MethodNotAllowedHandler(tc.Allowed...))
+
+			recorder := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/", nil)
+			Error(recorder, SetMux(r, errMux), fmt.Errorf("delete: %w", ErrMethodNotAllowed))
+
+			if recorder.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+			}
+			if allow := recorder.Header().Values("Allow"); !slices.Equal(tc.ExpectedAllow, allow) {
+				t.Fatalf("expected Allow %q, got %q", tc.ExpectedAllow, allow)
+			}
+			if expected := "<h1>Method Not Allowed</h1>"; expected != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestStatusOnlyHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Code int
+
+		ExpectedStatus int
+	}{
+		"Not_Modified": {
+			Code:           http.StatusNotModified,
+			ExpectedStatus: http.StatusNotModified,
+		},
+		"Service_Unavailable": {
+			Code:           http.StatusServiceUnavailable,
+			ExpectedStatus: http.StatusServiceUnavailable,
+		},
+		"Default_Status": {
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			StatusOnlyHandler(tc.Code)(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if recorder.Body.Len() != 0 {
+				t.Fatalf("expected empty body, got %s", recorder.Body.String())
+			}
+			for _, header := range []string{"Content-Type", "Content-Length"} {
+				if v := recorder.Header().Get(header); v != "" {
+					t.Fatalf("expected no %s header, got %q", header, v)
+				}
+			}
+		})
+	}
+}
+
+type errValidation map[string]string
+
+func (e errValidation) Error() string {
+	return "validation failed"
+}
+
+func (e errValidation) Fields() map[string]string {
+	return e
+}
+
+func TestValidationHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Status int
+		Err    error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Default_Status": {
+			Err: errValidation{"email": "must be a valid email"},
+
+			ExpectedStatus: http.StatusUnprocessableEntity,
+			ExpectedBuf:    `{"errors":{"email":"must be a valid email"}}`,
+		},
+		"Wrapped": {
+			Status: http.StatusBadRequest,
+			Err:    fmt.Errorf("signup: %w", errValidation{"name": "required"}),
+
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedBuf:    `{"errors":{"name":"required"}}`,
+		},
+		"Not_Validation_Error": {
+			Err: errString("validation failed"),
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, "unknown")
+			})
+			errMux.Handle(errString("validation failed"), ValidationHandler(tc.Status))
+			HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err errValidation) {
+				ValidationHandler(tc.Status)(w, r, err)
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	logger := func(w http.ResponseWriter, r *http.Request, err error) {
+		calls = append(calls, "log")
+		w.Header().Set("X-Logged", "1")
+	}
+	render := func(body string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			if Written(w) {
+				calls = append(calls, "skip "+body)
+				return
+			}
+			calls = append(calls, "render "+body)
+			io.WriteString(w, body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	Chain(logger, render("1"), render("2"))(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+
+	if expected := "[log render 1 skip 2]"; fmt.Sprint(calls) != expected {
+		t.Fatalf("expected calls %s, got %v", expected, calls)
+	}
+	if recorder.Body.String() != "1" {
+		t.Fatalf("expected 1, got %s", recorder.Body.String())
+	}
+	if recorder.Header().Get("X-Logged") != "1" {
+		t.Fatalf("expected X-Logged header")
+	}
+}
+
+func TestHandlerFromHTTP(t *testing.T) {
+	var page http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "not found page "+r.URL.Path)
+	})
+
+	errMux := NewMux()
+	errMux.Handle(errString("A"), HandlerFromHTTP(page))
+
+	recorder := httptest.NewRecorder()
+	Error(recorder, SetMux(httptest.NewRequest("", "/missing", nil), errMux), errString("A"))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+	if expected := "not found page /missing"; recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+
+		ExpectedStatus   int
+		ExpectedLocation string
+	}{
+		"Static": {
+			Handler: RedirectHandler(http.StatusFound, "/login"),
+
+			ExpectedStatus:   http.StatusFound,
+			ExpectedLocation: "/login",
+		},
+		"Func": {
+			Handler: RedirectFunc(http.StatusSeeOther, func(r *http.Request) string {
+				return "/login?return_to=" + r.URL.Path
+			}),
+
+			ExpectedStatus:   http.StatusSeeOther,
+			ExpectedLocation: "/login?return_to=/account",
+		},
+		"Func_Empty_Location": {
+			Handler: RedirectFunc(http.StatusFound, func(r *http.Request) string {
+				return ""
+			}),
+
+			ExpectedStatus:   http.StatusInternalServerError,
+			ExpectedLocation: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			tc.Handler(recorder, httptest.NewRequest("", "/account", nil), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if location := recorder.Header().Get("Location"); tc.ExpectedLocation != location {
+				t.Fatalf("expected location %s, got %s", tc.ExpectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler_Invalid(t *testing.T) {
+	testCases := map[string]struct {
+		Call func()
+
+		ExpectedPanic string
+	}{
+		"Status_Not_3xx": {
+			Call:          func() { RedirectHandler(http.StatusOK, "/login") },
+			ExpectedPanic: "centra: invalid redirect status code 200",
+		},
+		"Empty_Location": {
+			Call:          func() { RedirectHandler(http.StatusFound, "") },
+			ExpectedPanic: "centra: location must not be empty",
+		},
+		"Nil_Func": {
+			Call:          func() { RedirectFunc(http.StatusFound, nil) },
+			ExpectedPanic: "centra: fn must not be nil",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r != tc.ExpectedPanic {
+					t.Fatalf("expected panic %q, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			tc.Call()
+		})
+	}
+}
+
+func TestFileHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"errors/404.html":  {Data: []byte("<h1>Not Found</h1>")},
+		"errors/style.css": {Data: []byte("h1{color:red}")},
+		"errors":           {Mode: fs.ModeDir},
+	}
+
+	testCases := map[string]struct {
+		Name string
+
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"HTML": {
+			Name: "errors/404.html",
+
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"CSS": {
+			Name: "errors/style.css",
+
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/css; charset=utf-8",
+			ExpectedBuf:         "h1{color:red}",
+		},
+		"Missing": {
+			Name: "errors/500.html",
+
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Internal Server Error",
+		},
+		"Directory": {
+			Name: "errors",
+
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Internal Server Error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			FileHandler(fsys, tc.Name, http.StatusNotFound)(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			assertResponseHeaders(t, recorder)
+		})
+	}
+}
+
+// closeRecorder is an io.ReadCloser recording whether it has been closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReaderHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Method string
+		Body   string
+		Nil    bool
+
+		ExpectedBuf string
+	}{
+		"Stream": {
+			Method:      http.MethodGet,
+			Body:        strings.Repeat("<p>upstream failure</p>", 1000),
+			ExpectedBuf: strings.Repeat("<p>upstream failure</p>", 1000),
+		},
+		"Head": {
+			Method: http.MethodHead,
+			Body:   "<p>upstream failure</p>",
+		},
+		"Nil_Reader": {
+			Method: http.MethodGet,
+			Nil:    true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			body := &closeRecorder{Reader: strings.NewReader(tc.Body)}
+
+			m := NewMux()
+			m.UnknownHandler(ReaderHandler(http.StatusBadGateway, "text/html", func(err error) io.Reader {
+				if tc.Nil {
+					return nil
+				}
+				return body
+			}))
+
+			server := httptest.NewServer(m.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				return errString("A")
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest(tc.Method, server.URL, nil)
+			res, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			buf, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != http.StatusBadGateway {
+				t.Fatalf("expected status %d, got %d", http.StatusBadGateway, res.StatusCode)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != "text/html" {
+				t.Fatalf("expected Content-Type text/html, got %s", ct)
+			}
+			if tc.ExpectedBuf != string(buf) {
+				t.Fatalf("expected %d bytes, got %d bytes", len(tc.ExpectedBuf), len(buf))
+			}
+			if !tc.Nil && !body.closed {
+				t.Fatal("expected the reader to be closed")
+			}
+		})
+	}
+}
+
+// assertResponseHeaders fails the test if the response recorded by recorder doesn't have both
+// Content-Type and Content-Length headers, with Content-Length matching the body.
+func assertResponseHeaders(t *testing.T, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if recorder.Header().Get("Content-Type") == "" {
+		t.Fatalf("expected Content-Type header to be set")
+	}
+	if expected := strconv.Itoa(recorder.Body.Len()); recorder.Header().Get("Content-Length") != expected {
+		t.Fatalf("expected Content-Length %s, got %q", expected, recorder.Header().Get("Content-Length"))
+	}
+}
+
+func TestBuiltinHandlersHeaders(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`<p>{{.Message}}</p>`))
+	fsys := fstest.MapFS{"404.html": {Data: []byte("<h1>Not Found</h1>")}}
+
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+		Err     error
+	}{
+		"DefaultUnknownHandler": {
+			Handler: DefaultUnknownHandler,
+		},
+		"DefaultUnknownJSONHandler": {
+			Handler: DefaultUnknownJSONHandler,
+		},
+		"TemplateHandler": {
+			Handler: TemplateHandler(tmpl, "page", http.StatusNotFound),
+		},
+		"RetryAfterHandler": {
+			Handler: RetryAfterHandler(0, func(error) time.Duration { return time.Second }),
+		},
+		"RetryAtHandler": {
+			Handler: RetryAtHandler(0, func(error) time.Time { return time.Now().Add(time.Second) }),
+		},
+		"FileHandler": {
+			Handler: FileHandler(fsys, "404.html", http.StatusNotFound),
+		},
+		"NegotiatingHandler": {
+			Handler: NegotiatingHandler(http.StatusNotFound),
+		},
+		"MethodNotAllowedHandler": {
+			Handler: MethodNotAllowedHandler(http.MethodGet),
+		},
+		"CodeJSONHandler": {
+			Handler: CodeJSONHandler(http.StatusNotFound),
+		},
+		"TextHandler": {
+			Handler: TextHandler(http.StatusNotFound),
+		},
+		"NotFoundHandler": {
+			Handler: NotFoundHandler("not found"),
+		},
+		"MaxBytesHandler": {
+			Handler: MaxBytesHandler(),
+			Err:     &http.MaxBytesError{Limit: 1024},
+		},
+		"ValidationHandler": {
+			Handler: ValidationHandler(0),
+			Err:     errString("A"),
+		},
+		"ProblemDetailsHandler": {
+			Handler: ProblemDetailsHandler(http.StatusNotFound),
+		},
+		"LocalizedHandler": {
+			Handler: LocalizedHandler(mapLocalizer{}, http.StatusNotFound),
+		},
+		"RedirectHandler": {
+			Handler: RedirectHandler(http.StatusFound, "/login"),
+		},
+		"NetErrorHandler": {
+			Handler: NetErrorHandler(),
+			Err:     timeoutError{},
+		},
+		"FSErrorHandler": {
+			Handler: FSErrorHandler(),
+			Err:     fs.ErrNotExist,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			tc.Handler(recorder, httptest.NewRequest("", "/", nil), tc.Err)
+
+			assertResponseHeaders(t, recorder)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	testCases := map[string]struct {
+		S string
+		N int
+
+		Expected string
+	}{
+		"Unlimited":     {S: "abcdef", N: 0, Expected: "abcdef"},
+		"Shorter":       {S: "abc", N: 5, Expected: "abc"},
+		"Exact":         {S: "abcde", N: 5, Expected: "abcde"},
+		"Truncated":     {S: "abcdefgh", N: 6, Expected: "abc..."},
+		"Tiny_Limit":    {S: "abcdefgh", N: 2, Expected: ".."},
+		"Rune_Boundary": {S: "añandú", N: 5, Expected: "a..."},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := truncate(tc.S, tc.N); tc.Expected != got {
+				t.Fatalf("expected %q, got %q", tc.Expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteResponseContentEncoding(t *testing.T) {
+	fsys := fstest.MapFS{"404.html": {Data: []byte("<h1>Not Found</h1>")}}
+
+	testCases := map[string]struct {
+		Handler         ErrorHandlerFunc
+		ContentEncoding string
+
+		ExpectedContentLength string
+	}{
+		"No_Encoding": {
+			Handler:               NegotiatingHandler(http.StatusNotFound),
+			ExpectedContentLength: "18",
+		},
+		"Gzip": {
+			Handler:               NegotiatingHandler(http.StatusNotFound),
+			ContentEncoding:       "gzip",
+			ExpectedContentLength: "",
+		},
+		"FileHandler_No_Encoding": {
+			Handler:               FileHandler(fsys, "404.html", http.StatusNotFound),
+			ExpectedContentLength: "18",
+		},
+		"FileHandler_Gzip": {
+			Handler:               FileHandler(fsys, "404.html", http.StatusNotFound),
+			ContentEncoding:       "gzip",
+			ExpectedContentLength: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			if tc.ContentEncoding != "" {
+				recorder.Header().Set("Content-Encoding", tc.ContentEncoding)
+			}
+
+			tc.Handler(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+			}
+			if cl := recorder.Header().Get("Content-Length"); tc.ExpectedContentLength != cl {
+				t.Fatalf("expected Content-Length %q, got %q", tc.ExpectedContentLength, cl)
+			}
+		})
+	}
+}
+
+func TestCauseOf(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+
+	testCases := map[string]struct {
+		Cancel func(ctx context.Context) context.Context
+		Err    error
+
+		ExpectedErr    error
+		ExpectedDetail string
+	}{
+		"Canceled_With_Cause": {
+			Cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancelCause(ctx)
+				cancel(errQuota)
+				return ctx
+			},
+			Err:            fmt.Errorf("request aborted: %w", context.Canceled),
+			ExpectedErr:    errQuota,
+			ExpectedDetail: "<h1>Service Unavailable</h1><p>quota exceeded</p>",
+		},
+		"Canceled_Without_Cause": {
+			Cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				return ctx
+			},
+			Err:            context.Canceled,
+			ExpectedErr:    context.Canceled,
+			ExpectedDetail: "<h1>Service Unavailable</h1><p>context canceled</p>",
+		},
+		"Not_Canceled": {
+			Cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancelCause(ctx)
+				cancel(errQuota)
+				return ctx
+			},
+			Err:            errString("A"),
+			ExpectedErr:    errString("A"),
+			ExpectedDetail: "<h1>Service Unavailable</h1><p>A</p>",
+		},
+		"Context_Not_Done": {
+			Cancel:         func(ctx context.Context) context.Context { return ctx },
+			Err:            context.DeadlineExceeded,
+			ExpectedErr:    context.DeadlineExceeded,
+			ExpectedDetail: "<h1>Service Unavailable</h1><p>context deadline exceeded</p>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("", "/", nil)
+			r = r.WithContext(tc.Cancel(r.Context()))
+
+			if err := CauseOf(r, tc.Err); tc.ExpectedErr != err {
+				t.Fatalf("expected %v, got %v", tc.ExpectedErr, err)
+			}
+
+			errMux := NewMux(WithVerboseErrors(true))
+			errMux.UnknownHandler(NegotiatingHandler(http.StatusServiceUnavailable))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(r, errMux), tc.Err)
+
+			if tc.ExpectedDetail != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedDetail, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	fsys := fstest.MapFS{"500.html": {Data: []byte("<h1>Oops</h1>")}}
+
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+		Err     error
+
+		ExpectedStatus        int
+		ExpectedContentLength string
+	}{
+		"ValidationHandler": {
+			Handler:               ValidationHandler(0),
+			Err:                   errValidation{"email": "must be a valid email"},
+			ExpectedStatus:        http.StatusUnprocessableEntity,
+			ExpectedContentLength: "44",
+		},
+		"DefaultUnknownHandler": {
+			Handler:               DefaultUnknownHandler,
+			ExpectedStatus:        http.StatusInternalServerError,
+			ExpectedContentLength: "30",
+		},
+		"TextHandler": {
+			Handler:               TextHandler(http.StatusNotFound),
+			ExpectedStatus:        http.StatusNotFound,
+			ExpectedContentLength: "9",
+		},
+		"FileHandler": {
+			Handler:               FileHandler(fsys, "500.html", http.StatusInternalServerError),
+			ExpectedStatus:        http.StatusInternalServerError,
+			ExpectedContentLength: "13",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.Err
+			if err == nil {
+				err = errString("A")
+			}
+
+			m := NewMux()
+			m.UnknownHandler(tc.Handler)
+
+			w := httptest.NewRecorder()
+			m.ServeError(w, httptest.NewRequest(http.MethodHead, "/", nil), err)
+
+			if w.Code != tc.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, w.Code)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != tc.ExpectedContentLength {
+				t.Fatalf("expected Content-Length %q, got %q", tc.ExpectedContentLength, cl)
+			}
+			if w.Body.Len() != 0 {
+				t.Fatalf("expected empty body, got %q", w.Body.String())
+			}
+		})
+	}
+}
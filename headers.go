@@ -0,0 +1,162 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Returns a middleware, meant to be passed to [Mux.Use], that sets headers on the responses of
+// the handlers it wraps, "Cache-Control: no-store" included unless headers has a Cache-Control,
+// so a CDN never caches a transient error page:
+//
+//	errMux.Use(centra.Headers(map[string]string{"X-Content-Type-Options": "nosniff"}))
+//
+// The headers are set right before the status code is written, and only the ones the wrapped
+// handler has not set are, so its intentional values are never clobbered.
+func Headers(headers map[string]string) func(ErrorHandlerFunc) ErrorHandlerFunc {
+	all := map[string]string{"Cache-Control": "no-store"}
+	for name, value := range headers {
+		all[http.CanonicalHeaderKey(name)] = value
+	}
+
+	return func(next ErrorHandlerFunc) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			next(&headerWriter{ResponseWriter: w, headers: all}, r, err)
+		}
+	}
+}
+
+// Default header name used by [RequestIDHeader].
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// Returns an error handler that sets the header called header, or [DefaultRequestIDHeader] if
+// header is empty, to the request ID stored by an upstream middleware under key in the context of
+// the request, before calling next, so the clients can report the ID of the error responses:
+//
+//	errMux.Handle(ErrNotFound, centra.RequestIDHeader(requestIDKey{}, "", notFoundHandler))
+//
+// The value stored under key must be a string or a fmt.Stringer, a missing, empty or otherwise
+// typed value is ignored, as well as a fmt.Stringer whose String method panics, like a nil
+// pointer. If key is nil, the ID is extracted by the function given to
+// [WithRequestID] instead, see [RequestID].
+func RequestIDHeader(key any, header string, next ErrorHandlerFunc) ErrorHandlerFunc {
+	if next == nil {
+		panic("centra: next must not be nil")
+	}
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var id string
+		if key == nil {
+			id = RequestID(r)
+		} else {
+			switch v := r.Context().Value(key).(type) {
+			case string:
+				id = v
+			case fmt.Stringer:
+				id = stringOf(v)
+			}
+		}
+		if id != "" {
+			w.Header().Set(header, id)
+		}
+		next(w, r, err)
+	}
+}
+
+// stringOf returns s.String(), or an empty string if it panics, like when s is a nil pointer
+// whose String method dereferences it.
+func stringOf(s fmt.Stringer) (str string) {
+	defer func() {
+		if recover() != nil {
+			str = ""
+		}
+	}()
+	return s.String()
+}
+
+// Retryable is implemented by the errors that know whether retrying the request that failed with
+// them is safe, used by [RetryableHeader].
+type Retryable interface {
+	Retryable() bool
+}
+
+// Header set by [RetryableHeader].
+const RetryableHeaderName = "X-Retryable"
+
+// Returns an error handler that sets the [RetryableHeaderName] header to "true" or "false", as
+// reported by the first [Retryable] in the chain of the handled error, before calling next, so the
+// clients get machine-readable guidance on whether retrying the request is safe:
+//
+//	errMux.Handle(ErrConflict, centra.RetryableHeader(conflictHandler))
+//
+// The header is not set if no error in the chain implements Retryable.
+func RetryableHeader(next ErrorHandlerFunc) ErrorHandlerFunc {
+	if next == nil {
+		panic("centra: next must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var re Retryable
+		if errors.As(err, &re) {
+			w.Header().Set(RetryableHeaderName, strconv.FormatBool(re.Retryable()))
+		}
+		next(w, r, err)
+	}
+}
+
+// headerWriter sets headers that have not been set yet before writing the status code.
+type headerWriter struct {
+	http.ResponseWriter
+	headers map[string]string
+	applied bool
+}
+
+func (hw *headerWriter) apply() {
+	if hw.applied {
+		return
+	}
+	hw.applied = true
+
+	h := hw.Header()
+	for name, value := range hw.headers {
+		if _, ok := h[name]; !ok {
+			h.Set(name, value)
+		}
+	}
+}
+
+func (hw *headerWriter) WriteHeader(statusCode int) {
+	if statusCode >= 200 {
+		hw.apply()
+	}
+	hw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (hw *headerWriter) Write(b []byte) (int, error) {
+	hw.apply()
+	return hw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, see [Written].
+func (hw *headerWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
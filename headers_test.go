@@ -0,0 +1,242 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	testCases := map[string]struct {
+		Headers map[string]string
+		Handler ErrorHandlerFunc
+
+		ExpectedHeaders map[string]string
+	}{
+		"Default_Unknown": {
+			Handler: DefaultUnknownHandler,
+
+			ExpectedHeaders: map[string]string{
+				"Cache-Control": "no-store",
+				"Content-Type":  "text/html; charset=utf-8",
+			},
+		},
+		"Extra_Headers": {
+			Headers: map[string]string{"x-content-type-options": "nosniff"},
+			Handler: DefaultUnknownHandler,
+
+			ExpectedHeaders: map[string]string{
+				"Cache-Control":          "no-store",
+				"X-Content-Type-Options": "nosniff",
+			},
+		},
+		"Cache_Control_Overridden": {
+			Headers: map[string]string{"Cache-Control": "no-cache"},
+			Handler: DefaultUnknownHandler,
+
+			ExpectedHeaders: map[string]string{"Cache-Control": "no-cache"},
+		},
+		"Set_By_Handler_Not_Clobbered": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.WriteHeader(http.StatusNotFound)
+			},
+
+			ExpectedHeaders: map[string]string{"Cache-Control": "max-age=60"},
+		},
+		"Only_Write": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Write([]byte("body"))
+			},
+
+			ExpectedHeaders: map[string]string{"Cache-Control": "no-store"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Use(Headers(tc.Headers))
+			errMux.UnknownHandler(tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			for name, expected := range tc.ExpectedHeaders {
+				if got := recorder.Header().Get(name); expected != got {
+					t.Fatalf("expected header %s to be %q, got %q", name, expected, got)
+				}
+			}
+		})
+	}
+}
+
+type requestIDKey struct{}
+
+type stringerID int
+
+func (id stringerID) String() string { return fmt.Sprintf("id-%d", id) }
+
+// pointerStringerID is a fmt.Stringer whose String method panics on a nil pointer.
+type pointerStringerID struct {
+	id string
+}
+
+func (p *pointerStringerID) String() string {
+	return p.id
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	testCases := map[string]struct {
+		Key    any
+		Header string
+		Value  any
+		Opts   []Option
+
+		ExpectedHeader string
+		ExpectedValue  string
+	}{
+		"String": {
+			Key:            requestIDKey{},
+			Value:          "abc-123",
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "abc-123",
+		},
+		"Custom_Header": {
+			Key:            requestIDKey{},
+			Header:         "X-Correlation-Id",
+			Value:          "abc-123",
+			ExpectedHeader: "X-Correlation-Id",
+			ExpectedValue:  "abc-123",
+		},
+		"Stringer": {
+			Key:            requestIDKey{},
+			Value:          stringerID(7),
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "id-7",
+		},
+		"Nil_Stringer": {
+			Key:            requestIDKey{},
+			Value:          (*pointerStringerID)(nil),
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "",
+		},
+		"Missing": {
+			Key:            requestIDKey{},
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "",
+		},
+		"Not_A_String": {
+			Key:            requestIDKey{},
+			Value:          123,
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "",
+		},
+		"Nil_Key_Uses_RequestID": {
+			Opts:           []Option{WithRequestID(func(r *http.Request) string { return "from-option" })},
+			ExpectedHeader: "X-Request-Id",
+			ExpectedValue:  "from-option",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), RequestIDHeader(tc.Key, tc.Header, NegotiatingHandler(http.StatusNotFound)))
+
+			req := httptest.NewRequest("", "/", nil)
+			if tc.Value != nil {
+				req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, tc.Value))
+			}
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, SetMux(req, errMux), errString("A"))
+
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+			}
+			if v := recorder.Header().Get(tc.ExpectedHeader); tc.ExpectedValue != v {
+				t.Fatalf("expected %s %q, got %q", tc.ExpectedHeader, tc.ExpectedValue, v)
+			}
+			if _, ok := recorder.Header()[tc.ExpectedHeader]; tc.ExpectedValue == "" && ok {
+				t.Fatalf("expected no %s header", tc.ExpectedHeader)
+			}
+		})
+	}
+}
+
+type retryableError bool
+
+func (e retryableError) Error() string {
+	return "retryable error"
+}
+
+func (e retryableError) Retryable() bool {
+	return bool(e)
+}
+
+func TestRetryableHeader(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedValue string
+		ExpectedSet   bool
+	}{
+		"Retryable": {
+			Err:           retryableError(true),
+			ExpectedValue: "true",
+			ExpectedSet:   true,
+		},
+		"Not_Retryable": {
+			Err:           retryableError(false),
+			ExpectedValue: "false",
+			ExpectedSet:   true,
+		},
+		"Retryable_Wrapped": {
+			Err:           fmt.Errorf("saving order: %w", retryableError(true)),
+			ExpectedValue: "true",
+			ExpectedSet:   true,
+		},
+		"Not_Implemented": {
+			Err:         errString("A"),
+			ExpectedSet: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(RetryableHeader(NegotiatingHandler(http.StatusConflict)))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if recorder.Code != http.StatusConflict {
+				t.Fatalf("expected status %d, got %d", http.StatusConflict, recorder.Code)
+			}
+			v, ok := recorder.Header()[RetryableHeaderName]
+			if tc.ExpectedSet != ok {
+				t.Fatalf("expected %s set %t, got %v", RetryableHeaderName, tc.ExpectedSet, v)
+			}
+			if ok && tc.ExpectedValue != v[0] {
+				t.Fatalf("expected %s %q, got %q", RetryableHeaderName, tc.ExpectedValue, v[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale used by [LocalizedHandler] when none of the languages accepted by the client has a
+// message. Must be set before any request is handled.
+var DefaultLocale = "en"
+
+// Localizer resolves localized messages, used by [LocalizedHandler].
+type Localizer interface {
+	// Returns the message identified by key in the language lang, or an empty string if there is
+	// no such message.
+	Message(lang, key string) string
+}
+
+// Implemented by errors that want a localized message, used by [LocalizedHandler].
+type MessageKeyer interface {
+	// Returns the key of the message that describes the error.
+	MessageKey() string
+}
+
+// Returns an error handler that writes a message localized to the languages accepted by the
+// client, as found in the Accept-Language header, with Content-Type "text/plain; charset=utf-8"
+// and status code status.
+//
+// The key of the message is obtained from the first error in err's chain that implements
+// [MessageKeyer], if there is none, the status text of status is used as the key. Languages are
+// tried in order of preference, a language with a region, like "en-US", is tried before its base
+// language "en". If no accepted language has the message, [DefaultLocale] is tried, and if it
+// doesn't have it either, the status text is written.
+//
+// If a status has been hinted with [ErrorStatus], it's written instead of status, a status of 0
+// means 500.
+func LocalizedHandler(bundle Localizer, status int) ErrorHandlerFunc {
+	if bundle == nil {
+		panic("centra: bundle must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		status := resolveStatus(r, status)
+
+		key := http.StatusText(status)
+		var keyer MessageKeyer
+		if errors.As(err, &keyer) {
+			key = keyer.MessageKey()
+		}
+
+		lang, message := "", ""
+		for _, l := range append(acceptedLanguages(r.Header.Get("Accept-Language")), DefaultLocale) {
+			if m := bundle.Message(l, key); m != "" {
+				lang, message = l, m
+				break
+			}
+		}
+		if message == "" {
+			message = http.StatusText(status)
+		}
+
+		if lang != "" {
+			w.Header().Set("Content-Language", lang)
+		}
+
+		writeResponse(w, r, status, "text/plain", []byte(message))
+	}
+}
+
+// statusText returns the status text of code for r, localized by the function set with
+// WithStatusText for the languages accepted by the client, in order of preference, then for
+// DefaultLocale, falling back to http.StatusText.
+func statusText(r *http.Request, code int) string {
+	if m := getDispatchInfo(r).mux; m != nil && m.cfg.statusText != nil {
+		for _, lang := range append(acceptedLanguages(r.Header.Get("Accept-Language")), DefaultLocale) {
+			if text := m.cfg.statusText(lang, code); text != "" {
+				return text
+			}
+		}
+	}
+	return http.StatusText(code)
+}
+
+// acceptedLanguages parses an Accept-Language header and returns the accepted languages in order
+// of preference, every language with a region is followed by its base language.
+func acceptedLanguages(header string) []string {
+	type langQ struct {
+		lang string
+		q    float64
+	}
+
+	var langs []langQ
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+
+		langs = append(langs, langQ{lang: lang, q: q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	result := make([]string, 0, len(langs))
+	for _, l := range langs {
+		result = append(result, l.lang)
+		if base, _, ok := strings.Cut(l.lang, "-"); ok {
+			result = append(result, base)
+		}
+	}
+	return result
+}
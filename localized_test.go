@@ -0,0 +1,135 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mapLocalizer map[string]map[string]string
+
+func (m mapLocalizer) Message(lang, key string) string {
+	return m[lang][key]
+}
+
+type errKeyed string
+
+func (e errKeyed) Error() string {
+	return string(e)
+}
+
+func (e errKeyed) MessageKey() string {
+	return string(e)
+}
+
+func TestLocalizedHandler(t *testing.T) {
+	bundle := mapLocalizer{
+		"en": {
+			"user.not_found":        "User not found",
+			"Internal Server Error": "Something went wrong",
+		},
+		"es": {
+			"user.not_found": "Usuario no encontrado",
+		},
+		"pt-BR": {
+			"user.not_found": "Usuário não encontrado",
+		},
+	}
+
+	testCases := map[string]struct {
+		AcceptLanguage string
+		Err            error
+
+		ExpectedLanguage string
+		ExpectedBuf      string
+	}{
+		"Preferred_Language": {
+			AcceptLanguage: "es, en;q=0.5",
+			Err:            errKeyed("user.not_found"),
+
+			ExpectedLanguage: "es",
+			ExpectedBuf:      "Usuario no encontrado",
+		},
+		"Quality_Order": {
+			AcceptLanguage: "en;q=0.2, es;q=0.9",
+			Err:            errKeyed("user.not_found"),
+
+			ExpectedLanguage: "es",
+			ExpectedBuf:      "Usuario no encontrado",
+		},
+		"Region": {
+			AcceptLanguage: "pt-BR",
+			Err:            fmt.Errorf("wrapped: %w", errKeyed("user.not_found")),
+
+			ExpectedLanguage: "pt-BR",
+			ExpectedBuf:      "Usuário não encontrado",
+		},
+		"Region_Falls_Back_To_Base": {
+			AcceptLanguage: "es-AR",
+			Err:            errKeyed("user.not_found"),
+
+			ExpectedLanguage: "es",
+			ExpectedBuf:      "Usuario no encontrado",
+		},
+		"No_Match_Default_Locale": {
+			AcceptLanguage: "fr, de;q=0.5",
+			Err:            errKeyed("user.not_found"),
+
+			ExpectedLanguage: "en",
+			ExpectedBuf:      "User not found",
+		},
+		"Zero_Quality_Ignored": {
+			AcceptLanguage: "es;q=0",
+			Err:            errKeyed("user.not_found"),
+
+			ExpectedLanguage: "en",
+			ExpectedBuf:      "User not found",
+		},
+		"No_Key_Uses_Status_Text": {
+			AcceptLanguage: "es",
+			Err:            errString("err"),
+
+			ExpectedLanguage: "en",
+			ExpectedBuf:      "Something went wrong",
+		},
+		"No_Message": {
+			AcceptLanguage: "es",
+			Err:            errKeyed("missing"),
+
+			ExpectedLanguage: "",
+			ExpectedBuf:      "Internal Server Error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/", nil)
+			req.Header.Set("Accept-Language", tc.AcceptLanguage)
+			recorder := httptest.NewRecorder()
+
+			LocalizedHandler(bundle, http.StatusInternalServerError)(recorder, req, tc.Err)
+
+			if lang := recorder.Header().Get("Content-Language"); tc.ExpectedLanguage != lang {
+				t.Fatalf("expected Content-Language %s, got %s", tc.ExpectedLanguage, lang)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// logError logs err, being handled by h, to the logger set with WithLogger and to the function set
+// with WithLoggerFunc, the latter being skipped and the former logging at info level if err is
+// expected, see Mux.HandleExpected.
+func (m *Mux) logError(r *http.Request, err error, h handlerStruct) {
+	label := h.label()
+
+	var n int64
+	if m.cfg.logEvery > 1 {
+		n = m.occurrence(label)
+		if (n-1)%int64(m.cfg.logEvery) != 0 {
+			return
+		}
+	}
+
+	if m.cfg.loggerFunc != nil && !h.expected {
+		m.cfg.loggerFunc(r, err, label)
+	}
+	if m.cfg.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("error", err.Error()), slog.String("handler", label)}
+	if n != 0 {
+		attrs = append(attrs, slog.Int64("occurrences", n))
+	}
+	if m.cfg.logChain && h.err == nil {
+		attrs = append(attrs, slog.Any("chain", Chainf(err)))
+	}
+	level := slog.LevelError
+	if h.expected {
+		level = slog.LevelInfo
+	}
+	m.cfg.logger.LogAttrs(r.Context(), level, "centra: error handled", attrs...)
+}
+
+// logNearMisses logs the registered errors of m and of its parents whose message is contained in
+// the message of err, which reached the UnknownHandler, see WithNearMissHints.
+func (m *Mux) logNearMisses(r *http.Request, err error) {
+	msg := err.Error()
+
+	var candidates []string
+	for mux := m; mux != nil; mux = mux.state.Load().parent {
+		for _, h := range mux.state.Load().handlersStack[1:] {
+			// the placeholders of the matchers and of the status handlers have no meaningful
+			// message
+			if !h.plain() {
+				continue
+			}
+			if candidate := h.err.Error(); candidate != "" && strings.Contains(msg, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	logger := m.cfg.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(r.Context(), slog.LevelWarn,
+		"centra: unhandled error contains the message of a registered error, did you forget to wrap it with %w?",
+		slog.String("error", msg), slog.Any("candidates", candidates))
+}
+
+// occurrence counts an occurrence of the errors handled by the handler labeled label, returning
+// the number of occurrences so far, see WithSampledLogging.
+func (m *Mux) occurrence(label string) int64 {
+	c, ok := m.logCounts.Load(label)
+	if !ok {
+		c, _ = m.logCounts.LoadOrStore(label, new(atomic.Int64))
+	}
+	return c.(*atomic.Int64).Add(1)
+}
+
+// Returns the messages of err and of every error in its chain, in the order errors.Is visits
+// them: depth-first, following both "Unwrap() error" and "Unwrap() []error". Returns nil if err
+// is nil.
+//
+// It's useful to log why an error didn't match the expected registered error, for example
+// because it's wrapped deeper than expected, see [WithChainLogging].
+func Chainf(err error) []string {
+	var chain []string
+	walkChain(err, func(e error) bool {
+		chain = append(chain, e.Error())
+		return false
+	})
+	return chain
+}
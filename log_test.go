@@ -0,0 +1,342 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainf(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		Expected string
+	}{
+		"Nil": {
+			Err:      nil,
+			Expected: "[]",
+		},
+		"Single": {
+			Err:      errString("A"),
+			Expected: "[A]",
+		},
+		"Multi_Level": {
+			Err:      fmt.Errorf("handler: %w", fmt.Errorf("repo: %w", errString("A"))),
+			Expected: "[handler: repo: A repo: A A]",
+		},
+		"Joined": {
+			Err:      fmt.Errorf("handler: %w", errors.Join(fmt.Errorf("b: %w", errString("B")), errString("C"))),
+			Expected: "[handler: b: B\nC b: B\nC b: B B C]",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprint(Chainf(tc.Err)); tc.Expected != got {
+				t.Fatalf("expected %q, got %q", tc.Expected, got)
+			}
+		})
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+		Err  error
+
+		ExpectedLog string
+	}{
+		"Matched": {
+			Err:         errString("A"),
+			ExpectedLog: `level=ERROR msg="centra: error handled" error=A handler=A`,
+		},
+		"Unknown_Without_Chain": {
+			Err:         fmt.Errorf("handler: %w", errString("other")),
+			ExpectedLog: `level=ERROR msg="centra: error handled" error="handler: other" handler=unknown`,
+		},
+		"Unknown_With_Chain": {
+			Opts:        []Option{WithChainLogging()},
+			Err:         fmt.Errorf("handler: %w", errString("other")),
+			ExpectedLog: `level=ERROR msg="centra: error handled" error="handler: other" handler=unknown chain="[handler: other other]"`,
+		},
+		"Matched_With_Chain": {
+			Opts:        []Option{WithChainLogging()},
+			Err:         fmt.Errorf("handler: %w", errString("A")),
+			ExpectedLog: `level=ERROR msg="centra: error handled" error="handler: A" handler=A`,
+		},
+		"Expected_Info_Level": {
+			Err:         fmt.Errorf("validate: %w", errString("V")),
+			ExpectedLog: `level=INFO msg="centra: error handled" error="validate: V" handler=V`,
+		},
+		"Nil_Not_Logged": {
+			Err:         nil,
+			ExpectedLog: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+
+			errMux := NewMux(append(tc.Opts, WithLogger(logger))...)
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.HandleExpected(errString("V"), http.StatusBadRequest, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if got := strings.TrimSuffix(buf.String(), "\n"); tc.ExpectedLog != got {
+				t.Fatalf("expected log %s, got %s", tc.ExpectedLog, got)
+			}
+		})
+	}
+}
+
+func TestWithLoggerFunc(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedLabel string
+		ExpectedCalls int
+	}{
+		"Named": {
+			Err:           fmt.Errorf("query: %w", errString("A")),
+			ExpectedLabel: "users.not_found",
+			ExpectedCalls: 1,
+		},
+		"Sentinel": {
+			Err:           errString("B"),
+			ExpectedLabel: "B",
+			ExpectedCalls: 1,
+		},
+		"Unknown": {
+			Err:           errString("C"),
+			ExpectedLabel: UnknownName,
+			ExpectedCalls: 1,
+		},
+		"Expected_Not_Logged": {
+			Err:           errString("V"),
+			ExpectedCalls: 0,
+		},
+		"Nil_Not_Logged": {
+			Err:           nil,
+			ExpectedCalls: 0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			var label string
+			errMux := NewMux(WithLoggerFunc(func(r *http.Request, err error, l string) {
+				calls++
+				label = l
+				if err != tc.Err {
+					t.Fatalf("expected error %v, got %v", tc.Err, err)
+				}
+			}))
+			errMux.HandleNamed("users.not_found", errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.HandleExpected(errString("V"), http.StatusBadRequest, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected %d calls, got %d", tc.ExpectedCalls, calls)
+			}
+			if tc.ExpectedLabel != label {
+				t.Fatalf("expected label %q, got %q", tc.ExpectedLabel, label)
+			}
+		})
+	}
+}
+
+func TestWithSampledLogging(t *testing.T) {
+	testCases := map[string]struct {
+		Every int
+		Errs  []error
+
+		ExpectedLogs int
+	}{
+		"Every_10": {
+			Every:        10,
+			Errs:         repeatErr(errString("A"), 100),
+			ExpectedLogs: 10,
+		},
+		"Every_10_First_Logged": {
+			Every:        10,
+			Errs:         repeatErr(errString("A"), 1),
+			ExpectedLogs: 1,
+		},
+		"Every_10_Per_Sentinel": {
+			Every:        10,
+			Errs:         append(repeatErr(errString("A"), 11), repeatErr(errString("B"), 11)...),
+			ExpectedLogs: 4,
+		},
+		"Every_10_Unknown_Counted_Together": {
+			Every:        10,
+			Errs:         append(repeatErr(errString("X"), 5), repeatErr(errString("Y"), 6)...),
+			ExpectedLogs: 2,
+		},
+		"Every_1": {
+			Every:        1,
+			Errs:         repeatErr(errString("A"), 5),
+			ExpectedLogs: 5,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+			errMux := NewMux(WithLogger(logger), WithSampledLogging(tc.Every))
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			for _, err := range tc.Errs {
+				Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), err)
+			}
+
+			if got := strings.Count(buf.String(), "centra: error handled"); tc.ExpectedLogs != got {
+				t.Fatalf("expected %d logs, got %d:\n%s", tc.ExpectedLogs, got, buf.String())
+			}
+			if tc.Every > 1 && !strings.Contains(buf.String(), "occurrences=1\n") {
+				t.Fatalf("expected the first occurrence to be logged, got %s", buf.String())
+			}
+		})
+	}
+}
+
+func repeatErr(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func TestWithNearMissHints(t *testing.T) {
+	errNotFound := errors.New("user not found")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedHint bool
+	}{
+		"Formatted_With_V": {
+			Err:          fmt.Errorf("loading user: %v", errNotFound),
+			ExpectedHint: true,
+		},
+		"Wrapped": {
+			Err:          fmt.Errorf("loading user: %w", errNotFound),
+			ExpectedHint: false,
+		},
+		"Unrelated": {
+			Err:          errors.New("connection refused"),
+			ExpectedHint: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+			errMux := NewMux(WithLogger(logger), WithNearMissHints())
+			errMux.Handle(errNotFound, func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.HandleStatus(http.StatusNotFound, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			hint := strings.Contains(buf.String(), "did you forget to wrap it with %w?")
+			if tc.ExpectedHint != hint {
+				t.Fatalf("expected hint %t, got %t:\n%s", tc.ExpectedHint, hint, buf.String())
+			}
+			if hint && !strings.Contains(buf.String(), `candidates="[user not found]"`) {
+				t.Fatalf("expected the registered error as candidate, got:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestHandleExpected(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus   int
+		ExpectedExpected bool
+		ExpectedLogged   bool
+	}{
+		"Expected": {
+			Err:              fmt.Errorf("validate: %w", errString("V")),
+			ExpectedStatus:   http.StatusUnprocessableEntity,
+			ExpectedExpected: true,
+			ExpectedLogged:   false,
+		},
+		"Unexpected": {
+			Err:              errString("A"),
+			ExpectedStatus:   http.StatusInternalServerError,
+			ExpectedExpected: false,
+			ExpectedLogged:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelError}))
+
+			var expected bool
+			errMux := NewMux(WithLogger(logger))
+			errMux.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					expected = Expected(r)
+					next(w, r, err)
+				}
+			})
+			errMux.HandleExpected(errString("V"), http.StatusUnprocessableEntity, TextHandler(0))
+			errMux.Handle(errString("A"), TextHandler(0))
+
+			recorder := httptest.NewRecorder()
+			errMux.ServeError(recorder, httptest.NewRequest("", "/", nil), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedExpected != expected {
+				t.Fatalf("expected Expected %v, got %v", tc.ExpectedExpected, expected)
+			}
+			if logged := buf.Len() != 0; tc.ExpectedLogged != logged {
+				t.Fatalf("expected logged %v, got %v: %s", tc.ExpectedLogged, logged, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matcher reports whether an error should be handled by a handler, every registration of a Mux
+// is made of a Matcher and its handler, see [Mux.HandleMatcher] to register a custom one. The
+// built-in matchers are [IsMatcher], [AsMatcher], [ExactMatcher] and [FuncMatcher].
+//
+// Match is called with the error passed to [Error], or with one of the errors it joins, see
+// [Mux.Handle], so it may be called concurrently and must not modify err.
+type Matcher interface {
+	Match(err error) bool
+}
+
+// Returns a Matcher of the errors for which errors.Is(err, target) reports true, the one used by
+// [Mux.Handle].
+func IsMatcher(target error) Matcher {
+	return isMatcher{target: target}
+}
+
+type isMatcher struct {
+	target error
+}
+
+func (m isMatcher) Match(err error) bool {
+	return errors.Is(err, m.target)
+}
+
+func (isMatcher) matchesWrapping() {}
+
+// Returns a Matcher of the errors that have an error of type T in their chain, as reported by
+// errors.As, the one used by [HandleType].
+func AsMatcher[T error]() Matcher {
+	return asMatcher[T]{}
+}
+
+type asMatcher[T error] struct{}
+
+func (asMatcher[T]) Match(err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+func (asMatcher[T]) matchesWrapping() {}
+
+// chainMatcher is implemented by the built-in matchers that match every error wrapping an error
+// they match, so Validate can tell when a handler using one shadows another.
+type chainMatcher interface {
+	Matcher
+	matchesWrapping()
+}
+
+// Returns a Matcher of the errors identical (==) to target, without following their Unwrap
+// chain, the one used by [Mux.HandleExact].
+func ExactMatcher(target error) Matcher {
+	return exactMatcher{target: target}
+}
+
+type exactMatcher struct {
+	target error
+}
+
+func (m exactMatcher) Match(err error) bool {
+	return identical(err, m.target)
+}
+
+// The FuncMatcher type is an adapter to allow the use of ordinary functions as a Matcher, like
+// http.HandlerFunc does for http.Handler.
+type FuncMatcher func(err error) bool
+
+// Match calls f(err).
+func (f FuncMatcher) Match(err error) bool {
+	return f(err)
+}
+
+// Sets handler to handle the errors matched by matcher, following the same precedence of
+// [Mux.Handle], so the matching strategies not covered by the other registration methods can be
+// plugged in:
+//
+//	errMux.HandleMatcher(centra.FuncMatcher(func(err error) bool {
+//		return errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err)
+//	}), timeoutHandler)
+//
+// [Matched] returns matcher itself for the errors handled by handler if it implements error, or a
+// placeholder error describing its type otherwise.
+func (m *Mux) HandleMatcher(matcher Matcher, handler ErrorHandlerFunc) {
+	if matcher == nil {
+		panic("centra: matcher must not be nil")
+	}
+
+	err, ok := matcher.(error)
+	if !ok {
+		err = matcherError{typ: fmt.Sprintf("%T", matcher)}
+	}
+
+	if handler == nil {
+		panic(nilHandlerMessage(err))
+	}
+
+	m.handle("HandleMatcher", handlerStruct{
+		err:     err,
+		handler: handler,
+		matcher: matcher,
+	})
+}
+
+// matcherError is the placeholder registered error of the handlers registered with
+// HandleMatcher, when the Matcher doesn't implement error.
+type matcherError struct {
+	typ string
+}
+
+func (e matcherError) Error() string {
+	return "centra: errors matched by " + e.typ
+}
+
+// Sets handler to handle the errors matched by matcher, that is, the errors that have an error e
+// in their chain for which matcher.Is(e) reports true, if matcher implements
+// "Is(error) bool", or that is identical (==) to matcher otherwise.
+//
+// This is the opposite direction of [Mux.Handle]: errors.Is(err, target) only calls the Is
+// methods of the errors in the chain of err, never the one of target, so a registered error
+// implementing Is to match a family of errors is never consulted by Handle. HandleMatch is meant
+// for those "matcher errors":
+//
+//	type statusFamily int // matches any *HTTPError with a status in the same hundred
+//
+//	func (f statusFamily) Error() string { return "status family" }
+//
+//	func (f statusFamily) Is(err error) bool {
+//		e, ok := err.(*HTTPError)
+//		return ok && e.Status/100 == int(f)
+//	}
+//
+//	errMux.HandleMatch(statusFamily(4), clientErrorHandler)
+//
+// It follows the same precedence of [Mux.Handle].
+func (m *Mux) HandleMatch(matcher error, handler ErrorHandlerFunc) {
+	if matcher == nil {
+		panic("centra: matcher must not be nil")
+	}
+
+	if handler == nil {
+		panic(nilHandlerMessage(matcher))
+	}
+
+	is, _ := matcher.(interface{ Is(error) bool })
+
+	m.handle("HandleMatch", handlerStruct{
+		err:     matcher,
+		handler: handler,
+		matcher: FuncMatcher(func(err error) bool {
+			return walkChain(err, func(e error) bool {
+				if is != nil {
+					return is.Is(e)
+				}
+				return identical(e, matcher)
+			})
+		}),
+	})
+}
+
+// Sets handler to handle the errors whose message, as returned by err.Error(), matches re.
+//
+// Matching by message is fragile, the message of an error is rarely part of the API of the
+// package returning it and it may change in any release, so HandleRegexp is only meant as a last
+// resort for the third-party errors that expose no sentinel or type to match with [Mux.Handle]
+// or [HandleType], like the ones created with fmt.Errorf without %w:
+//
+//	errMux.HandleRegexp(regexp.MustCompile(`^quota exceeded for project \S+$`), quotaHandler)
+//
+// The handlers registered with HandleRegexp are consulted after all the other handlers matching
+// err, regardless of registration order, see [Error], and [Matched] returns a placeholder error
+// describing re for the errors handled by handler. Among themselves they follow the same
+// precedence of [Mux.Handle].
+func (m *Mux) HandleRegexp(re *regexp.Regexp, handler ErrorHandlerFunc) {
+	if re == nil {
+		panic("centra: re must not be nil")
+	}
+
+	if handler == nil {
+		panic("centra: handler must not be nil for regexp: " + re.String())
+	}
+
+	m.handle("HandleRegexp", handlerStruct{
+		err:      regexpError{expr: re.String()},
+		handler:  handler,
+		fallback: true,
+		matcher: FuncMatcher(func(err error) bool {
+			return re.MatchString(err.Error())
+		}),
+	})
+}
+
+// regexpError is the placeholder registered error of the handlers registered with HandleRegexp.
+type regexpError struct {
+	expr string
+}
+
+func (e regexpError) Error() string {
+	return "centra: errors matching regexp " + e.expr
+}
+
+// match returns the handler registered in s that handles err, reporting false if there is none.
+//
+// Exact handlers are checked first, so they win over any handler that matches err through its
+// Unwrap chain. Then, if the chain of err reaches an error implementing "Unwrap() []error", like
+// the ones returned by errors.Join, each of its errors is matched in order, recursively, and the
+// handler of the first one that matches is selected, so the errors that come first win,
+// regardless of registration order. Finally, err is matched as a whole, which selects the
+// handlers matching the errors wrapping the joined error.
+//
+// The handlers registered with Mux.HandleMethod for method are checked before the other non-exact
+// handlers matching the same error.
+func (s *muxState) match(method string, err error, mostSpecific bool, trace traceFunc) (handlerStruct, bool) {
+	for i := len(s.handlersStack) - 1; i >= 1; i-- {
+		h := s.handlersStack[i]
+		if !h.exact {
+			continue
+		}
+		ok := h.matches(err)
+		if trace != nil {
+			trace(h, err, ok)
+		}
+		if ok {
+			return h, true
+		}
+	}
+	return s.matchBranches(method, err, mostSpecific, trace)
+}
+
+// matchBranches returns the non-exact handler registered in s that handles err, trying the
+// errors joined in its chain first, see muxState.match.
+func (s *muxState) matchBranches(method string, err error, mostSpecific bool, trace traceFunc) (handlerStruct, bool) {
+	if joined := findJoined(err); joined != nil {
+		for _, branch := range joined.Unwrap() {
+			if h, ok := s.matchBranches(method, branch, mostSpecific, trace); ok {
+				return h, true
+			}
+		}
+	}
+
+	if s.methods && method != "" {
+		if h, ok := s.scan(method, err, mostSpecific, trace); ok {
+			return h, true
+		}
+	}
+	return s.scan("", err, mostSpecific, trace)
+}
+
+// scan returns the non-exact handler registered in s for method that handles err itself, an
+// empty method selecting the handlers not registered with Mux.HandleMethod.
+func (s *muxState) scan(method string, err error, mostSpecific bool, trace traceFunc) (handlerStruct, bool) {
+	best, bestDepth := handlerStruct{}, -1
+	for i := len(s.handlersStack) - 1; i >= 1; i-- {
+		h := s.handlersStack[i]
+		if h.exact || h.status != 0 || h.fallback {
+			// status handlers are looked up after matching, see Mux.HandleStatus, and the
+			// fallback ones by matchFallback
+			continue
+		}
+		if h.method != method && (method == "" || !strings.EqualFold(h.method, method)) {
+			continue
+		}
+		ok := h.matches(err)
+		if trace != nil {
+			trace(h, err, ok)
+		}
+		if !ok {
+			continue
+		}
+		if !mostSpecific {
+			return h, true
+		}
+		// on ties, the one registered last, found first, wins
+		if depth := matchDepth(h, err); bestDepth == -1 || depth < bestDepth {
+			best, bestDepth = h, depth
+		}
+	}
+	return best, bestDepth != -1
+}
+
+// matchFallback returns the handler registered in s with Mux.HandleRegexp that handles err,
+// reporting false if there is none. It's consulted after muxState.match.
+func (s *muxState) matchFallback(err error, trace traceFunc) (handlerStruct, bool) {
+	for i := len(s.handlersStack) - 1; i >= 1; i-- {
+		h := s.handlersStack[i]
+		if !h.fallback {
+			continue
+		}
+		ok := h.matches(err)
+		if trace != nil {
+			trace(h, err, ok)
+		}
+		if ok {
+			return h, true
+		}
+	}
+	return handlerStruct{}, false
+}
+
+// matchDepth returns the depth in the chain of err, 0 being err itself, of the deepest error
+// matched by h, this is, where the match originates: the registered error itself for the
+// handlers registered with Mux.Handle. It's only called when h matches err.
+func matchDepth(h handlerStruct, err error) int {
+	depth := 0
+	var walk func(e error, d int)
+	walk = func(e error, d int) {
+		for e != nil && h.matches(e) {
+			if d > depth {
+				depth = d
+			}
+			switch u := e.(type) {
+			case interface{ Unwrap() error }:
+				e, d = u.Unwrap(), d+1
+			case interface{ Unwrap() []error }:
+				for _, branch := range u.Unwrap() {
+					walk(branch, d+1)
+				}
+				return
+			default:
+				return
+			}
+		}
+	}
+	walk(err, 0)
+	return depth
+}
+
+// traceFunc is called with every handler tested against target while resolving an error, see
+// Mux.Explain.
+type traceFunc func(h handlerStruct, target error, matched bool)
+
+// findJoined returns the first error of the chain of err that implements "Unwrap() []error",
+// following "Unwrap() error", or nil if there is none.
+func findJoined(err error) interface{ Unwrap() []error } {
+	for err != nil {
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			return u
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// Maximum number of errors in the chain of an error handled by [Error], counting err itself and
+// every error it wraps, as visited by errors.Is. Traversing a longer chain with errors.Is for every
+// registered handler would be too slow, and a cyclic chain, with an Unwrap method returning an
+// error already in the chain, would never end. So the errors with a longer chain, cyclic ones
+// included, are replaced by an error with the same message and no chain, matching
+// [ErrChainTooDeep], before being matched, handled by the UnknownHandler unless a handler is
+// registered for ErrChainTooDeep. The same applies to [Mux.Match], [Mux.Explain], [Mux.DryRun]
+// and [Mux.Outcome].
+const MaxChainLength = 100
+
+// Matched by the errors replacing the ones whose chain is longer than [MaxChainLength].
+var ErrChainTooDeep = errors.New("centra: error chain too deep")
+
+// deepChainError replaces an error whose chain is longer than MaxChainLength, see boundChain.
+type deepChainError struct {
+	err error
+}
+
+func (e deepChainError) Error() string {
+	return e.err.Error()
+}
+
+func (e deepChainError) Is(target error) bool {
+	return target == ErrChainTooDeep
+}
+
+// boundChain returns err, or a deepChainError replacing it if its chain is longer than
+// MaxChainLength.
+func boundChain(err error) error {
+	n := 0
+	if walkChain(err, func(error) bool {
+		n++
+		return n > MaxChainLength
+	}) {
+		return deepChainError{err: err}
+	}
+	return err
+}
+
+// walkChain calls fn for err and every error in its chain, in the same order errors.Is does:
+// depth-first, following both "Unwrap() error" and "Unwrap() []error". It stops as soon as fn
+// reports true, and returns whether it did.
+func walkChain(err error, fn func(e error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				if walkChain(e, fn) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+	}
+	return false
+}
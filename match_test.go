@@ -0,0 +1,596 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type httpError struct {
+	Status int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("http error %d", e.Status)
+}
+
+// statusFamily matches any *httpError with a status in the same hundred
+type statusFamily int
+
+func (f statusFamily) Error() string {
+	return fmt.Sprintf("%dxx", int(f))
+}
+
+func (f statusFamily) Is(err error) bool {
+	e, ok := err.(*httpError)
+	return ok && e.Status/100 == int(f)
+}
+
+func TestMatchers(t *testing.T) {
+	errBase := errString("base")
+	errHTTP := &httpError{Status: 404}
+
+	testCases := map[string]struct {
+		Matcher Matcher
+		Err     error
+
+		ExpectedMatch bool
+	}{
+		"Is":                 {Matcher: IsMatcher(errBase), Err: errBase, ExpectedMatch: true},
+		"Is_Wrapped":         {Matcher: IsMatcher(errBase), Err: fmt.Errorf("w: %w", errBase), ExpectedMatch: true},
+		"Is_Other":           {Matcher: IsMatcher(errBase), Err: errString("other"), ExpectedMatch: false},
+		"As":                 {Matcher: AsMatcher[*httpError](), Err: errHTTP, ExpectedMatch: true},
+		"As_Wrapped":         {Matcher: AsMatcher[*httpError](), Err: fmt.Errorf("w: %w", errHTTP), ExpectedMatch: true},
+		"As_Other":           {Matcher: AsMatcher[*httpError](), Err: errBase, ExpectedMatch: false},
+		"Exact":              {Matcher: ExactMatcher(errBase), Err: errBase, ExpectedMatch: true},
+		"Exact_Wrapped":      {Matcher: ExactMatcher(errBase), Err: fmt.Errorf("w: %w", errBase), ExpectedMatch: false},
+		"Exact_Uncomparable": {Matcher: ExactMatcher(errBase), Err: errUncomparable{"a"}, ExpectedMatch: false},
+		"Func": {
+			Matcher:       FuncMatcher(func(err error) bool { return err.Error() == "base" }),
+			Err:           errBase,
+			ExpectedMatch: true,
+		},
+		"Func_Other": {
+			Matcher:       FuncMatcher(func(err error) bool { return err.Error() == "base" }),
+			Err:           errString("other"),
+			ExpectedMatch: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if match := tc.Matcher.Match(tc.Err); tc.ExpectedMatch != match {
+				t.Fatalf("expected match %t, got %t", tc.ExpectedMatch, match)
+			}
+		})
+	}
+}
+
+// evenStatus is a Matcher implementing error, so it's its own registered error
+type evenStatus struct{}
+
+func (evenStatus) Error() string { return "even status" }
+
+func (evenStatus) Match(err error) bool {
+	var e *httpError
+	return errors.As(err, &e) && e.Status%2 == 0
+}
+
+func TestHandleMatcher(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf     string
+		ExpectedMatched string
+	}{
+		"Func_Matcher": {
+			Err:             errString("timeout"),
+			ExpectedBuf:     "timeout",
+			ExpectedMatched: "centra: errors matched by centra.FuncMatcher",
+		},
+		"Error_Matcher": {
+			Err:             fmt.Errorf("w: %w", &httpError{Status: 404}),
+			ExpectedBuf:     "even",
+			ExpectedMatched: "even status",
+		},
+		"No_Match": {
+			Err:             &httpError{Status: 503},
+			ExpectedBuf:     "unknown",
+			ExpectedMatched: "",
+		},
+	}
+
+	body := func(s string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, s)
+		}
+	}
+
+	var matched string
+	errMux := NewMux()
+	errMux.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			if m, ok := Matched(r); ok && m != nil {
+				matched = m.Error()
+			}
+			next(w, r, err)
+		}
+	})
+	errMux.UnknownHandler(body("unknown"))
+	errMux.HandleMatcher(FuncMatcher(func(err error) bool {
+		return err.Error() == "timeout"
+	}), body("timeout"))
+	errMux.HandleMatcher(evenStatus{}, body("even"))
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			matched = ""
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if tc.ExpectedMatched != matched {
+				t.Fatalf("expected matched %q, got %q", tc.ExpectedMatched, matched)
+			}
+		})
+	}
+}
+
+func TestHandleMatch(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"Family_4xx": {
+			Err:         &httpError{Status: 404},
+			ExpectedBuf: "4xx",
+		},
+		"Family_5xx_Wrapped": {
+			Err:         fmt.Errorf("upstream: %w", &httpError{Status: 503}),
+			ExpectedBuf: "5xx",
+		},
+		"Family_Joined": {
+			Err:         errors.Join(errString("other"), &httpError{Status: 409}),
+			ExpectedBuf: "4xx",
+		},
+		"No_Family": {
+			Err:         &httpError{Status: 302},
+			ExpectedBuf: "unknown",
+		},
+		"Plain_Matcher_Identical": {
+			Err:         fmt.Errorf("wrapped: %w", errString("plain")),
+			ExpectedBuf: "plain",
+		},
+	}
+
+	fnErrorFactory := func(message string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, message)
+		}
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(fnErrorFactory("unknown"))
+			errMux.HandleMatch(statusFamily(4), fnErrorFactory("4xx"))
+			errMux.HandleMatch(statusFamily(5), fnErrorFactory("5xx"))
+			errMux.HandleMatch(errString("plain"), fnErrorFactory("plain"))
+			// never consulted by Handle, since errors.Is doesn't call the Is method of the target
+			errMux.Handle(statusFamily(3), fnErrorFactory("3xx"))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleRegexp(t *testing.T) {
+	errQuota := errString("quota exceeded for project sentinel")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"Message_Matches": {
+			Err:         errors.New("quota exceeded for project acme"),
+			ExpectedBuf: "quota",
+		},
+		"Whole_Message_Matched": {
+			Err:         fmt.Errorf("calling api: %w", errors.New("quota exceeded for project acme")),
+			ExpectedBuf: "unknown",
+		},
+		"Sentinel_Wins": {
+			Err:         fmt.Errorf("%w", errQuota),
+			ExpectedBuf: "sentinel",
+		},
+		"Later_Regexp_Wins": {
+			Err:         errors.New("quota exceeded for project acme: rate limited"),
+			ExpectedBuf: "rate",
+		},
+		"No_Match": {
+			Err:         errors.New("permission denied"),
+			ExpectedBuf: "unknown",
+		},
+	}
+
+	fnErrorFactory := func(message string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, message)
+		}
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(fnErrorFactory("unknown"))
+			errMux.HandleRegexp(regexp.MustCompile(`^quota exceeded for project \S+`), fnErrorFactory("quota"))
+			errMux.HandleRegexp(regexp.MustCompile(`rate limited$`), fnErrorFactory("rate"))
+			// registered after the regexps, but it takes precedence anyway
+			errMux.Handle(errQuota, fnErrorFactory("sentinel"))
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+type annotatedError struct {
+	err error
+}
+
+func (e *annotatedError) Error() string {
+	return "annotated: " + e.err.Error()
+}
+
+func (e *annotatedError) Unwrap() error {
+	return e.err
+}
+
+func TestJoinedErrors(t *testing.T) {
+	errA := errString("A")
+	errB := errString("B")
+	errC := errString("C")
+	errOuter := errString("outer")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"First_Branch_Wins": {
+			// B is registered after A, but A comes first
+			Err:         errors.Join(errA, errB),
+			ExpectedBuf: "A",
+		},
+		"Unmatched_Branch_Skipped": {
+			Err:         errors.Join(errString("other"), errB, errA),
+			ExpectedBuf: "B",
+		},
+		"Wrapped_Join": {
+			Err:         fmt.Errorf("handler: %w", errors.Join(fmt.Errorf("b: %w", errB), errA)),
+			ExpectedBuf: "B",
+		},
+		"Nested_Join": {
+			Err:         errors.Join(errors.Join(errString("other"), errC), errA),
+			ExpectedBuf: "C",
+		},
+		"Multiple_Wrap_Verbs": {
+			Err:         fmt.Errorf("%w: %w", errOuter, errB),
+			ExpectedBuf: "outer",
+		},
+		"Branches_Win_Over_Wrapper": {
+			Err:         &annotatedError{err: errors.Join(errString("other"), errB)},
+			ExpectedBuf: "B",
+		},
+		"Wrapper_When_No_Branch_Matches": {
+			Err:         &annotatedError{err: errors.Join(errString("other"))},
+			ExpectedBuf: "annotated",
+		},
+		"Exact_Only_Top_Level": {
+			Err:         errors.Join(errString("exact"), errString("other")),
+			ExpectedBuf: "unknown",
+		},
+	}
+
+	fnErrorFactory := func(message string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			io.WriteString(w, message)
+		}
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(fnErrorFactory("unknown"))
+			errMux.Handle(errOuter, fnErrorFactory("outer"))
+			errMux.Handle(errA, fnErrorFactory("A"))
+			errMux.Handle(errB, fnErrorFactory("B"))
+			errMux.Handle(errC, fnErrorFactory("C"))
+			errMux.HandleExact(errString("exact"), fnErrorFactory("exact"))
+			HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err *annotatedError) {
+				io.WriteString(w, "annotated")
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// TestMatchOrderContract locks in the precedence documented in Error, which is part of the API.
+func TestMatchOrderContract(t *testing.T) {
+	errBase := errString("BASE")
+	errOther := errString("OTHER")
+	errSelf := &outOfStockError{item: "pears"}
+	noop := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Setup  func(m, parent *Mux)
+		Method string
+		Err    error
+
+		ExpectedName string
+	}{
+		"Last_Registered_Wins": {
+			Setup: func(m, parent *Mux) {
+				m.HandleNamed("first", errBase, noop)
+				m.HandleNamed("second", errBase, noop)
+			},
+			Err:          fmt.Errorf("wrapped: %w", errBase),
+			ExpectedName: "second",
+		},
+		"Higher_Priority_Wins": {
+			Setup: func(m, parent *Mux) {
+				m.HandleP(1, errBase, noop)
+				m.HandleNamed("later", errBase, noop)
+			},
+			Err:          errBase,
+			ExpectedName: "BASE",
+		},
+		"Exact_Wins_Over_Later_Handle": {
+			Setup: func(m, parent *Mux) {
+				m.HandleExact(errBase, noop)
+				m.HandleNamed("later", errBase, noop)
+			},
+			Err:          errBase,
+			ExpectedName: "BASE",
+		},
+		"Self_Rendering_Wins_Over_Exact": {
+			Setup: func(m, parent *Mux) {
+				m.HandleExact(errSelf, noop)
+			},
+			Err:          errSelf,
+			ExpectedName: "*centra.outOfStockError",
+		},
+		"First_Joined_Wins": {
+			Setup: func(m, parent *Mux) {
+				m.HandleNamed("other", errOther, noop)
+				m.HandleNamed("base", errBase, noop)
+			},
+			Err:          errors.Join(errOther, errBase),
+			ExpectedName: "other",
+		},
+		"Method_Wins_Over_Later_Handle": {
+			Setup: func(m, parent *Mux) {
+				m.HandleMethod(http.MethodPost, errBase, noop)
+				m.HandleNamed("later", errBase, noop)
+			},
+			Method:       http.MethodPost,
+			Err:          errBase,
+			ExpectedName: "BASE",
+		},
+		"Error_Wins_Over_Status": {
+			Setup: func(m, parent *Mux) {
+				m.HandleNamed("error", errBase, noop)
+				m.HandleStatus(http.StatusConflict, noop)
+			},
+			Err:          fmt.Errorf("%w: %w", errBase, codedError{code: http.StatusConflict}),
+			ExpectedName: "error",
+		},
+		"Status_Wins_Over_Range": {
+			Setup: func(m, parent *Mux) {
+				m.HandleStatus(http.StatusConflict, noop)
+				m.HandleStatusRange(400, 499, noop)
+			},
+			Err:          codedError{code: http.StatusConflict},
+			ExpectedName: "centra: errors mapped to status 409",
+		},
+		"Own_Wins_Over_Parent": {
+			Setup: func(m, parent *Mux) {
+				parent.HandleNamed("parent", errBase, noop)
+				m.HandleStatusRange(400, 499, noop)
+			},
+			Err:          fmt.Errorf("%w: %w", errBase, codedError{code: http.StatusConflict}),
+			ExpectedName: "centra: errors mapped to status 400-499",
+		},
+		"Error_Wins_Over_Regexp": {
+			Setup: func(m, parent *Mux) {
+				m.HandleNamed("error", errBase, noop)
+				m.HandleRegexp(regexp.MustCompile("BASE"), noop)
+			},
+			Err:          errBase,
+			ExpectedName: "error",
+		},
+		"Regexp_Wins_Over_Status": {
+			Setup: func(m, parent *Mux) {
+				m.HandleStatus(http.StatusConflict, noop)
+				m.HandleRegexp(regexp.MustCompile("^conflict"), noop)
+			},
+			Err:          fmt.Errorf("conflict: %w", codedError{code: http.StatusConflict}),
+			ExpectedName: "centra: errors matching regexp ^conflict",
+		},
+		"Parent_Wins_Over_Unknown": {
+			Setup: func(m, parent *Mux) {
+				parent.HandleNamed("parent", errBase, noop)
+			},
+			Err:          errBase,
+			ExpectedName: "parent",
+		},
+		"Unknown": {
+			Setup:        func(m, parent *Mux) {},
+			Err:          errOther,
+			ExpectedName: UnknownName,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			parent := NewMux()
+			errMux := NewMux(WithSelfRendering())
+			errMux.WithParent(parent)
+			tc.Setup(errMux, parent)
+
+			var selected string
+			capture := func(w http.ResponseWriter, r *http.Request, err error) {
+				selected = MatchedName(r)
+			}
+			errMux.Finalize(capture)
+			parent.Finalize(capture)
+
+			req := SetMux(httptest.NewRequest(tc.Method, "/", nil), errMux)
+			Error(httptest.NewRecorder(), req, tc.Err)
+
+			if tc.ExpectedName != selected {
+				t.Fatalf("expected %q to be selected, got %q", tc.ExpectedName, selected)
+			}
+		})
+	}
+}
+
+// cyclicError unwraps to itself, so errors.Is never ends for the errors it doesn't match.
+type cyclicError struct{}
+
+func (e *cyclicError) Error() string {
+	return "cyclic"
+}
+
+func (e *cyclicError) Unwrap() error {
+	return e
+}
+
+// wrapChain returns err wrapped n times with fmt.Errorf.
+func wrapChain(err error, n int) error {
+	for i := 0; i < n; i++ {
+		err = fmt.Errorf("level %d: %w", i, err)
+	}
+	return err
+}
+
+// assertTerminates fails the test if fn doesn't return promptly.
+func assertTerminates(t *testing.T, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not terminate")
+	}
+}
+
+func TestBoundChain(t *testing.T) {
+	deep := wrapChain(errString("A"), 10*MaxChainLength)
+	shallow := wrapChain(errString("A"), MaxChainLength-1)
+
+	testCases := map[string]struct {
+		Err        error
+		HandleDeep bool
+
+		ExpectedBuf     string
+		ExpectedMatched bool
+	}{
+		"Cyclic": {
+			Err:         &cyclicError{},
+			ExpectedBuf: "unknown: cyclic",
+		},
+		"Deep": {
+			Err:         deep,
+			ExpectedBuf: "unknown: " + deep.Error(),
+		},
+		"Deep_Handled": {
+			Err:             deep,
+			HandleDeep:      true,
+			ExpectedBuf:     "too deep",
+			ExpectedMatched: true,
+		},
+		"Within_Limit": {
+			Err:             shallow,
+			ExpectedBuf:     "A",
+			ExpectedMatched: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := NewMux()
+			m.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				if !errors.Is(err, ErrChainTooDeep) {
+					t.Errorf("expected an error matching ErrChainTooDeep, got %v", err)
+				}
+				io.WriteString(w, "unknown: "+err.Error())
+			})
+			m.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "A")
+			})
+			m.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			if tc.HandleDeep {
+				m.Handle(ErrChainTooDeep, func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, "too deep")
+				})
+			}
+
+			recorder := httptest.NewRecorder()
+			assertTerminates(t, func() {
+				m.ServeError(recorder, httptest.NewRequest("", "/", nil), tc.Err)
+			})
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if _, matched := m.Match(tc.Err); tc.ExpectedMatched != matched {
+				t.Fatalf("expected matched %v, got %v", tc.ExpectedMatched, matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"net/http"
+	"time"
+)
+
+// Returns a middleware, meant to be passed to [Mux.Use], that measures how long the handlers it
+// wraps take, calling observe with the name of the handler, see [MatchedName], and the duration,
+// so slow error pages can be spotted in dashboards without importing any metrics library. The
+// time is read from the clock set with [WithClock]:
+//
+//	errMux.Use(centra.MeasureLatency(func(matched string, d time.Duration) {
+//		latency.WithLabelValues(matched).Observe(d.Seconds())
+//	}))
+func MeasureLatency(observe func(matched string, d time.Duration)) func(ErrorHandlerFunc) ErrorHandlerFunc {
+	if observe == nil {
+		panic("centra: observe must not be nil")
+	}
+
+	return func(next ErrorHandlerFunc) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			start := Now(r)
+			next(w, r, err)
+			observe(MatchedName(r), Now(r).Sub(start))
+		}
+	}
+}
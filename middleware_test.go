@@ -0,0 +1,69 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeasureLatency(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedMatched string
+	}{
+		"Matched": {
+			Err:             errString("A"),
+			ExpectedMatched: "slow_page",
+		},
+		"Unknown": {
+			Err:             errString("B"),
+			ExpectedMatched: UnknownName,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				observed []string
+				duration time.Duration
+			)
+
+			errMux := NewMux()
+			errMux.Use(MeasureLatency(func(matched string, d time.Duration) {
+				observed = append(observed, matched)
+				duration = d
+			}))
+			errMux.HandleNamed("slow_page", errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				time.Sleep(10 * time.Millisecond)
+			})
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				time.Sleep(10 * time.Millisecond)
+			})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if len(observed) != 1 || observed[0] != tc.ExpectedMatched {
+				t.Fatalf("expected a single observation for %s, got %v", tc.ExpectedMatched, observed)
+			}
+			if duration < 10*time.Millisecond {
+				t.Fatalf("expected duration of at least 10ms, got %s", duration)
+			}
+		})
+	}
+}
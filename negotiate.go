@@ -0,0 +1,117 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Returns the offer that best matches the Accept header accept, or an empty string if none of the
+// offers is acceptable, it's the building block of [NegotiatingHandler] and can be used to write
+// custom negotiating handlers. An empty accept header accepts any offer, in that case the first
+// one is returned.
+//
+// For each offer, the most specific media range of accept that matches it gives its quality,
+// "type/subtype" being more specific than "type/*", and "type/*" more specific than "*/*". The
+// offer with the highest quality wins, ties are won by the offer that comes first. An offer with
+// quality 0 is not acceptable. Malformed media ranges are ignored, as well as malformed or out of
+// range qualities, which make their media range not acceptable.
+func PreferredMediaType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, subtype, ok := splitMediaType(offer)
+		if !ok {
+			continue
+		}
+
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			var s int
+			switch {
+			case mr.typ == typ && mr.subtype == subtype:
+				s = 2
+			case mr.typ == typ && mr.subtype == "*":
+				s = 1
+			case mr.typ == "*" && mr.subtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the media ranges of an Accept header, ignoring the malformed ones.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(part, ";")
+
+		typ, subtype, ok := splitMediaType(mt)
+		if !ok || (typ == "*" && subtype != "*") {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// splitMediaType splits a "type/subtype" media type in lowercase, reporting false if it's
+// malformed.
+func splitMediaType(mt string) (typ, subtype string, ok bool) {
+	typ, subtype, ok = strings.Cut(strings.ToLower(strings.TrimSpace(mt)), "/")
+	typ, subtype = strings.TrimSpace(typ), strings.TrimSpace(subtype)
+	if !ok || typ == "" || subtype == "" {
+		return "", "", false
+	}
+	return typ, subtype, true
+}
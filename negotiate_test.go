@@ -0,0 +1,80 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import "testing"
+
+func TestPreferredMediaType(t *testing.T) {
+	offers := []string{"text/html", "application/json"}
+
+	testCases := map[string]struct {
+		Accept string
+
+		Expected string
+	}{
+		"Empty":             {Accept: "", Expected: "text/html"},
+		"Exact":             {Accept: "application/json", Expected: "application/json"},
+		"Any":               {Accept: "*/*", Expected: "text/html"},
+		"Type_Wildcard":     {Accept: "application/*", Expected: "application/json"},
+		"Quality":           {Accept: "text/html;q=0.5, application/json", Expected: "application/json"},
+		"Specific_Wins":     {Accept: "text/*;q=0.1, text/html;q=0.9, */*;q=0.5", Expected: "text/html"},
+		"Specific_Zero":     {Accept: "text/html;q=0, */*", Expected: "application/json"},
+		"Case_Insensitive":  {Accept: "Application/JSON", Expected: "application/json"},
+		"None_Acceptable":   {Accept: "image/png", Expected: ""},
+		"Malformed_Ignored": {Accept: "json, /, application/json", Expected: "application/json"},
+		"Malformed_Quality": {Accept: "application/json;q=abc, text/html;q=0.1", Expected: "text/html"},
+		"Browser": {
+			Accept:   "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			Expected: "text/html",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := PreferredMediaType(tc.Accept, offers); tc.Expected != got {
+				t.Fatalf("expected %q, got %q", tc.Expected, got)
+			}
+		})
+	}
+}
+
+func FuzzPreferredMediaType(f *testing.F) {
+	offers := []string{"text/html", "application/json", "application/problem+json"}
+
+	for _, seed := range []string{
+		"",
+		"*/*",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"application/json;q=abc, text/html;q=0.1",
+		"text/*;q=0.1, text/html;q=0.9, */*;q=0.5",
+		";;,,/;q=,=",
+		"application/*;q=1e400",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, accept string) {
+		got := PreferredMediaType(accept, offers)
+		if got == "" {
+			return
+		}
+		for _, offer := range offers {
+			if got == offer {
+				return
+			}
+		}
+		t.Fatalf("expected one of the offers or empty string, got %q", got)
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Matcher error, meant to be registered with [Mux.HandleMatch], that matches the errors that have
+// a net.Error in their chain, like the *url.Error returned by http.Client or the *net.OpError
+// returned by net.Dial, typically along with [NetErrorHandler]:
+//
+//	errMux.HandleMatch(centra.NetErrors, centra.NetErrorHandler())
+var NetErrors error = netErrors{}
+
+type netErrors struct{}
+
+func (netErrors) Error() string {
+	return "centra: network errors"
+}
+
+func (netErrors) Is(err error) bool {
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// Returns an error handler for the failures of calls to upstream services, it writes 504 Gateway
+// Timeout if the net.Error found in err's chain is a timeout, and 502 Bad Gateway otherwise, for
+// example if the connection was refused. The response is rendered by [NegotiatingHandler].
+//
+// The errors without a net.Error in their chain are handled by the UnknownHandler.
+func NetErrorHandler() ErrorHandlerFunc {
+	badGateway := NegotiatingHandler(http.StatusBadGateway)
+	gatewayTimeout := NegotiatingHandler(http.StatusGatewayTimeout)
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		var netErr net.Error
+		switch {
+		case !errors.As(err, &netErr):
+			callUnknown(w, r, err)
+		case netErr.Timeout():
+			gatewayTimeout(w, r, err)
+		default:
+			badGateway(w, r, err)
+		}
+	}
+}
+
+// Errors returned by [FromTransportError] for the failures of calls to upstream services.
+var (
+	// The upstream service didn't respond in time.
+	ErrUpstreamTimeout = errors.New("centra: upstream timeout")
+
+	// The upstream service couldn't be reached or closed the connection, for example because the
+	// connection was refused or its name couldn't be resolved.
+	ErrUpstreamUnavailable = errors.New("centra: upstream unavailable")
+
+	// The TLS handshake with the upstream service failed, for example because its certificate
+	// couldn't be verified.
+	ErrUpstreamTLS = errors.New("centra: upstream TLS failure")
+)
+
+// Classifies err, typically returned by an http.RoundTripper or http.Client, returning an error
+// that wraps both err and one of [ErrUpstreamTimeout], [ErrUpstreamTLS] or
+// [ErrUpstreamUnavailable], so the failures of calls to upstream services can be handled
+// consistently:
+//
+//	resp, err := client.Do(req)
+//	if err != nil {
+//		centra.Error(w, r, centra.FromTransportError(err))
+//		return
+//	}
+//
+// Returns err unchanged if it's nil, if it's context.Canceled, since the request was canceled
+// rather than the upstream failing, or if it's not a transport failure.
+func FromTransportError(err error) error {
+	var (
+		netErr     net.Error
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		verifyErr  *tls.CertificateVerificationError
+		authErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	isNet := errors.As(err, &netErr)
+
+	var sentinel error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), isNet && netErr.Timeout():
+		sentinel = ErrUpstreamTimeout
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		sentinel = ErrUpstreamTLS
+	case isNet, errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		sentinel = ErrUpstreamUnavailable
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
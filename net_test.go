@@ -0,0 +1,181 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestNetErrorHandler(t *testing.T) {
+	// a closed listener gives an address that refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, errRefused := net.Dial("tcp", addr)
+	if errRefused == nil {
+		t.Fatal("expected connection to be refused")
+	}
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+	}{
+		"Timeout_URL_Error": {
+			Err:            &url.Error{Op: "Get", URL: "http://upstream", Err: timeoutError{}},
+			ExpectedStatus: http.StatusGatewayTimeout,
+		},
+		"Connection_Refused": {
+			Err:            fmt.Errorf("calling upstream: %w", errRefused),
+			ExpectedStatus: http.StatusBadGateway,
+		},
+		"Not_Net_Error": {
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusTeapot,
+		},
+		"Not_Net_Error_Handled_By_NetErrorHandler": {
+			Err:            errString("B"),
+			ExpectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+			errMux.HandleMatch(NetErrors, NetErrorHandler())
+			errMux.Handle(errString("B"), NetErrorHandler())
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestFromTransportError(t *testing.T) {
+	errOther := errString("A")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedSentinel error
+	}{
+		"Nil": {
+			Err: nil,
+		},
+		"Canceled": {
+			Err: &url.Error{Op: "Get", URL: "http://upstream", Err: context.Canceled},
+		},
+		"Not_Transport": {
+			Err: errOther,
+		},
+		"Timeout": {
+			Err:              &url.Error{Op: "Get", URL: "http://upstream", Err: timeoutError{}},
+			ExpectedSentinel: ErrUpstreamTimeout,
+		},
+		"Deadline_Exceeded": {
+			Err:              fmt.Errorf("calling upstream: %w", context.DeadlineExceeded),
+			ExpectedSentinel: ErrUpstreamTimeout,
+		},
+		"Connection_Refused": {
+			Err: &url.Error{Op: "Get", URL: "http://upstream", Err: &net.OpError{
+				Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED,
+			}},
+			ExpectedSentinel: ErrUpstreamUnavailable,
+		},
+		"DNS": {
+			Err: fmt.Errorf("calling upstream: %w", &url.Error{Op: "Get", URL: "http://upstream", Err: &net.OpError{
+				Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "upstream", IsNotFound: true},
+			}}),
+			ExpectedSentinel: ErrUpstreamUnavailable,
+		},
+		"EOF": {
+			Err:              fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF),
+			ExpectedSentinel: ErrUpstreamUnavailable,
+		},
+		"Unknown_Authority": {
+			Err: &url.Error{Op: "Get", URL: "https://upstream", Err: &tls.CertificateVerificationError{
+				Err: x509.UnknownAuthorityError{},
+			}},
+			ExpectedSentinel: ErrUpstreamTLS,
+		},
+		"Hostname": {
+			Err:              &url.Error{Op: "Get", URL: "https://upstream", Err: x509.HostnameError{Host: "upstream"}},
+			ExpectedSentinel: ErrUpstreamTLS,
+		},
+		"Record_Header": {
+			Err:              &url.Error{Op: "Get", URL: "https://upstream", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}},
+			ExpectedSentinel: ErrUpstreamTLS,
+		},
+		"Alert": {
+			Err:              &url.Error{Op: "Get", URL: "https://upstream", Err: &net.OpError{Op: "remote error", Err: tls.AlertError(40)}},
+			ExpectedSentinel: ErrUpstreamTLS,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := FromTransportError(tc.Err)
+
+			if tc.ExpectedSentinel == nil {
+				if tc.Err != got {
+					t.Fatalf("expected %v to be returned unchanged, got %v", tc.Err, got)
+				}
+				return
+			}
+
+			if !errors.Is(got, tc.ExpectedSentinel) {
+				t.Fatalf("expected %v to be %v", got, tc.ExpectedSentinel)
+			}
+
+			if !errors.Is(got, tc.Err) {
+				t.Fatalf("expected %v to wrap %v", got, tc.Err)
+			}
+
+			for _, sentinel := range []error{ErrUpstreamTimeout, ErrUpstreamUnavailable, ErrUpstreamTLS} {
+				if sentinel != tc.ExpectedSentinel && errors.Is(got, sentinel) {
+					t.Fatalf("expected %v not to be %v", got, sentinel)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,763 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Option configures a Mux, it's passed to [NewMux].
+type Option func(*config)
+
+type config struct {
+	// called when Handle registers an error identical to an already registered one, nil
+	// means duplicates are allowed silently.
+	onDuplicate func(err error)
+
+	// name of the header written with the name of the selected handler, empty means disabled.
+	debugHeader string
+
+	// skip handling errors of requests whose context is done, calling onCancel if not nil.
+	skipOnCancel bool
+	onCancel     func(r *http.Request, err error)
+
+	// maps the errors not matched by any registered handler to a status code.
+	statusMapper func(err error) (int, bool)
+
+	// extracts the request ID of a request.
+	requestID func(r *http.Request) string
+
+	// called before the UnknownHandler handles an error, nil means disabled.
+	onUnknown func(r *http.Request, err error)
+
+	// select the most specific of the matching handlers instead of the last registered one.
+	mostSpecific bool
+
+	// include the message of the errors in the responses of the built-in handlers.
+	verbose bool
+
+	// maximum length in bytes of the messages included by verbose, 0 means unlimited.
+	maxDetailLength int
+
+	// UnknownHandler of the new Mux, nil means DefaultUnknown.
+	unknown ErrorHandlerFunc
+
+	// chooses the UnknownHandler per request, nil means disabled.
+	unknownSelector func(r *http.Request) ErrorHandlerFunc
+
+	// logs the handled errors, nil means disabled.
+	logger *slog.Logger
+
+	// called with the handled errors, nil means disabled.
+	loggerFunc LoggerFunc
+
+	// include the chain of the errors reaching the UnknownHandler in the logs.
+	logChain bool
+
+	// log 1 in logEvery occurrences of the errors handled by the same handler, 0 means all.
+	logEvery int
+
+	// called with the value recovered from a panicking handler, nil means panics are not
+	// recovered.
+	onHandlerPanic func(r *http.Request, v any)
+
+	// status written when a handler writes the body without writing the status code, 0 means
+	// http.StatusOK, like net/http does.
+	implicitStatus int
+
+	// let the errors implementing Renderer render themselves, see WithSelfRendering.
+	selfRendering bool
+
+	// returns the current time for the built-in handlers, nil means time.Now.
+	clock func() time.Time
+
+	// called with the errors handled by the handlers registered with Mux.HandleAudited.
+	auditSink func(r *http.Request, err error)
+
+	// reject the registration of nil pointers, maps, slices, funcs and chans held by non-nil errors.
+	strictNil bool
+
+	// maximum number of handlers that can be registered, 0 means unlimited.
+	maxHandlers int
+
+	// Content-Type of the responses written without one, empty means sniffed by net/http.
+	defaultContentType string
+
+	// minimum time left before the deadline of the request to render the built-in responses.
+	deadlineGuard time.Duration
+
+	// compute the ETag of the deterministic built-in handlers, see WithETags.
+	etags bool
+
+	// called when writing the body of a response fails, nil means disabled.
+	writeErrorHook func(r *http.Request, err error)
+
+	// run the handlers against a buffer, copied to the client's writer once they return, see
+	// WithBufferedHandlers.
+	buffered bool
+
+	// localizes the status texts written by the built-in handlers, nil means http.StatusText.
+	statusText func(lang string, code int) string
+
+	// log the mistakes caught by GuardSuccess instead of panicking.
+	guardLogging bool
+
+	// log the registered errors whose message is found in the errors reaching the UnknownHandler.
+	nearMissHints bool
+
+	// headers set on every error response before calling the handler, with canonical keys.
+	defaultHeaders http.Header
+
+	// maximum time the handlers are given to render a response, 0 means unlimited.
+	renderTimeout time.Duration
+
+	// computes the CORS headers of every error response, nil means disabled.
+	corsHeaders func(r *http.Request) http.Header
+
+	// sanitizes the messages of the errors written by the built-in handlers, nil means identity.
+	sanitizer func(message string) string
+
+	// charset of the HTML and plain text responses of the built-in handlers, empty means utf-8.
+	charset string
+}
+
+// Default header name used by [WithDebugHeader].
+const DefaultDebugHeader = "X-Centra-Handler"
+
+// Makes [Error] write a header called name, or [DefaultDebugHeader] if name is empty, identifying
+// the handler selected for the error, see [MatchedName]. The header is written before calling the
+// handler, so the handler may still remove it.
+//
+// The header exposes the names and messages of the registered errors, it's meant to be used
+// during development and should be left disabled in production, which is the default.
+func WithDebugHeader(name string) Option {
+	if name == "" {
+		name = DefaultDebugHeader
+	}
+	return func(c *config) {
+		c.debugHeader = name
+	}
+}
+
+// Makes [Mux.Handle] panic when it's called with an error identical (==) to an error that is
+// already registered.
+//
+// By default registering the same error twice is allowed and the last registered handler wins.
+func WithStrictDuplicates() Option {
+	return WithOnDuplicate(func(err error) {
+		panic(fmt.Sprintf("centra: duplicate handler registration for error: %v", err))
+	})
+}
+
+// Calls fn from [Mux.Handle] when it's called with an error identical (==) to an error that is
+// already registered, the registration still takes place after fn returns.
+//
+// Useful for logging duplicated registrations instead of panicking like [WithStrictDuplicates].
+func WithOnDuplicate(fn func(err error)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.onDuplicate = fn
+	}
+}
+
+// identical reports whether a == b, without panicking if they are not comparable.
+func identical(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb || !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Makes the registration methods, like [Mux.Handle], panic when they are called with a non-nil
+// error holding a nil pointer, like a var of type *MyError that was never assigned, since such an
+// error passes the nil check but is almost always a mistake, it only matches the errors holding
+// the same nil pointer.
+//
+// By default the errors holding nil pointers are registered like any other error.
+func WithStrictNilErrors() Option {
+	return func(c *config) {
+		c.strictNil = true
+	}
+}
+
+// Makes the registration methods, like [Mux.Handle], panic when the Mux already has n handlers,
+// see [Mux.Len], as a guardrail against runaway registrations, like a loop registering a handler
+// per request by mistake. By default the number of handlers is unlimited.
+func WithMaxHandlers(n int) Option {
+	if n <= 0 {
+		panic("centra: n must be greater than 0")
+	}
+	return func(c *config) {
+		c.maxHandlers = n
+	}
+}
+
+// typedNil reports whether err is a non-nil error holding a nil pointer, map, slice, func or chan.
+func typedNil(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch v := reflect.ValueOf(err); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// Makes [Error] skip handling the error if the context of the request is already done, usually
+// because the client disconnected, since writing the response would be pointless. If onCancel is
+// not nil, it's called instead of the handler with the request and the error.
+//
+// By default errors are handled regardless of the state of the request's context.
+func WithSkipOnCancel(onCancel func(r *http.Request, err error)) Option {
+	return func(c *config) {
+		c.skipOnCancel = true
+		c.onCancel = onCancel
+	}
+}
+
+// Makes [Error] call fn before the UnknownHandler handles an error, including nil errors and the
+// errors that reach the UnknownHandler of a parent Mux, so the errors that were not registered by
+// mistake can be logged loudly or fail tests instead of being silently handled as 500 Internal
+// Server Error. fn may panic.
+//
+// It's meant to be used during development and tests, by default the UnknownHandler is called
+// silently.
+func WithStrictUnknown(fn func(r *http.Request, err error)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.onUnknown = fn
+	}
+}
+
+// Makes [Error] select, among the matching handlers, the most specific one instead of the last
+// registered one. The most specific handler is the one whose match originates closest to the
+// error passed to Error in its Unwrap chain, so given
+//
+//	ErrBase := errors.New("base")
+//	ErrSpecific := fmt.Errorf("specific: %w", ErrBase)
+//
+// an error wrapping ErrSpecific is handled by the handler of ErrSpecific even if the one of
+// ErrBase was registered after it, while an error wrapping only ErrBase is still handled by the
+// handler of ErrBase. Registration order and the priorities given to [Mux.HandleP] only break
+// ties.
+//
+// It doesn't change the precedence of the handlers registered with [Mux.HandleExact] nor the one
+// of the errors joined with errors.Join, see [Mux.Handle]. Matching is slower, since the depth of
+// every matching handler has to be computed.
+func WithMostSpecific() Option {
+	return func(c *config) {
+		c.mostSpecific = true
+	}
+}
+
+// Makes the built-in handlers pass the message of the error being handled through fn before
+// writing it, as a security control against the secrets that sometimes leak into the messages,
+// like connection strings or tokens:
+//
+//	dsn := regexp.MustCompile(`postgres://\S+`)
+//	centra.WithSanitizer(func(message string) string {
+//		return dsn.ReplaceAllString(message, "postgres://[REDACTED]")
+//	})
+//
+// It applies to the messages included by [WithVerboseErrors], along with their annotations, see
+// [Annotate], before they are truncated by [WithMaxDetailLength], and to the Message of the
+// [TemplateData] of [TemplateHandler]. By default the messages are written as is.
+func WithSanitizer(fn func(message string) string) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.sanitizer = fn
+	}
+}
+
+// Makes the built-in handlers include the message of the error being handled in their responses
+// if verbose is true: [DefaultUnknownHandler], [DefaultUnknownJSONHandler], [NegotiatingHandler]
+// and the "detail" member of [ProblemDetailsHandler]. It's meant to be used during development,
+// the messages may leak internal details, so it's disabled by default.
+func WithVerboseErrors(verbose bool) Option {
+	return func(c *config) {
+		c.verbose = verbose
+	}
+}
+
+// Truncates the messages included by the built-in handlers when [WithVerboseErrors] is enabled to
+// n bytes, ellipsis "..." included, so a huge message, like the one of a validation error listing
+// thousands of items, doesn't produce an oversized response. By default messages are not
+// truncated.
+func WithMaxDetailLength(n int) Option {
+	if n <= 0 {
+		panic("centra: n must be greater than 0")
+	}
+	return func(c *config) {
+		c.maxDetailLength = n
+	}
+}
+
+// Sets handler as the UnknownHandler of the new Mux instead of [DefaultUnknown], for example
+// [DefaultUnknownJSONHandler] for JSON-only services. It can be changed later with
+// [Mux.UnknownHandler].
+func WithUnknownHandler(handler ErrorHandlerFunc) Option {
+	if handler == nil {
+		panic("centra: handler must not be nil")
+	}
+	return func(c *config) {
+		c.unknown = handler
+	}
+}
+
+// Sets fn to choose the handler of the errors that reach the UnknownHandler per request, for
+// example to render the 500 page with the branding of the tenant resolved by a previous
+// middleware. If fn returns nil, the UnknownHandler is called as usual. fn is only called when
+// the UnknownHandler is selected, and only the fn of the Mux whose UnknownHandler is selected is
+// called, see [Mux.WithParent].
+func WithUnknownSelector(fn func(r *http.Request) ErrorHandlerFunc) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.unknownSelector = fn
+	}
+}
+
+// Makes [Error] log every non-nil error it handles to logger, at error level, with the message
+// of the error as "error" and the name of the handler selected for it as "handler", see
+// [MatchedName], so the logs can be correlated with the registrations:
+//
+//	level=ERROR msg="centra: error handled" error="query user: connection refused" handler=unknown
+//
+// The errors registered with [Mux.HandleExpected] are logged at info level instead. By default
+// nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	if logger == nil {
+		panic("centra: logger must not be nil")
+	}
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// Function called by [Error] with every non-nil error it handles, along with the name of the
+// handler selected for it, the one returned by [MatchedName], see [WithLoggerFunc].
+type LoggerFunc func(r *http.Request, err error, label string)
+
+// Makes [Error] call fn with every non-nil error it handles, for the logging libraries other than
+// log/slog, like [WithLogger] does. Both can be used at the same time, and the sampling set with
+// [WithSampledLogging] applies to both. fn is not called for the errors registered with
+// [Mux.HandleExpected].
+func WithLoggerFunc(fn LoggerFunc) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.loggerFunc = fn
+	}
+}
+
+// Makes the logger set with [WithLogger] include, for the errors that reach the UnknownHandler,
+// the messages of all the errors in their chain as "chain", see [Chainf], which helps finding out
+// why a wrapped error didn't match any registered error.
+func WithChainLogging() Option {
+	return func(c *config) {
+		c.logChain = true
+	}
+}
+
+// Makes the logger set with [WithLogger] log only one in every N occurrences of the errors handled
+// by the same handler, N being every, the first one included, so an error storm, like when a
+// dependency goes down, doesn't flood the logs. The sampled logs include the number of
+// occurrences so far as "occurrences":
+//
+//	level=ERROR msg="centra: error handled" error="query user: connection refused" occurrences=11
+//
+// The errors reaching the UnknownHandler are counted together. By default every error is logged.
+func WithSampledLogging(every int) Option {
+	if every < 1 {
+		panic("centra: every must be greater than 0")
+	}
+	return func(c *config) {
+		c.logEvery = every
+	}
+}
+
+// Makes [Error] recover the panics of the handlers it calls, including the middlewares, for
+// example a bug in a template, calling fn with the request and the recovered value. If the
+// handler didn't write the response before panicking, a plain 500 Internal Server Error response
+// is written, so a buggy error page doesn't take down the request. The finalizers added with
+// [Mux.Finalize] are called as usual.
+//
+// http.ErrAbortHandler is never recovered, since it's meant to abort the request. By default the
+// panics are not recovered.
+func WithHandlerRecovery(fn func(r *http.Request, v any)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.onHandlerPanic = fn
+	}
+}
+
+// Makes [Error] write status, instead of 200 OK, when the selected handler writes the body without
+// calling WriteHeader first, so an error body that forgot its status code, like the one of a
+// handler only calling json.NewEncoder(w).Encode(body), isn't sent as a successful response:
+//
+//	errMux := centra.NewMux(centra.WithImplicitStatus(http.StatusInternalServerError))
+//
+// The handlers calling WriteHeader are not affected. By default the status code is 200 OK, like
+// net/http does.
+func WithImplicitStatus(status int) Option {
+	if status < 200 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
+	}
+	return func(c *config) {
+		c.implicitStatus = status
+	}
+}
+
+// Makes [Error] set the Content-Type of the response to contentType, for example
+// "text/plain; charset=utf-8", when the selected handler writes the header, or the body, without
+// setting one, instead of letting net/http sniff it from the body, which may guess wrong for
+// error bodies and surprise the security headers expectations, like X-Content-Type-Options.
+//
+// An explicit Content-Type is never overridden, including an empty one set with
+// w.Header()["Content-Type"] = nil to disable sniffing, and the responses with status codes that
+// don't allow a body, 204 and 304, are not affected. By default the Content-Type is sniffed.
+func WithDefaultContentType(contentType string) Option {
+	if contentType == "" {
+		panic("centra: contentType must not be empty")
+	}
+	return func(c *config) {
+		c.defaultContentType = contentType
+	}
+}
+
+// Makes [Mux.GuardSuccess] log the calls to [Error] made after a successful response to the
+// logger set with [WithLogger], or to slog.Default() if there is none, instead of panicking, for
+// the environments where a panic is too disruptive, like staging.
+func WithGuardLogging() Option {
+	return func(c *config) {
+		c.guardLogging = true
+	}
+}
+
+// Makes [Error] set header on every error response before calling the handler, including the
+// UnknownHandler, replacing the values already set for the same keys, so the response hygiene is
+// centralized instead of repeated in every handler:
+//
+//	centra.WithDefaultHeaders(http.Header{
+//		"X-Content-Type-Options": {"nosniff"},
+//		"Vary":                   {"Accept"},
+//	})
+//
+// The handlers may still override or remove them. header is copied, changing it afterwards has no
+// effect.
+func WithDefaultHeaders(header http.Header) Option {
+	headers := make(http.Header, len(header))
+	for k, v := range header {
+		headers[http.CanonicalHeaderKey(k)] = slices.Clone(v)
+	}
+	return func(c *config) {
+		c.defaultHeaders = headers
+	}
+}
+
+// Makes [Error] set the headers returned by fn for the request on every error response, before
+// calling the handler, including the UnknownHandler, so the browsers let the cross-origin clients
+// read the error responses too, not only the successful ones:
+//
+//	centra.WithCORSHeaders(func(r *http.Request) http.Header {
+//		origin := r.Header.Get("Origin")
+//		if !allowedOrigins[origin] {
+//			return nil
+//		}
+//		return http.Header{
+//			"Access-Control-Allow-Origin": {origin},
+//			"Vary":                        {"Origin"},
+//		}
+//	})
+//
+// They replace the values already set for the same keys, including the ones of
+// [WithDefaultHeaders], and a nil header sets nothing. The handlers may still override or remove
+// them.
+func WithCORSHeaders(fn func(r *http.Request) http.Header) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.corsHeaders = fn
+	}
+}
+
+// Makes [Error] log a hint, at warn level, when an error reaching the UnknownHandler contains the
+// message of a registered error without matching it, which is often a wrapping mistake, like
+// formatting the sentinel with %v instead of %w, or a custom error type missing its Unwrap method:
+//
+//	errMux.Handle(ErrNotFound, NotFoundHandler(""))
+//	centra.Error(w, r, fmt.Errorf("loading user: %v", ErrNotFound)) // hint for ErrNotFound
+//
+// The hint is logged to the logger set with [WithLogger], or to slog.Default() if there is none.
+// It's a heuristic comparing the messages of all the registered errors, including the ones of
+// the parents, it's meant to be used during development and should be left disabled in
+// production, which is the default.
+func WithNearMissHints() Option {
+	return func(c *config) {
+		c.nearMissHints = true
+	}
+}
+
+// Makes the built-in handlers that write the status text of the status code, like
+// [NegotiatingHandler], [DefaultUnknownHandler] and the "title" of [ProblemDetailsHandler],
+// localize it with fn, which is called with the languages accepted by the client, as found in the
+// Accept-Language header, in order of preference, then with [DefaultLocale], until it returns a
+// non-empty text:
+//
+//	centra.WithStatusText(func(lang string, code int) string {
+//		return statusTexts[lang][code] // "Página no encontrada" for "es" and 404
+//	})
+//
+// If fn returns an empty text for all of them, the English one of http.StatusText is written as
+// usual. The "error" member of the JSON responses is meant for machines and is not localized.
+func WithStatusText(fn func(lang string, code int) string) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.statusText = fn
+	}
+}
+
+// Makes [Error] run the selected handler, along with the middlewares, against an in-memory buffer
+// if buffered is true, and copy the buffered response to the client's writer only once the handler
+// returns, so a handler panicking midway, for example in the middle of a template, never leaves a
+// half-written body. Along with [WithHandlerRecovery], the partial response is discarded and a
+// clean 500 is written instead, otherwise the panic is propagated as usual.
+//
+// It trades a copy of every response for correctness, which is usually fine for error pages, but
+// the handlers streaming their responses, like [SSEHandler], can't flush them while buffered. By
+// default the handlers write to the client's writer directly.
+func WithBufferedHandlers(buffered bool) Option {
+	return func(c *config) {
+		c.buffered = buffered
+	}
+}
+
+// Makes [Error] give the selected handler, along with the middlewares, at most d to render the
+// response, bounding the worst-case latency of the error responses, like the ones rendering a
+// huge template. The handler is run in its own goroutine, with the context of the request
+// canceled after d, and if it has not written the header by then, a minimal 503 Service
+// Unavailable plain text response is written instead, like [http.TimeoutHandler] does.
+//
+// Once d elapses, Error returns and the writes of the handler fail with [http.ErrHandlerTimeout],
+// so the handlers must be cancellation-aware, returning when the context of the request is done,
+// for a clean behavior, otherwise they keep running in the background and their panics are lost.
+// If the handler has already written the header by then, the response is left as is. The handler
+// can use http.ResponseController as usual until d elapses, flushing fails with
+// http.ErrHandlerTimeout and the other capabilities are reported as not supported afterwards. By
+// default the handlers are not bounded.
+func WithRenderTimeout(d time.Duration) Option {
+	if d <= 0 {
+		panic("centra: d must be greater than 0")
+	}
+	return func(c *config) {
+		c.renderTimeout = d
+	}
+}
+
+// Makes the built-in handlers declare charset, instead of utf-8, in the Content-Type of their HTML
+// and plain text responses, as in "text/html; charset=iso-8859-1", for the clients that don't
+// decode utf-8. The bodies themselves are not transcoded, the templates given to
+// [TemplateHandler] and the localizations set with [WithStatusText] must produce them.
+func WithCharset(charset string) Option {
+	if charset == "" {
+		panic("centra: charset must not be empty")
+	}
+	return func(c *config) {
+		c.charset = charset
+	}
+}
+
+// Makes the built-in handlers call fn with the request and the error returned by writing the body
+// of the response when it fails, most likely because the client is gone, which is discarded by
+// default, so the client disconnections can be told apart from the rendering failures. The
+// custom handlers can report their write failures too with [MustWrite]. The errors returned by
+// marshaling the JSON responses are reported to fn too, see [WriteJSON].
+func WithWriteErrorHook(fn func(r *http.Request, err error)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.writeErrorHook = fn
+	}
+}
+
+// Makes the built-in handlers whose response only depends on their arguments, [FileHandler] and
+// [TemplateHandler], set a weak ETag computed from the rendered body, and write a 304 Not Modified
+// response without body instead when the If-None-Match header of the request matches it, so the
+// clients can cache static error pages, like a maintenance page, saving bandwidth on repeated
+// displays. The other handlers, whose body depends on the error, are not affected.
+//
+// A TemplateHandler rendering the message of the error or the path of the request gets a
+// different ETag for every different body, so it's only worth it for the static templates. By
+// default no ETag is set.
+func WithETags() Option {
+	return func(c *config) {
+		c.etags = true
+	}
+}
+
+// Makes the built-in handlers that render a body, like [TemplateHandler], [NegotiatingHandler],
+// [ProblemDetailsHandler] and [DefaultUnknownHandler], write a minimal 503 Service Unavailable
+// plain text response instead when less than minRemaining is left before the deadline of the
+// context of the request, as read from the clock set with [WithClock], so the rendering is
+// skipped under load shedding, when the response would likely arrive too late anyway.
+//
+// The requests without deadline are not affected. By default the responses are rendered
+// regardless of the deadline.
+func WithDeadlineGuard(minRemaining time.Duration) Option {
+	if minRemaining <= 0 {
+		panic("centra: minRemaining must be greater than 0")
+	}
+	return func(c *config) {
+		c.deadlineGuard = minRemaining
+	}
+}
+
+// Makes [Error] let the errors that have a [Renderer] in their chain, as reported by errors.As,
+// render themselves by calling their RenderError method, before consulting any registered
+// handler, so domain errors can own their HTTP representation while the rest are handled
+// centrally. [Matched] returns the Renderer found for the errors rendered this way, and
+// [MatchedName] the name of its type, like "*app.OutOfStockError", so the metrics and the logs
+// labeled by name keep a low cardinality.
+//
+// The middlewares and finalizers are called as usual. By default the Renderer errors are handled
+// like any other error.
+func WithSelfRendering() Option {
+	return func(c *config) {
+		c.selfRendering = true
+	}
+}
+
+// Sets fn as the audit sink of the Mux, called with the request and the error being handled
+// whenever [Error] selects a handler registered in the Mux with [Mux.HandleAudited], before
+// calling it. By default the audited errors are not reported.
+func WithAuditSink(fn func(r *http.Request, err error)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.auditSink = fn
+	}
+}
+
+// Sets fn to map the errors that don't match any registered handler to a status code, avoiding
+// registering a handler per error when the only thing that changes between them is the status
+// code. If fn returns true, the error is handled by [NegotiatingHandler] with the returned
+// status, otherwise it's handled as usual, by the parent Mux if any, or by the UnknownHandler.
+//
+// Handlers registered in the Mux always win over fn, [Matched] returns a placeholder error whose
+// message is "centra: errors mapped to status N" for the errors mapped by fn. fn must return a
+// valid status code when it returns true.
+func WithStatusMapper(fn func(err error) (int, bool)) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.statusMapper = fn
+	}
+}
+
+// mappedHandler returns the handler of the errors mapped to status by the status mapper.
+func mappedHandler(status int) handlerStruct {
+	if status < 100 || status > 999 {
+		panic("centra: status mapper returned invalid status code " + strconv.Itoa(status))
+	}
+	return handlerStruct{
+		err:     statusError{status: status},
+		handler: NegotiatingHandler(status),
+	}
+}
+
+// statusError is the placeholder registered error of the errors mapped by the status mapper, and
+// of the handlers registered with Mux.HandleStatus.
+type statusError struct {
+	status int
+}
+
+func (e statusError) Error() string {
+	return "centra: errors mapped to status " + strconv.Itoa(e.status)
+}
+
+// Sets fn to extract the request (or correlation) ID of the requests, so the handlers can get it
+// with [RequestID] without knowing where the router or the framework in use stores it. The
+// built-in handlers that render a body with room for it, like [ProblemDetailsHandler], include it.
+func WithRequestID(fn func(r *http.Request) string) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.requestID = fn
+	}
+}
+
+// Returns the ID of r as extracted by the function given to [WithRequestID] for the Mux handling
+// r, or an empty string if there is no such Mux or it has no function to extract it.
+func RequestID(r *http.Request) string {
+	for _, m := range [...]*Mux{getDispatchInfo(r).mux, getMux(r)} {
+		if m != nil && m.cfg.requestID != nil {
+			return m.cfg.requestID(r)
+		}
+	}
+	return ""
+}
+
+// Sets fn as the clock of the Mux, used instead of time.Now by the built-in handlers and
+// middlewares that depend on the current time, like [RetryAtHandler] and [MeasureLatency], so
+// they can be tested deterministically with a frozen clock. Custom handlers can read it with
+// [Now]. By default the clock is time.Now.
+func WithClock(fn func() time.Time) Option {
+	if fn == nil {
+		panic("centra: fn must not be nil")
+	}
+	return func(c *config) {
+		c.clock = fn
+	}
+}
+
+// Returns the current time as reported by the clock given to [WithClock] for the Mux handling r,
+// or time.Now() if there is no such Mux or it has no clock.
+func Now(r *http.Request) time.Time {
+	for _, m := range [...]*Mux{getDispatchInfo(r).mux, getMux(r)} {
+		if m != nil && m.cfg.clock != nil {
+			return m.cfg.clock()
+		}
+	}
+	return time.Now()
+}
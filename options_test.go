@@ -0,0 +1,1862 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type errUncomparable []string
+
+func (e errUncomparable) Error() string {
+	return "uncomparable"
+}
+
+func TestDuplicates(t *testing.T) {
+	noopHandler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	errA := errors.New("A")
+
+	testCases := map[string]struct {
+		Opts []Option
+		Errs []error
+
+		// registers a WithOnDuplicate hook counting the duplicates
+		CountDuplicates bool
+
+		ExpectedDuplicates int
+		ExpectedPanic      bool
+	}{
+		"Permissive_Default": {
+			Errs: []error{errA, errA},
+
+			ExpectedPanic: false,
+		},
+		"Strict_Duplicate": {
+			Opts: []Option{WithStrictDuplicates()},
+			Errs: []error{errA, errA},
+
+			ExpectedPanic: true,
+		},
+		"Strict_Not_Identical": {
+			Opts: []Option{WithStrictDuplicates()},
+			// same message, but different errors
+			Errs: []error{errA, errors.New("A"), errString("A")},
+
+			ExpectedPanic: false,
+		},
+		"Strict_Uncomparable": {
+			Opts: []Option{WithStrictDuplicates()},
+			Errs: []error{errUncomparable{"A"}, errUncomparable{"A"}},
+
+			ExpectedPanic: false,
+		},
+		"Hook_Duplicate": {
+			Errs:            []error{errA, errString("B"), errA, errString("B")},
+			CountDuplicates: true,
+
+			ExpectedDuplicates: 2,
+			ExpectedPanic:      false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tc.ExpectedPanic && r == nil {
+					t.Fatalf("expected to panic, did not panic")
+				} else if !tc.ExpectedPanic && r != nil {
+					t.Fatalf("expected to not panic, did panic: %v", r)
+				}
+			}()
+
+			duplicates := 0
+			opts := tc.Opts
+			if tc.CountDuplicates {
+				opts = append(opts, WithOnDuplicate(func(err error) {
+					duplicates++
+				}))
+			}
+
+			errMux := NewMux(opts...)
+			for _, err := range tc.Errs {
+				errMux.Handle(err, noopHandler)
+			}
+
+			if tc.ExpectedDuplicates != duplicates {
+				t.Fatalf("expected %d duplicates, got %d", tc.ExpectedDuplicates, duplicates)
+			}
+		})
+	}
+}
+
+func TestWithDebugHeader(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+		Err  error
+
+		ExpectedHeaderName string
+		ExpectedHeader     string
+	}{
+		"Disabled": {
+			Err: errString("A"),
+
+			ExpectedHeaderName: DefaultDebugHeader,
+			ExpectedHeader:     "",
+		},
+		"Named": {
+			Opts: []Option{WithDebugHeader("")},
+			Err:  errString("A"),
+
+			ExpectedHeaderName: DefaultDebugHeader,
+			ExpectedHeader:     "a_error",
+		},
+		"Unnamed": {
+			Opts: []Option{WithDebugHeader("")},
+			Err:  errString("B"),
+
+			ExpectedHeaderName: DefaultDebugHeader,
+			ExpectedHeader:     "B",
+		},
+		"Unknown": {
+			Opts: []Option{WithDebugHeader("X-Debug")},
+			Err:  errString("C"),
+
+			ExpectedHeaderName: "X-Debug",
+			ExpectedHeader:     UnknownName,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.HandleNamed("a_error", errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if h := recorder.Header().Get(tc.ExpectedHeaderName); tc.ExpectedHeader != h {
+				t.Fatalf("expected header %s, got %s", tc.ExpectedHeader, h)
+			}
+		})
+	}
+}
+
+func TestWithSkipOnCancel(t *testing.T) {
+	testCases := map[string]struct {
+		Opts     func(canceled *int) []Option
+		Canceled bool
+
+		ExpectedBuf      string
+		ExpectedCanceled int
+	}{
+		"Disabled_Canceled": {
+			Opts:     func(canceled *int) []Option { return nil },
+			Canceled: true,
+
+			ExpectedBuf: "1",
+		},
+		"Enabled_Canceled": {
+			Opts: func(canceled *int) []Option {
+				return []Option{WithSkipOnCancel(func(r *http.Request, err error) {
+					*canceled++
+				})}
+			},
+			Canceled: true,
+
+			ExpectedBuf:      "",
+			ExpectedCanceled: 1,
+		},
+		"Enabled_Nil_Hook": {
+			Opts:     func(canceled *int) []Option { return []Option{WithSkipOnCancel(nil)} },
+			Canceled: true,
+
+			ExpectedBuf: "",
+		},
+		"Enabled_Not_Canceled": {
+			Opts: func(canceled *int) []Option {
+				return []Option{WithSkipOnCancel(func(r *http.Request, err error) {
+					*canceled++
+				})}
+			},
+			Canceled: false,
+
+			ExpectedBuf: "1",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			canceled := 0
+
+			errMux := NewMux(tc.Opts(&canceled)...)
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "1")
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.Canceled {
+				cancel()
+			}
+
+			req := SetMux(httptest.NewRequest("", "/", nil).WithContext(ctx), errMux)
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, errString("A"))
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if tc.ExpectedCanceled != canceled {
+				t.Fatalf("expected hook to be called %d times, got %d", tc.ExpectedCanceled, canceled)
+			}
+		})
+	}
+}
+
+func TestWithStatusMapper(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errConflict := errors.New("conflict")
+	errRegistered := errors.New("registered")
+
+	mapper := func(err error) (int, bool) {
+		switch {
+		case errors.Is(err, errNotFound):
+			return http.StatusNotFound, true
+		case errors.Is(err, errConflict), errors.Is(err, errRegistered):
+			return http.StatusConflict, true
+		}
+		return 0, false
+	}
+
+	testCases := map[string]struct {
+		Err    error
+		Accept string
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Mapped_HTML": {
+			Err: errNotFound,
+
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "<h1>Not Found</h1>",
+		},
+		"Mapped_JSON_Wrapped": {
+			Err:    fmt.Errorf("wrapped: %w", errConflict),
+			Accept: "application/json",
+
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    `{"error":"conflict"}`,
+		},
+		"Registered_Wins": {
+			Err: errRegistered,
+
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "registered",
+		},
+		"Unmapped_Unknown": {
+			Err: errors.New("other"),
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithStatusMapper(mapper))
+			errMux.Handle(errRegistered, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, "registered")
+			})
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithStrictUnknown(t *testing.T) {
+	errRegistered := errors.New("registered")
+	errMapped := errors.New("mapped")
+	errParent := errors.New("parent")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedCalls int
+	}{
+		"Registered": {
+			Err:           fmt.Errorf("wrapped: %w", errRegistered),
+			ExpectedCalls: 0,
+		},
+		"Mapped": {
+			Err:           errMapped,
+			ExpectedCalls: 0,
+		},
+		"Registered_In_Parent": {
+			Err:           errParent,
+			ExpectedCalls: 0,
+		},
+		"Unknown": {
+			Err:           errors.New("other"),
+			ExpectedCalls: 1,
+		},
+		"Nil_Error": {
+			Err:           nil,
+			ExpectedCalls: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			var got error
+			onUnknown := func(r *http.Request, err error) {
+				calls++
+				got = err
+			}
+			mapper := func(err error) (int, bool) {
+				return http.StatusNotFound, errors.Is(err, errMapped)
+			}
+
+			parent := NewMux()
+			parent.Handle(errParent, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			errMux := NewMux(WithStrictUnknown(onUnknown), WithStatusMapper(mapper))
+			errMux.WithParent(parent)
+			errMux.Handle(errRegistered, func(w http.ResponseWriter, r *http.Request, err error) {})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected %d calls, got %d", tc.ExpectedCalls, calls)
+			}
+			if calls > 0 && got != tc.Err {
+				t.Fatalf("expected error %v, got %v", tc.Err, got)
+			}
+			if calls > 0 && recorder.Code != http.StatusInternalServerError {
+				t.Fatalf("expected the UnknownHandler to still be called, got status %d", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestWithMostSpecific(t *testing.T) {
+	errBase := errors.New("base")
+	errSpecific := fmt.Errorf("specific: %w", errBase)
+	errMoreSpecific := fmt.Errorf("more specific: %w", errSpecific)
+	errTie := errors.New("tie")
+
+	testCases := map[string]struct {
+		Err          error
+		MostSpecific bool
+
+		ExpectedBuf string
+	}{
+		"Default_Last_Registered_Wins": {
+			Err:         fmt.Errorf("request: %w", errSpecific),
+			ExpectedBuf: "base",
+		},
+		"Specific_Over_General": {
+			Err:          fmt.Errorf("request: %w", errSpecific),
+			MostSpecific: true,
+			ExpectedBuf:  "specific",
+		},
+		"More_Specific_Over_Specific": {
+			Err:          errMoreSpecific,
+			MostSpecific: true,
+			ExpectedBuf:  "more specific",
+		},
+		"General_Only": {
+			Err:          fmt.Errorf("request: %w", errBase),
+			MostSpecific: true,
+			ExpectedBuf:  "base",
+		},
+		"Type_Handler_Depth": {
+			Err:          fmt.Errorf("request: %w", &annotatedError{err: errSpecific}),
+			MostSpecific: true,
+			ExpectedBuf:  "annotated type",
+		},
+		"Tie_Last_Registered_Wins": {
+			Err:          errTie,
+			MostSpecific: true,
+			ExpectedBuf:  "tie last",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var opts []Option
+			if tc.MostSpecific {
+				opts = append(opts, WithMostSpecific())
+			}
+			errMux := NewMux(opts...)
+
+			handler := func(body string) ErrorHandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, body)
+				}
+			}
+			HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err *annotatedError) {
+				io.WriteString(w, "annotated type")
+			})
+			errMux.Handle(errMoreSpecific, handler("more specific"))
+			errMux.Handle(errSpecific, handler("specific"))
+			errMux.Handle(errBase, handler("base"))
+			errMux.Handle(errTie, handler("tie first"))
+			errMux.Handle(errTie, handler("tie last"))
+
+			if tc.MostSpecific {
+				if err := errMux.Validate(); err != nil {
+					t.Fatalf("expected no shadowed handlers, got %v", err)
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithVerboseErrors(t *testing.T) {
+	errSecret := errors.New("dial tcp 10.0.0.1: <refused>")
+
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+		Accept  string
+
+		ExpectedQuiet   string
+		ExpectedVerbose string
+	}{
+		"DefaultUnknownHandler": {
+			Handler: DefaultUnknownHandler,
+
+			ExpectedQuiet:   "<h1>Internal Server Error</h1>",
+			ExpectedVerbose: "<h1>Internal Server Error</h1><p>wrapped: dial tcp 10.0.0.1: &lt;refused&gt;</p>",
+		},
+		"DefaultUnknownJSONHandler": {
+			Handler: DefaultUnknownJSONHandler,
+
+			ExpectedQuiet:   `{"error":"internal server error"}`,
+			ExpectedVerbose: `{"detail":"wrapped: dial tcp 10.0.0.1: \u003crefused\u003e","error":"internal server error"}`,
+		},
+		"NegotiatingHandler_JSON": {
+			Handler: NegotiatingHandler(http.StatusBadGateway),
+			Accept:  "application/json",
+
+			ExpectedQuiet:   `{"error":"bad gateway"}`,
+			ExpectedVerbose: `{"detail":"wrapped: dial tcp 10.0.0.1: \u003crefused\u003e","error":"bad gateway"}`,
+		},
+		"ProblemDetailsHandler": {
+			Handler: ProblemDetailsHandler(http.StatusBadGateway),
+
+			ExpectedQuiet:   `{"instance":"/","status":502,"title":"Bad Gateway","type":"about:blank"}`,
+			ExpectedVerbose: `{"detail":"wrapped: dial tcp 10.0.0.1: \u003crefused\u003e","instance":"/","status":502,"title":"Bad Gateway","type":"about:blank"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		for _, verbose := range []bool{false, true} {
+			t.Run(name+"_"+fmt.Sprint(verbose), func(t *testing.T) {
+				errMux := NewMux(WithVerboseErrors(verbose), WithUnknownHandler(tc.Handler))
+
+				req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+				req.Header.Set("Accept", tc.Accept)
+				recorder := httptest.NewRecorder()
+
+				Error(recorder, req, fmt.Errorf("wrapped: %w", errSecret))
+
+				expected := tc.ExpectedQuiet
+				if verbose {
+					expected = tc.ExpectedVerbose
+				}
+				if expected != recorder.Body.String() {
+					t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestWithMaxDetailLength(t *testing.T) {
+	huge := errors.New(strings.Repeat("x", 10*1024))
+
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+		Accept  string
+
+		ExpectedBuf string
+	}{
+		"HTML": {
+			Handler:     DefaultUnknownHandler,
+			ExpectedBuf: "<h1>Internal Server Error</h1><p>" + strings.Repeat("x", 97) + "...</p>",
+		},
+		"JSON": {
+			Handler:     DefaultUnknownJSONHandler,
+			ExpectedBuf: `{"detail":"` + strings.Repeat("x", 97) + `...","error":"internal server error"}`,
+		},
+		"NegotiatingHandler_JSON": {
+			Handler:     NegotiatingHandler(http.StatusInternalServerError),
+			Accept:      "application/json",
+			ExpectedBuf: `{"detail":"` + strings.Repeat("x", 97) + `...","error":"internal server error"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(true), WithMaxDetailLength(100), WithUnknownHandler(tc.Handler))
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, huge)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithUnknownHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Status int
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Default_Status": {
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    `{"error":"internal server error"}`,
+		},
+		"Hinted_Status": {
+			Status:         http.StatusServiceUnavailable,
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedBuf:    `{"error":"service unavailable"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithUnknownHandler(DefaultUnknownJSONHandler))
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			recorder := httptest.NewRecorder()
+			if tc.Status != 0 {
+				ErrorStatus(recorder, req, tc.Status, errors.New("secret details"))
+			} else {
+				Error(recorder, req, errors.New("secret details"))
+			}
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("expected Content-Type application/json, got %s", ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithUnknownSelector(t *testing.T) {
+	type keyTenant struct{}
+
+	testCases := map[string]struct {
+		Tenant string
+		Err    error
+
+		ExpectedBuf   string
+		ExpectedCalls int
+	}{
+		"Tenant_Page": {
+			Tenant:        "acme",
+			Err:           errString("other"),
+			ExpectedBuf:   "acme 500",
+			ExpectedCalls: 1,
+		},
+		"Selector_Returns_Nil": {
+			Err:           errString("other"),
+			ExpectedBuf:   "static 500",
+			ExpectedCalls: 1,
+		},
+		"Registered_Not_Consulted": {
+			Tenant:        "acme",
+			Err:           errString("A"),
+			ExpectedBuf:   "A",
+			ExpectedCalls: 0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			selector := func(r *http.Request) ErrorHandlerFunc {
+				calls++
+				tenant, _ := r.Context().Value(keyTenant{}).(string)
+				if tenant == "" {
+					return nil
+				}
+				return func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, tenant+" 500")
+				}
+			}
+
+			errMux := NewMux(WithUnknownSelector(selector))
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "static 500")
+			})
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "A")
+			})
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req = req.WithContext(context.WithValue(req.Context(), keyTenant{}, tc.Tenant))
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if tc.ExpectedCalls != calls {
+				t.Fatalf("expected %d selector calls, got %d", tc.ExpectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestWithHandlerRecovery(t *testing.T) {
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+
+		ExpectedRecovered any
+		ExpectedStatus    int
+		ExpectedBuf       string
+	}{
+		"Panics": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				panic("template bug")
+			},
+
+			ExpectedRecovered: "template bug",
+			ExpectedStatus:    http.StatusInternalServerError,
+			ExpectedBuf:       "Internal Server Error",
+		},
+		"Panics_After_Writing": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "half")
+				panic("template bug")
+			},
+
+			ExpectedRecovered: "template bug",
+			ExpectedStatus:    http.StatusNotFound,
+			ExpectedBuf:       "half",
+		},
+		"No_Panic": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+
+			ExpectedRecovered: nil,
+			ExpectedStatus:    http.StatusNotFound,
+			ExpectedBuf:       "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var recovered any
+			var finalized bool
+
+			errMux := NewMux(WithHandlerRecovery(func(r *http.Request, v any) {
+				recovered = v
+			}))
+			errMux.Handle(errString("A"), tc.Handler)
+			errMux.Finalize(func(w http.ResponseWriter, r *http.Request, err error) {
+				finalized = true
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedRecovered != recovered {
+				t.Fatalf("expected recovered %v, got %v", tc.ExpectedRecovered, recovered)
+			}
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if !finalized {
+				t.Fatalf("expected finalizer to be called")
+			}
+		})
+	}
+
+	t.Run("ErrAbortHandler", func(t *testing.T) {
+		errMux := NewMux(WithHandlerRecovery(func(r *http.Request, v any) {
+			t.Fatalf("expected http.ErrAbortHandler not to be recovered")
+		}))
+		errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+			panic(http.ErrAbortHandler)
+		})
+
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Fatalf("expected panic %v, got %v", http.ErrAbortHandler, r)
+			}
+		}()
+		Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+	})
+}
+
+func TestWithImplicitStatus(t *testing.T) {
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler ErrorHandlerFunc
+
+		ExpectedStatus int
+	}{
+		"Write_Only": {
+			Opts: []Option{WithImplicitStatus(http.StatusInternalServerError)},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, `{"error":"oops"}`)
+			},
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+		"WriteHeader": {
+			Opts: []Option{WithImplicitStatus(http.StatusInternalServerError)},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "not found")
+			},
+			ExpectedStatus: http.StatusNotFound,
+		},
+		"Nested_Mux": {
+			Opts: []Option{WithImplicitStatus(http.StatusInternalServerError)},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				inner := NewMux(WithImplicitStatus(http.StatusBadGateway))
+				inner.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {
+					io.WriteString(w, "bad gateway")
+				})
+				Error(w, SetMux(r, inner), errString("B"))
+			},
+			ExpectedStatus: http.StatusBadGateway,
+		},
+		"Disabled": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "ok?")
+			},
+			ExpectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	extractor := WithRequestID(func(r *http.Request) string {
+		return r.Header.Get("X-Request-Id")
+	})
+
+	testCases := map[string]struct {
+		Opts []Option
+
+		ExpectedID string
+	}{
+		"Extractor": {
+			Opts:       []Option{extractor},
+			ExpectedID: "abc-123",
+		},
+		"No_Extractor": {
+			ExpectedID: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got string
+
+			errMux := NewMux(tc.Opts...)
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				got = RequestID(r)
+			})
+
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req.Header.Set("X-Request-Id", "abc-123")
+
+			Error(httptest.NewRecorder(), req, errString("A"))
+
+			if tc.ExpectedID != got {
+				t.Fatalf("expected request ID %s, got %s", tc.ExpectedID, got)
+			}
+		})
+	}
+
+	if id := RequestID(httptest.NewRequest("", "/", nil)); id != "" {
+		t.Fatalf("expected empty request ID without Mux, got %s", id)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	frozen := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		Opts []Option
+
+		ExpectedFrozen bool
+	}{
+		"Frozen": {
+			Opts:           []Option{WithClock(func() time.Time { return frozen })},
+			ExpectedFrozen: true,
+		},
+		"Default": {
+			ExpectedFrozen: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+
+			var now time.Time
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				now = Now(r)
+			})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedFrozen != now.Equal(frozen) {
+				t.Fatalf("expected frozen clock %t, got %v", tc.ExpectedFrozen, now)
+			}
+			if now.IsZero() {
+				t.Fatal("expected Now to return the current time")
+			}
+		})
+	}
+}
+
+func TestWithAuditSink(t *testing.T) {
+	errUnauthorized := errors.New("unauthorized")
+	errForbidden := errors.New("forbidden")
+	errNotFound := errors.New("not found")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedAudited bool
+	}{
+		"Audited": {
+			Err:             errUnauthorized,
+			ExpectedAudited: true,
+		},
+		"Audited_Wrapped_Handler_Not_Writing": {
+			Err:             fmt.Errorf("reading file: %w", errForbidden),
+			ExpectedAudited: true,
+		},
+		"Not_Audited": {
+			Err:             errNotFound,
+			ExpectedAudited: false,
+		},
+		"Unknown": {
+			Err:             errors.New("unknown"),
+			ExpectedAudited: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var audited []error
+			errMux := NewMux(WithAuditSink(func(r *http.Request, err error) {
+				audited = append(audited, err)
+			}))
+			errMux.HandleAudited(errUnauthorized, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusUnauthorized)
+			})
+			errMux.HandleAudited(errForbidden, func(w http.ResponseWriter, r *http.Request, err error) {})
+			errMux.Handle(errNotFound, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if !tc.ExpectedAudited {
+				if len(audited) != 0 {
+					t.Fatalf("expected no audited errors, got %v", audited)
+				}
+				return
+			}
+			if len(audited) != 1 || audited[0] != tc.Err {
+				t.Fatalf("expected %v to be audited once, got %v", tc.Err, audited)
+			}
+		})
+	}
+}
+
+type nilPointerError struct{}
+
+func (*nilPointerError) Error() string { return "nil pointer error" }
+
+func TestWithStrictNilErrors(t *testing.T) {
+	var errNilPointer *nilPointerError
+	handler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Opts []Option
+		Call func(m *Mux)
+
+		ExpectedPanic any
+	}{
+		"Handle": {
+			Opts:          []Option{WithStrictNilErrors()},
+			Call:          func(m *Mux) { m.Handle(errNilPointer, handler) },
+			ExpectedPanic: "centra: err passed to Handle() is a nil *centra.nilPointerError, it can never be matched meaningfully",
+		},
+		"HandleExact": {
+			Opts:          []Option{WithStrictNilErrors()},
+			Call:          func(m *Mux) { m.HandleExact(errNilPointer, handler) },
+			ExpectedPanic: "centra: err passed to HandleExact() is a nil *centra.nilPointerError, it can never be matched meaningfully",
+		},
+		"Nil_Map": {
+			Opts:          []Option{WithStrictNilErrors()},
+			Call:          func(m *Mux) { m.Handle(errValidation(nil), handler) },
+			ExpectedPanic: "centra: err passed to Handle() is a nil centra.errValidation, it can never be matched meaningfully",
+		},
+		"Non_Nil_Pointer": {
+			Opts: []Option{WithStrictNilErrors()},
+			Call: func(m *Mux) { m.Handle(&nilPointerError{}, handler) },
+		},
+		"Value": {
+			Opts: []Option{WithStrictNilErrors()},
+			Call: func(m *Mux) { m.Handle(errString("A"), handler) },
+		},
+		"Disabled": {
+			Call: func(m *Mux) { m.Handle(errNilPointer, handler) },
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); tc.ExpectedPanic != r {
+					t.Fatalf("expected panic %v, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			tc.Call(NewMux(tc.Opts...))
+		})
+	}
+}
+
+func TestWithMaxHandlers(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Register int
+
+		ExpectedPanic any
+	}{
+		"Below_Max": {
+			Register: 2,
+		},
+		"At_Max": {
+			Register: 3,
+		},
+		"Above_Max": {
+			Register:      4,
+			ExpectedPanic: "centra: cannot call Handle(), the Mux already has the maximum of 3 handlers",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithMaxHandlers(3))
+
+			defer func() {
+				if r := recover(); tc.ExpectedPanic != r {
+					t.Fatalf("expected panic %v, got %v", tc.ExpectedPanic, r)
+				}
+				if n := errMux.Len(); n > 3 {
+					t.Fatalf("expected at most 3 handlers, got %d", n)
+				}
+			}()
+
+			for i := 0; i < tc.Register; i++ {
+				errMux.Handle(errString(strconv.Itoa(i)), handler)
+			}
+		})
+	}
+}
+
+func TestWithDefaultContentType(t *testing.T) {
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler ErrorHandlerFunc
+
+		ExpectedContentType string
+	}{
+		"Write_Only": {
+			Opts: []Option{WithDefaultContentType("text/plain; charset=utf-8")},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "<html><body>oops</body></html>")
+			},
+			ExpectedContentType: "text/plain; charset=utf-8",
+		},
+		"WriteHeader_Then_Write": {
+			Opts: []Option{WithDefaultContentType("text/plain; charset=utf-8")},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, "<html><body>oops</body></html>")
+			},
+			ExpectedContentType: "text/plain; charset=utf-8",
+		},
+		"Explicit_Content_Type": {
+			Opts: []Option{WithDefaultContentType("text/plain; charset=utf-8")},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"error":"oops"}`)
+			},
+			ExpectedContentType: "application/json",
+		},
+		"No_Content": {
+			Opts: []Option{WithDefaultContentType("text/plain; charset=utf-8")},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotModified)
+			},
+			ExpectedContentType: "",
+		},
+		"Disabled": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "<html><body>oops</body></html>")
+			},
+			ExpectedContentType: "text/html; charset=utf-8",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if ct := recorder.Result().Header.Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %q, got %q", tc.ExpectedContentType, ct)
+			}
+		})
+	}
+}
+
+func TestWithDeadlineGuard(t *testing.T) {
+	frozen := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time { return frozen })
+
+	testCases := map[string]struct {
+		Opts     []Option
+		Deadline time.Time
+
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		"Imminent_Deadline": {
+			Opts:           []Option{clock, WithDeadlineGuard(50 * time.Millisecond)},
+			Deadline:       frozen.Add(10 * time.Millisecond),
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedBody:   "Service Unavailable",
+		},
+		"Enough_Time_Left": {
+			Opts:           []Option{clock, WithDeadlineGuard(50 * time.Millisecond)},
+			Deadline:       frozen.Add(time.Second),
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBody:   "<h1>Not Found</h1>",
+		},
+		"No_Deadline": {
+			Opts:           []Option{clock, WithDeadlineGuard(50 * time.Millisecond)},
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBody:   "<h1>Not Found</h1>",
+		},
+		"No_Guard": {
+			Opts:           []Option{clock},
+			Deadline:       frozen.Add(10 * time.Millisecond),
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBody:   "<h1>Not Found</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), NegotiatingHandler(http.StatusNotFound))
+
+			r := httptest.NewRequest("", "/", nil)
+			r.Header.Set("Accept", "text/html")
+			if !tc.Deadline.IsZero() {
+				ctx, cancel := context.WithDeadline(context.Background(), tc.Deadline)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+
+			w := httptest.NewRecorder()
+			Error(w, SetMux(r, errMux), errString("A"))
+
+			if w.Code != tc.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.ExpectedBody) {
+				t.Fatalf("expected body to contain %q, got %q", tc.ExpectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithDeadlineGuardPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	WithDeadlineGuard(0)
+}
+
+func TestWithETags(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`<h1>Maintenance</h1>`))
+	fsys := fstest.MapFS{"503.html": {Data: []byte("<h1>Maintenance</h1>")}}
+
+	handlers := map[string]ErrorHandlerFunc{
+		"FileHandler":     FileHandler(fsys, "503.html", http.StatusServiceUnavailable),
+		"TemplateHandler": TemplateHandler(tmpl, "page", http.StatusServiceUnavailable),
+	}
+
+	testCases := map[string]struct {
+		Opts        []Option
+		IfNoneMatch func(etag string) string
+
+		ExpectedStatus int
+		ExpectedETag   bool
+		ExpectedBuf    string
+	}{
+		"Matching": {
+			Opts:           []Option{WithETags()},
+			IfNoneMatch:    func(etag string) string { return etag },
+			ExpectedStatus: http.StatusNotModified,
+			ExpectedETag:   true,
+			ExpectedBuf:    "",
+		},
+		"Matching_Strong_In_List": {
+			Opts:           []Option{WithETags()},
+			IfNoneMatch:    func(etag string) string { return `"other", ` + strings.TrimPrefix(etag, "W/") },
+			ExpectedStatus: http.StatusNotModified,
+			ExpectedETag:   true,
+			ExpectedBuf:    "",
+		},
+		"Not_Matching": {
+			Opts:           []Option{WithETags()},
+			IfNoneMatch:    func(etag string) string { return `W/"other"` },
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedETag:   true,
+			ExpectedBuf:    "<h1>Maintenance</h1>",
+		},
+		"No_If_None_Match": {
+			Opts:           []Option{WithETags()},
+			IfNoneMatch:    func(etag string) string { return "" },
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedETag:   true,
+			ExpectedBuf:    "<h1>Maintenance</h1>",
+		},
+		"Disabled": {
+			IfNoneMatch:    func(etag string) string { return "*" },
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedETag:   false,
+			ExpectedBuf:    "<h1>Maintenance</h1>",
+		},
+	}
+
+	for handlerName, handler := range handlers {
+		for name, tc := range testCases {
+			t.Run(handlerName+"_"+name, func(t *testing.T) {
+				errMux := NewMux(tc.Opts...)
+				errMux.Handle(errString("A"), handler)
+
+				// the first response gives the ETag of the page
+				first := httptest.NewRecorder()
+				Error(first, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+				etag := first.Header().Get("ETag")
+
+				r := httptest.NewRequest("", "/", nil)
+				if v := tc.IfNoneMatch(etag); v != "" {
+					r.Header.Set("If-None-Match", v)
+				}
+				recorder := httptest.NewRecorder()
+				Error(recorder, SetMux(r, errMux), errString("A"))
+
+				if tc.ExpectedStatus != recorder.Code {
+					t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+				}
+				if got := recorder.Header().Get("ETag"); tc.ExpectedETag != (got != "") || got != etag {
+					t.Fatalf("expected ETag %t, got %q (first response %q)", tc.ExpectedETag, got, etag)
+				}
+				if tc.ExpectedETag && !strings.HasPrefix(etag, `W/"`) {
+					t.Fatalf("expected a weak ETag, got %q", etag)
+				}
+				if tc.ExpectedBuf != recorder.Body.String() {
+					t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+				}
+			})
+		}
+	}
+}
+
+// failingWriter is a ResponseWriter whose writes fail, like the ones of a client that is gone.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+var errClientGone = errors.New("client gone")
+
+func (fw failingWriter) Write(b []byte) (int, error) {
+	return 0, errClientGone
+}
+
+func TestWithWriteErrorHook(t *testing.T) {
+	fsys := fstest.MapFS{"500.html": {Data: []byte("<h1>Oops</h1>")}}
+
+	testCases := map[string]struct {
+		Hook    bool
+		Handler ErrorHandlerFunc
+
+		ExpectedReported bool
+	}{
+		"Builtin": {
+			Hook:             true,
+			Handler:          NegotiatingHandler(http.StatusNotFound),
+			ExpectedReported: true,
+		},
+		"Builtin_File": {
+			Hook:             true,
+			Handler:          FileHandler(fsys, "500.html", http.StatusInternalServerError),
+			ExpectedReported: true,
+		},
+		"Custom_MustWrite": {
+			Hook: true,
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				MustWrite(w, []byte("custom"))
+			},
+			ExpectedReported: true,
+		},
+		"Custom_Write": {
+			Hook: true,
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Write([]byte("custom"))
+			},
+			ExpectedReported: false,
+		},
+		"No_Hook": {
+			Handler:          NegotiatingHandler(http.StatusNotFound),
+			ExpectedReported: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var reported error
+			var matched error
+			var opts []Option
+			if tc.Hook {
+				opts = []Option{WithWriteErrorHook(func(r *http.Request, err error) {
+					reported = err
+					matched, _ = Matched(r)
+				})}
+			}
+
+			errMux := NewMux(opts...)
+			errMux.Handle(errString("A"), tc.Handler)
+
+			Error(failingWriter{httptest.NewRecorder()}, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedReported != (reported == errClientGone) {
+				t.Fatalf("expected reported %t, got %v", tc.ExpectedReported, reported)
+			}
+			if tc.ExpectedReported && matched != errString("A") {
+				t.Fatalf("expected the hook to receive the request being handled, got matched %v", matched)
+			}
+		})
+	}
+}
+
+func TestWithBufferedHandlers(t *testing.T) {
+	recovery := WithHandlerRecovery(func(r *http.Request, v any) {})
+
+	partial := func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<h1>Not Fo")
+		panic("template failed")
+	}
+
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler ErrorHandlerFunc
+
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"Panic_Mid_Write": {
+			Opts:                []Option{recovery, WithBufferedHandlers(true)},
+			Handler:             partial,
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Internal Server Error",
+		},
+		"Panic_Mid_Write_Unbuffered": {
+			Opts:                []Option{recovery, WithBufferedHandlers(false)},
+			Handler:             partial,
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Fo",
+		},
+		"Completed": {
+			Opts:                []Option{recovery, WithBufferedHandlers(true)},
+			Handler:             NegotiatingHandler(http.StatusNotFound),
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"Completed_Implicit_Status": {
+			Opts: []Option{WithBufferedHandlers(true), WithImplicitStatus(http.StatusConflict)},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "conflict")
+			},
+			ExpectedStatus:      http.StatusConflict,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "conflict",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %s, got %s", tc.ExpectedContentType, ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithStatusText(t *testing.T) {
+	texts := map[string]map[int]string{
+		"es": {http.StatusNotFound: "No encontrado"},
+		"fr": {http.StatusNotFound: "Introuvable"},
+	}
+	localize := WithStatusText(func(lang string, code int) string {
+		return texts[lang][code]
+	})
+
+	testCases := map[string]struct {
+		Opts           []Option
+		AcceptLanguage string
+		Accept         string
+		Handler        ErrorHandlerFunc
+
+		ExpectedBuf string
+	}{
+		"Localized": {
+			Opts:           []Option{localize},
+			AcceptLanguage: "es-AR, es;q=0.9",
+			Handler:        NegotiatingHandler(http.StatusNotFound),
+			ExpectedBuf:    "<h1>No encontrado</h1>",
+		},
+		"Localized_Preferred_Language": {
+			Opts:           []Option{localize},
+			AcceptLanguage: "es;q=0.5, fr",
+			Accept:         "text/plain",
+			Handler:        NegotiatingHandler(http.StatusNotFound),
+			ExpectedBuf:    "Introuvable",
+		},
+		"Localized_Problem_Title": {
+			Opts:           []Option{localize},
+			AcceptLanguage: "es",
+			Handler:        ProblemDetailsHandler(http.StatusNotFound),
+			ExpectedBuf:    `"title":"No encontrado"`,
+		},
+		"Not_Translated": {
+			Opts:           []Option{localize},
+			AcceptLanguage: "de",
+			Handler:        NegotiatingHandler(http.StatusNotFound),
+			ExpectedBuf:    "<h1>Not Found</h1>",
+		},
+		"Not_Translated_Status": {
+			Opts:           []Option{localize},
+			AcceptLanguage: "es",
+			Handler:        NegotiatingHandler(http.StatusConflict),
+			ExpectedBuf:    "<h1>Conflict</h1>",
+		},
+		"Default": {
+			AcceptLanguage: "es",
+			Handler:        NegotiatingHandler(http.StatusNotFound),
+			ExpectedBuf:    "<h1>Not Found</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errString("A"), tc.Handler)
+
+			r := httptest.NewRequest("", "/", nil)
+			r.Header.Set("Accept-Language", tc.AcceptLanguage)
+			r.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(r, errMux), errString("A"))
+
+			if !strings.Contains(recorder.Body.String(), tc.ExpectedBuf) {
+				t.Fatalf("expected body to contain %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithDefaultHeaders(t *testing.T) {
+	header := http.Header{
+		"x-content-type-options": {"nosniff"},
+		"Vary":                   {"Accept"},
+	}
+	errMux := NewMux(WithDefaultHeaders(header))
+	header.Set("Vary", "changed")
+
+	errMux.Handle(errString("A"), NegotiatingHandler(http.StatusBadRequest))
+	errMux.Handle(errString("B"), func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusConflict)
+	})
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedVary   string
+	}{
+		"Matched": {
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedVary:   "Accept",
+		},
+		"Unknown": {
+			Err:            errString("C"),
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedVary:   "Accept",
+		},
+		"Overridden": {
+			Err:            errString("B"),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedVary:   "Accept-Language",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if got := recorder.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Fatalf("expected X-Content-Type-Options nosniff, got %q", got)
+			}
+			if got := recorder.Header().Values("Vary"); !slices.Equal([]string{tc.ExpectedVary}, got) {
+				t.Fatalf("expected Vary %s, got %v", tc.ExpectedVary, got)
+			}
+		})
+	}
+}
+
+func TestWithRenderTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+
+		ExpectedStatus int
+		ExpectedBuf    string
+		ExpectedHeader string
+	}{
+		"Fast": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("X-Handler", "fast")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "not found")
+			},
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "not found",
+			ExpectedHeader: "fast",
+		},
+		"Slow_Cut_Off": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("X-Handler", "slow")
+				<-r.Context().Done()
+				if _, err := io.WriteString(w, "too late"); err != http.ErrHandlerTimeout {
+					panic(fmt.Sprintf("expected ErrHandlerTimeout, got %v", err))
+				}
+			},
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedBuf:    "Service Unavailable",
+			ExpectedHeader: "",
+		},
+		"Slow_Header_Written": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("X-Handler", "partial")
+				w.WriteHeader(http.StatusBadGateway)
+				io.WriteString(w, "partial")
+				<-r.Context().Done()
+			},
+			ExpectedStatus: http.StatusBadGateway,
+			ExpectedBuf:    "partial",
+			ExpectedHeader: "partial",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithRenderTimeout(20 * time.Millisecond))
+			errMux.Handle(errString("A"), tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if got := recorder.Header().Get("X-Handler"); tc.ExpectedHeader != got {
+				t.Fatalf("expected X-Handler %q, got %q", tc.ExpectedHeader, got)
+			}
+		})
+	}
+}
+
+func TestWithRenderTimeoutDefaults(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+	}{
+		"Implicit_Status":      {Opts: []Option{WithImplicitStatus(http.StatusTeapot)}},
+		"Default_Content_Type": {Opts: []Option{WithDefaultContentType("text/plain")}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			finished := make(chan struct{})
+			errMux := NewMux(append(tc.Opts, WithRenderTimeout(time.Nanosecond))...)
+			errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+				defer close(finished)
+				time.Sleep(time.Millisecond)
+				io.WriteString(w, "too late")
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+			// the handler keeps running after the timeout, run with -race
+			<-finished
+
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestWithRenderTimeoutResponseController(t *testing.T) {
+	var flushErr, lateFlushErr, lateDeadlineErr error
+	finished := make(chan struct{})
+	errMux := NewMux(WithRenderTimeout(20 * time.Millisecond))
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		defer close(finished)
+		rc := http.NewResponseController(w)
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "partial")
+		flushErr = rc.Flush()
+		<-r.Context().Done()
+		lateFlushErr = rc.Flush()
+		lateDeadlineErr = rc.SetWriteDeadline(time.Now().Add(time.Second))
+	})
+
+	recorder := httptest.NewRecorder()
+	Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+	// the handler keeps running after the timeout
+	<-finished
+
+	if flushErr != nil || !recorder.Flushed {
+		t.Fatalf("expected the response to be flushed, got %v", flushErr)
+	}
+	if lateFlushErr != http.ErrHandlerTimeout {
+		t.Fatalf("expected ErrHandlerTimeout, got %v", lateFlushErr)
+	}
+	if !errors.Is(lateDeadlineErr, http.ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", lateDeadlineErr)
+	}
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("expected status %d, got %d", http.StatusBadGateway, recorder.Code)
+	}
+}
+
+func TestWithRenderTimeoutPanic(t *testing.T) {
+	var recovered any
+	errMux := NewMux(WithRenderTimeout(time.Second), WithHandlerRecovery(func(r *http.Request, v any) {
+		recovered = v
+	}))
+	errMux.Handle(errString("A"), func(w http.ResponseWriter, r *http.Request, err error) {
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+	if recovered != "boom" {
+		t.Fatalf("expected the panic of the handler to be recovered by Error, got %v", recovered)
+	}
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+}
+
+func TestWithCORSHeaders(t *testing.T) {
+	errMux := NewMux(
+		WithDefaultHeaders(http.Header{"Vary": {"Accept"}}),
+		WithCORSHeaders(func(r *http.Request) http.Header {
+			origin := r.Header.Get("Origin")
+			if origin != "https://app.example.com" {
+				return nil
+			}
+			return http.Header{
+				"access-control-allow-origin": {origin},
+				"Vary":                        {"Accept", "Origin"},
+			}
+		}),
+	)
+	errMux.Handle(errString("A"), NegotiatingHandler(http.StatusBadRequest))
+
+	testCases := map[string]struct {
+		Origin string
+		Err    error
+
+		ExpectedStatus int
+		ExpectedACAO   string
+		ExpectedVary   []string
+	}{
+		"Matched_Allowed": {
+			Origin:         "https://app.example.com",
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedACAO:   "https://app.example.com",
+			ExpectedVary:   []string{"Accept", "Origin"},
+		},
+		"Unknown_Allowed": {
+			Origin:         "https://app.example.com",
+			Err:            errString("B"),
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedACAO:   "https://app.example.com",
+			ExpectedVary:   []string{"Accept", "Origin"},
+		},
+		"Not_Allowed": {
+			Origin:         "https://evil.example.com",
+			Err:            errString("A"),
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedACAO:   "",
+			ExpectedVary:   []string{"Accept"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("", "/", nil)
+			r.Header.Set("Origin", tc.Origin)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(r, errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); tc.ExpectedACAO != got {
+				t.Fatalf("expected Access-Control-Allow-Origin %q, got %q", tc.ExpectedACAO, got)
+			}
+			if got := recorder.Header().Values("Vary"); !slices.Equal(tc.ExpectedVary, got) {
+				t.Fatalf("expected Vary %v, got %v", tc.ExpectedVary, got)
+			}
+		})
+	}
+}
+
+func TestWithSanitizer(t *testing.T) {
+	redact := WithSanitizer(func(message string) string {
+		return strings.ReplaceAll(message, "s3cr3t", "[REDACTED]")
+	})
+	tmpl := template.Must(template.New("page").Parse(`<p>{{.Message}}</p>`))
+	errDB := errors.New("dial postgres://admin:s3cr3t@db: connection refused")
+
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler ErrorHandlerFunc
+
+		ExpectedBuf string
+	}{
+		"Negotiating": {
+			Opts:        []Option{WithVerboseErrors(true), redact},
+			Handler:     NegotiatingHandler(http.StatusBadGateway),
+			ExpectedBuf: "<h1>Bad Gateway</h1><p>dial postgres://admin:[REDACTED]@db: connection refused</p>",
+		},
+		"Problem": {
+			Opts:        []Option{WithVerboseErrors(true), redact},
+			Handler:     ProblemDetailsHandler(http.StatusBadGateway),
+			ExpectedBuf: `{"detail":"dial postgres://admin:[REDACTED]@db: connection refused","instance":"/","status":502,"title":"Bad Gateway","type":"about:blank"}`,
+		},
+		"Template": {
+			Opts:        []Option{redact},
+			Handler:     TemplateHandler(tmpl, "page", http.StatusBadGateway),
+			ExpectedBuf: "<p>dial postgres://admin:[REDACTED]@db: connection refused</p>",
+		},
+		"Default_Identity": {
+			Opts:        []Option{WithVerboseErrors(true)},
+			Handler:     NegotiatingHandler(http.StatusBadGateway),
+			ExpectedBuf: "<h1>Bad Gateway</h1><p>dial postgres://admin:s3cr3t@db: connection refused</p>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errDB, tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errDB)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithCharset(t *testing.T) {
+	testCases := map[string]struct {
+		Opts    []Option
+		Handler ErrorHandlerFunc
+
+		ExpectedContentType string
+	}{
+		"Default_Unknown": {
+			Handler:             DefaultUnknownHandler,
+			ExpectedContentType: "text/html; charset=utf-8",
+		},
+		"Default_Unknown_Charset": {
+			Opts:                []Option{WithCharset("iso-8859-1")},
+			Handler:             DefaultUnknownHandler,
+			ExpectedContentType: "text/html; charset=iso-8859-1",
+		},
+		"Text_Charset": {
+			Opts:                []Option{WithCharset("iso-8859-1")},
+			Handler:             TextHandler(http.StatusNotFound),
+			ExpectedContentType: "text/plain; charset=iso-8859-1",
+		},
+		"JSON_Unchanged": {
+			Opts:                []Option{WithCharset("iso-8859-1")},
+			Handler:             DefaultUnknownJSONHandler,
+			ExpectedContentType: "application/json",
+		},
+		"Charset_Not_Appended_Twice": {
+			Opts: []Option{WithCharset("iso-8859-1")},
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				writeResponse(w, r, http.StatusNotFound, "text/html; charset=utf-16", nil)
+			},
+			ExpectedContentType: "text/html; charset=utf-16",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.UnknownHandler(tc.Handler)
+
+			recorder := httptest.NewRecorder()
+			errMux.ServeError(recorder, httptest.NewRequest("", "/", nil), errString("A"))
+
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %q, got %q", tc.ExpectedContentType, ct)
+			}
+		})
+	}
+}
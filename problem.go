@@ -0,0 +1,91 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Returns an error handler that writes a problem details document as defined by RFC 9457, with
+// Content-Type "application/problem+json" and status code status:
+//
+//	{"type":"about:blank","title":"Not Found","status":404,"instance":"/users/1","requestId":"abc"}
+//
+// "instance" is the path of the request, and "requestId" is the ID returned by [RequestID], omitted
+// if it's empty. The message of the error is only included, as "detail", if [WithVerboseErrors] is
+// enabled, since it may leak internal details. A status of 0 means 500, if a status has been hinted
+// with [ErrorStatus], it's written instead.
+//
+// If err has a [ProblemExtender] in its chain, its extensions are added to the document, except
+// the ones named like the members written by the handler or reserved by RFC 9457, which are
+// ignored. If an extension cannot be marshaled, a minimal JSON document is written instead, see
+// [WriteJSON].
+func ProblemDetailsHandler(status int) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if shed(w, r) {
+			return
+		}
+
+		status := resolveStatus(r, status)
+
+		problem := map[string]any{
+			"type":     "about:blank",
+			"title":    statusText(r, status),
+			"status":   status,
+			"instance": r.URL.Path,
+		}
+		if id := RequestID(r); id != "" {
+			problem["requestId"] = id
+		}
+		if detail, ok := errorDetail(r, err); ok {
+			problem["detail"] = detail
+		}
+
+		var extender ProblemExtender
+		if errors.As(err, &extender) {
+			for name, value := range extender.ProblemExtensions() {
+				if _, ok := problem[name]; ok || reservedProblemMembers[name] {
+					continue
+				}
+				problem[name] = value
+			}
+		}
+
+		writeProblem(w, r, status, problem)
+	}
+}
+
+// ProblemExtender is implemented by the errors that add extension members to the problem details
+// documents written by [ProblemDetailsHandler], like the balance of an account for an
+// insufficient funds error.
+type ProblemExtender interface {
+	error
+	ProblemExtensions() map[string]any
+}
+
+// Members of a problem details document defined by RFC 9457, that cannot be set by extensions.
+var reservedProblemMembers = map[string]bool{
+	"type":     true,
+	"title":    true,
+	"status":   true,
+	"detail":   true,
+	"instance": true,
+}
+
+// writeProblem writes problem as a problem details document.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, problem map[string]any) {
+	writeJSON(w, r, status, "application/problem+json", problem)
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type insufficientFundsError struct {
+	Balance int
+}
+
+func (e insufficientFundsError) Error() string {
+	return "insufficient funds"
+}
+
+func (e insufficientFundsError) ProblemExtensions() map[string]any {
+	return map[string]any{
+		"balance":   e.Balance,
+		"title":     "overwritten",
+		"detail":    "overwritten",
+		"requestId": "overwritten",
+	}
+}
+
+func TestProblemDetailsHandler(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+		Err  error
+
+		ExpectedBuf string
+	}{
+		"No_Request_ID": {
+			Err: errString("not found"),
+
+			ExpectedBuf: `{"instance":"/users/1","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+		"Request_ID": {
+			Opts: []Option{WithRequestID(func(r *http.Request) string {
+				return r.Header.Get("X-Request-Id")
+			})},
+			Err: errString("not found"),
+
+			ExpectedBuf: `{"instance":"/users/1","requestId":"abc-123","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+		"Extensions": {
+			Opts: []Option{WithRequestID(func(r *http.Request) string {
+				return r.Header.Get("X-Request-Id")
+			})},
+			Err: fmt.Errorf("wrapped: %w", insufficientFundsError{Balance: 30}),
+
+			ExpectedBuf: `{"balance":30,"instance":"/users/1","requestId":"abc-123","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.UnknownHandler(ProblemDetailsHandler(http.StatusNotFound))
+
+			req := SetMux(httptest.NewRequest("", "/users/1", nil), errMux)
+			req.Header.Set("X-Request-Id", "abc-123")
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, tc.Err)
+
+			if recorder.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("expected Content-Type application/problem+json, got %s", ct)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+type unmarshalableExtensionError struct{}
+
+func (unmarshalableExtensionError) Error() string {
+	return "unmarshalable"
+}
+
+func (unmarshalableExtensionError) ProblemExtensions() map[string]any {
+	return map[string]any{"callback": func() {}}
+}
+
+func TestProblemDetailsHandlerMarshalFails(t *testing.T) {
+	var reported error
+	errMux := NewMux(WithWriteErrorHook(func(r *http.Request, err error) {
+		reported = err
+	}))
+	errMux.UnknownHandler(ProblemDetailsHandler(http.StatusNotFound))
+
+	recorder := httptest.NewRecorder()
+	errMux.ServeError(recorder, httptest.NewRequest("", "/", nil), unmarshalableExtensionError{})
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	if ct := recorder.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected Content-Type application/json, got %s", ct)
+	}
+	if expected := `{"error":"internal server error"}`; recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+	if reported == nil {
+		t.Fatal("expected the marshaling error to be reported to the hook")
+	}
+}
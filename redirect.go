@@ -0,0 +1,100 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Maximum number of nested internal redirects made by [InternalRedirectHandler] for the same
+// request, when the error page itself fails and its error is handled by another internal redirect.
+const MaxInternalRedirects = 3
+
+type keyInternalRedirect struct{}
+
+// Returns an ErrorHandlerFunc that renders the route path of next, usually the router of the
+// application, as the error page, without an external redirect:
+//
+//	router.Get("/errors/500", errorPage)
+//	errMux.Handle(ErrDatabase, centra.InternalRedirectHandler("/errors/500", router))
+//
+// The request is rewritten to a GET (HEAD requests are kept) with no body and path, keeping the
+// query and the headers, and its context carries the number of internal redirects made so far.
+// If the error page fails and it's handled by an internal redirect again, the error is handled by
+// the UnknownHandler once [MaxInternalRedirects] is reached, instead of recursing forever.
+//
+// The status written by the route is kept, unless it's a successful (2xx) one, which is replaced
+// by the status hinted with [ErrorStatus], or 500 Internal Server Error.
+func InternalRedirectHandler(path string, next http.Handler) ErrorHandlerFunc {
+	if !strings.HasPrefix(path, "/") {
+		panic("centra: path must start with /")
+	}
+	if next == nil {
+		panic("centra: next must not be nil")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		depth, _ := r.Context().Value(keyInternalRedirect{}).(int)
+		if depth >= MaxInternalRedirects {
+			callUnknown(w, r, err)
+			return
+		}
+
+		r2 := r.Clone(context.WithValue(r.Context(), keyInternalRedirect{}, depth+1))
+		if r2.Method != http.MethodHead {
+			r2.Method = http.MethodGet
+		}
+		r2.Body = http.NoBody
+		r2.ContentLength = 0
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		r2.RequestURI = r2.URL.RequestURI()
+
+		next.ServeHTTP(&errorPageWriter{ResponseWriter: w, status: statusOr(r, http.StatusInternalServerError)}, r2)
+	}
+}
+
+// errorPageWriter replaces the successful status written by an error page with status.
+type errorPageWriter struct {
+	http.ResponseWriter
+
+	status int
+
+	wroteHeader bool
+}
+
+func (ew *errorPageWriter) WriteHeader(statusCode int) {
+	if statusCode >= 200 && statusCode <= 299 {
+		statusCode = ew.status
+	}
+	if statusCode >= 200 {
+		ew.wroteHeader = true
+	}
+	ew.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (ew *errorPageWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, see [http.ResponseController].
+func (ew *errorPageWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
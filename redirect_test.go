@@ -0,0 +1,83 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInternalRedirectHandler(t *testing.T) {
+	errMux := NewMux()
+	router := http.NewServeMux()
+	app := errMux.Handler(router)
+
+	errMux.Handle(errString("DB"), InternalRedirectHandler("/errors/500", app))
+	errMux.Handle(errString("GONE"), InternalRedirectHandler("/errors/410", app))
+	errMux.Handle(errString("BROKEN"), InternalRedirectHandler("/errors/broken", app))
+
+	router.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errString(r.URL.Query().Get("err")))
+	})
+	router.HandleFunc("GET /errors/500", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "error page for "+r.URL.Query().Get("err"))
+	})
+	router.HandleFunc("GET /errors/410", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+		io.WriteString(w, "gone")
+	})
+	router.HandleFunc("GET /errors/broken", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, errString("BROKEN"))
+	})
+
+	testCases := map[string]struct {
+		Err string
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Render_In_Place": {
+			Err:            "DB",
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "error page for DB",
+		},
+		"Route_Status_Kept": {
+			Err:            "GONE",
+			ExpectedStatus: http.StatusGone,
+			ExpectedBuf:    "gone",
+		},
+		"Recursion_Guard": {
+			Err:            "BROKEN",
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders?err="+tc.Err, nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// Renderer is implemented by the errors that render their own response, see [WithSelfRendering].
+type Renderer interface {
+	error
+	RenderError(w http.ResponseWriter, r *http.Request)
+}
+
+// rendererHandler returns the handler calling the RenderError method of the first Renderer in the
+// chain of err, reporting false if there is none. The handler is named after the type of the
+// Renderer, since its message is usually specific to each error.
+func rendererHandler(err error) (handlerStruct, bool) {
+	var renderer Renderer
+	if !errors.As(err, &renderer) {
+		return handlerStruct{}, false
+	}
+	return handlerStruct{
+		err:  renderer,
+		name: reflect.TypeOf(renderer).String(),
+		handler: func(w http.ResponseWriter, r *http.Request, err error) {
+			renderer.RenderError(w, r)
+		},
+	}, true
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type outOfStockError struct {
+	item string
+}
+
+func (e *outOfStockError) Error() string {
+	return e.item + " out of stock"
+}
+
+func (e *outOfStockError) RenderError(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusConflict)
+	io.WriteString(w, "sorry, no more "+e.item)
+}
+
+func TestWithSelfRendering(t *testing.T) {
+	errSentinel := errors.New("sentinel")
+	errOutOfStock := &outOfStockError{item: "apples"}
+
+	testCases := map[string]struct {
+		Opts []Option
+		Err  error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Renderer": {
+			Opts:           []Option{WithSelfRendering()},
+			Err:            errOutOfStock,
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "sorry, no more apples",
+		},
+		"Renderer_Wrapped": {
+			Opts:           []Option{WithSelfRendering()},
+			Err:            fmt.Errorf("checkout: %w", errOutOfStock),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "sorry, no more apples",
+		},
+		"Renderer_Wins_Over_Sentinel": {
+			Opts:           []Option{WithSelfRendering()},
+			Err:            errors.Join(errSentinel, errOutOfStock),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "sorry, no more apples",
+		},
+		"Sentinel": {
+			Opts:           []Option{WithSelfRendering()},
+			Err:            errSentinel,
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "sentinel",
+		},
+		"Disabled": {
+			Err:            errors.Join(errSentinel, errOutOfStock),
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "sentinel",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(tc.Opts...)
+			errMux.Handle(errSentinel, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, "sentinel")
+			})
+
+			var matched error
+			errMux.Finalize(func(w http.ResponseWriter, r *http.Request, err error) {
+				matched, _ = Matched(r)
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+
+			expectedMatched := errSentinel
+			if tc.ExpectedStatus == http.StatusConflict {
+				expectedMatched = errOutOfStock
+			}
+			if matched != expectedMatched {
+				t.Fatalf("expected Matched %v, got %v", expectedMatched, matched)
+			}
+		})
+	}
+}
+
+func TestWithSelfRenderingMatchedName(t *testing.T) {
+	errMux := NewMux(WithSelfRendering())
+
+	var names []string
+	errMux.Finalize(func(w http.ResponseWriter, r *http.Request, err error) {
+		names = append(names, MatchedName(r))
+	})
+
+	for _, item := range []string{"apples", "pears"} {
+		Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), &outOfStockError{item: item})
+	}
+
+	expected := "*centra.outOfStockError"
+	if len(names) != 2 || names[0] != expected || names[1] != expected {
+		t.Fatalf("expected MatchedName %q for both errors, got %q", expected, names)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Response produced by the handler selected for an error, as returned by [Mux.Resolve].
+type Response struct {
+	// Status code written by the handler, 200 if it didn't write any, like net/http does.
+	Status int
+
+	// Headers set by the handler.
+	Header http.Header
+
+	// Body written by the handler.
+	Body []byte
+}
+
+// Returns the response the handler selected by m for err would write for r, by running it
+// against an in-memory writer instead of the client's, so deciding the response is decoupled
+// from writing it, for example for snapshot tests or to post-process the response before
+// writing it with [Response.WriteTo].
+//
+// The matching is the same one of [Error], with m installed in the request, and the middlewares
+// and finalizers are called as usual. Since the handler runs for real, Resolve costs as much as
+// handling the error, plus buffering the whole body, the handlers streaming large bodies are
+// better served by [Error].
+func (m *Mux) Resolve(r *http.Request, err error) Response {
+	if r == nil {
+		panic("centra: nil *http.Request passed to Resolve")
+	}
+
+	rec := &recorder{header: http.Header{}}
+	errorWithMux(m, rec, setMux(r, keyContext{}, m), err)
+
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return Response{
+		Status: status,
+		Header: rec.header,
+		Body:   rec.body.Bytes(),
+	}
+}
+
+// Dispatch decision for an error, as recorded by [Mux.DryRun].
+type DryRunResult struct {
+	// Error replayed.
+	Err error
+
+	// Registered error that matched Err, nil if it's handled by the UnknownHandler, see [Matched].
+	Matched error
+
+	// Label of the handler that handled Err, see [MatchedName].
+	Name string
+
+	// Status code written by the handler, see [Response].
+	Status int
+
+	// Content-Type set by the handler, empty if it set none.
+	ContentType string
+}
+
+// Replays errs through m for r, recording for each of them the handler selected and the response
+// it writes, by running it with [Mux.Resolve], so nothing is sent to any client. It's meant to
+// audit the configuration of a server, for example in CI:
+//
+//	for _, res := range errMux.DryRun(httptest.NewRequest("GET", "/", nil), domainErrors...) {
+//		if res.Status >= 500 {
+//			t.Errorf("%v is handled by %s with status %d", res.Err, res.Name, res.Status)
+//		}
+//	}
+//
+// The handlers, middlewares and finalizers run for real, so their side effects, like logging or
+// metrics, happen as usual.
+func (m *Mux) DryRun(r *http.Request, errs ...error) []DryRunResult {
+	if r == nil {
+		panic("centra: nil *http.Request passed to DryRun")
+	}
+
+	results := make([]DryRunResult, 0, len(errs))
+	for _, err := range errs {
+		_, _, h := m.resolve(r.Method, boundChain(err))
+		resp := m.Resolve(r, err)
+		results = append(results, DryRunResult{
+			Err:         err,
+			Matched:     h.err,
+			Name:        h.label(),
+			Status:      resp.Status,
+			ContentType: resp.Header.Get("Content-Type"),
+		})
+	}
+	return results
+}
+
+// Writes the response to w. If w is an http.ResponseWriter, the headers and the status code are
+// written before the body, otherwise only the body is written. It returns the number of bytes of
+// the body written and the error returned by w, if any.
+func (resp Response) WriteTo(w io.Writer) (int64, error) {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		header := rw.Header()
+		for k, v := range resp.Header {
+			header[k] = append([]string(nil), v...)
+		}
+		rw.WriteHeader(resp.Status)
+	}
+	n, err := w.Write(resp.Body)
+	return int64(n), err
+}
+
+// buffered returns handler running against a recorder, whose response is copied to the writer
+// passed to it, which must wrap a responseWriter, only if handler returns, see
+// WithBufferedHandlers.
+func buffered(handler ErrorHandlerFunc) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		rec := &recorder{header: w.Header().Clone()}
+		// the defaults of the dispatch apply to the buffered response as well
+		handler(&responseWriter{ResponseWriter: rec, defaults: findWriter(w).defaults}, r, err)
+
+		header := w.Header()
+		clear(header)
+		for k, v := range rec.header {
+			header[k] = v
+		}
+		if rec.status == 0 {
+			// nothing written, the response is left to the next writers as usual
+			return
+		}
+		if _, ok := header["Content-Type"]; !ok && rec.body.Len() != 0 {
+			// sniffed from the whole body, as net/http would from the first write
+			header.Set("Content-Type", http.DetectContentType(rec.body.Bytes()))
+		}
+		w.WriteHeader(rec.status)
+		if rec.body.Len() != 0 {
+			MustWrite(w, rec.body.Bytes())
+		}
+	}
+}
+
+// withTimeout returns handler running in its own goroutine, given at most d to write the header of
+// its response, see WithRenderTimeout. The writer passed to it must wrap a responseWriter.
+func withTimeout(d time.Duration, handler ErrorHandlerFunc) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w, header: w.Header().Clone(), ctx: ctx}
+		// the defaults of the dispatch apply to the response of the goroutine as well, they are
+		// read here since they are restored by Mux.serve as soon as the handler times out
+		defaults := findWriter(w).defaults
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if v := recover(); v != nil {
+					panicked <- v
+					return
+				}
+				close(done)
+			}()
+			handler(&responseWriter{ResponseWriter: tw, defaults: defaults}, r.WithContext(ctx), err)
+		}()
+
+		finished := false
+		select {
+		case v := <-panicked:
+			// propagated to the goroutine of Error, so it's recovered as usual
+			panic(v)
+		case <-done:
+			finished = true
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// a handler returning right after its writes were rejected has timed out all the same
+		if finished && !tw.rejected {
+			if !tw.wroteHeader {
+				// nothing written, the header is left to the next writers as usual
+				tw.copyHeader()
+			}
+			return
+		}
+		tw.timedOut = true
+		if !tw.wroteHeader {
+			clear(w.Header())
+			writeResponse(w, r, http.StatusServiceUnavailable, "text/plain",
+				[]byte(http.StatusText(http.StatusServiceUnavailable)))
+		}
+	}
+}
+
+// timeoutWriter is the http.ResponseWriter of the handlers run by withTimeout, it forwards the
+// response to w until the handler times out, the header is copied to w once it's written. Like the
+// other writers of the package it unwraps to w, until the handler times out.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	// context of the handler, the writes are rejected once it's done
+	ctx context.Context
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+
+	// a write has been rejected because ctx is done
+	rejected bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(statusCode)
+}
+
+// writeHeader writes the header, tw.mu must be held.
+func (tw *timeoutWriter) writeHeader(statusCode int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	if tw.ctx.Err() != nil {
+		tw.rejected = true
+		return
+	}
+	tw.copyHeader()
+	if statusCode >= 200 {
+		// informational headers (1xx) may be followed by the actual header
+		tw.wroteHeader = true
+	}
+	tw.w.WriteHeader(statusCode)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		tw.rejected = true
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// FlushError writes the header, if it's not written yet, and flushes w, unless the handler has
+// timed out, see http.ResponseController.
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		tw.rejected = true
+		return http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return http.NewResponseController(tw.w).Flush()
+}
+
+// Unwrap returns w, so http.ResponseController reaches its other capabilities, like the write
+// deadlines, or nil once the handler has timed out, so they are no longer reachable.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		return nil
+	}
+	return tw.w
+}
+
+// copyHeader replaces the header of w with the one of tw, tw.mu must be held.
+func (tw *timeoutWriter) copyHeader() {
+	header := tw.w.Header()
+	clear(header)
+	for k, v := range tw.header {
+		header[k] = v
+	}
+}
+
+// recorder is the in-memory http.ResponseWriter used by Mux.Resolve.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if rec.status == 0 && statusCode >= 200 {
+		rec.status = statusCode
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
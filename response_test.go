@@ -0,0 +1,188 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMuxResolve(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errPlain := errors.New("plain")
+	errEmpty := errors.New("empty")
+
+	errMux := NewMux()
+	errMux.Handle(errNotFound, NegotiatingHandler(http.StatusNotFound))
+	errMux.Handle(errPlain, func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("X-Custom", "1")
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, "conflict")
+	})
+	errMux.Handle(errEmpty, func(w http.ResponseWriter, r *http.Request, err error) {})
+	errMux.Finalize(func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("X-Finalized", MatchedName(r))
+	})
+
+	testCases := map[string]struct {
+		Err    error
+		Accept string
+
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		"Negotiated_JSON": {
+			Err:            errNotFound,
+			Accept:         "application/json",
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBody:   `{"error":"not found"}`,
+		},
+		"Custom": {
+			Err:            errPlain,
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBody:   "conflict",
+		},
+		"Nothing_Written": {
+			Err:            errEmpty,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   "",
+		},
+		"Unknown": {
+			Err:            errors.New("unknown"),
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBody:   "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("", "/", nil)
+			req.Header.Set("Accept", tc.Accept)
+
+			resp := errMux.Resolve(req, tc.Err)
+
+			if tc.ExpectedStatus != resp.Status {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, resp.Status)
+			}
+			if tc.ExpectedBody != string(resp.Body) {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBody, resp.Body)
+			}
+
+			resolved := httptest.NewRecorder()
+			if _, err := resp.WriteTo(resolved); err != nil {
+				t.Fatal(err)
+			}
+
+			direct := httptest.NewRecorder()
+			Error(direct, SetMux(req, errMux), tc.Err)
+
+			if direct.Code != resolved.Code {
+				t.Fatalf("expected status %d, got %d", direct.Code, resolved.Code)
+			}
+			if !reflect.DeepEqual(direct.Header(), resolved.Header()) {
+				t.Fatalf("expected headers %v, got %v", direct.Header(), resolved.Header())
+			}
+			if direct.Body.String() != resolved.Body.String() {
+				t.Fatalf("expected %s, got %s", direct.Body.String(), resolved.Body.String())
+			}
+		})
+	}
+}
+
+func TestResponseWriteToWriter(t *testing.T) {
+	resp := Response{Status: http.StatusNotFound, Header: http.Header{"X-Custom": {"1"}}, Body: []byte("not found")}
+
+	var buf bytes.Buffer
+	n, err := resp.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(resp.Body)) || buf.String() != "not found" {
+		t.Fatalf("expected only the body to be written, got %d bytes: %s", n, buf.String())
+	}
+}
+
+func TestMuxDryRun(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errConflict := errors.New("conflict")
+	errUnmapped := errors.New("unmapped")
+
+	errMux := NewMux()
+	errMux.Handle(errNotFound, NegotiatingHandler(http.StatusNotFound))
+	errMux.HandleNamed("conflict", errConflict, func(w http.ResponseWriter, r *http.Request, err error) {
+		WriteJSON(w, http.StatusConflict, map[string]string{"error": "conflict"})
+	})
+
+	wrapped := errors.Join(errors.New("saving"), errNotFound)
+	results := errMux.DryRun(httptest.NewRequest("", "/", nil), wrapped, errConflict, errUnmapped)
+
+	expected := []DryRunResult{
+		{
+			Err:         wrapped,
+			Matched:     errNotFound,
+			Name:        "not found",
+			Status:      http.StatusNotFound,
+			ContentType: "text/html; charset=utf-8",
+		},
+		{
+			Err:         errConflict,
+			Matched:     errConflict,
+			Name:        "conflict",
+			Status:      http.StatusConflict,
+			ContentType: "application/json",
+		},
+		{
+			Err:         errUnmapped,
+			Matched:     nil,
+			Name:        UnknownName,
+			Status:      http.StatusInternalServerError,
+			ContentType: "text/html; charset=utf-8",
+		},
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Fatalf("expected %+v, got %+v", expected, results)
+	}
+}
+
+func TestMuxDryRunBoundChain(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+	}{
+		"Cyclic": {Err: &cyclicError{}},
+		"Deep":   {Err: wrapChain(errString("A"), 10*MaxChainLength)},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(errString("A"), NegotiatingHandler(http.StatusNotFound))
+			errMux.Handle(ErrChainTooDeep, NegotiatingHandler(http.StatusBadRequest))
+
+			var results []DryRunResult
+			assertTerminates(t, func() {
+				results = errMux.DryRun(httptest.NewRequest("", "/", nil), tc.Err)
+			})
+
+			if len(results) != 1 || results[0].Matched != ErrChainTooDeep || results[0].Status != http.StatusBadRequest {
+				t.Fatalf("expected the error to be handled as ErrChainTooDeep, got %+v", results)
+			}
+		})
+	}
+}
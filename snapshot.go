@@ -0,0 +1,116 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Snapshot of the registrations of a Mux, as returned by [Mux.Snapshot].
+type Snapshot struct {
+	state *muxState
+}
+
+// Returns a snapshot of the current registrations of m, so they can be compared later with
+// [Snapshot.DiffFrom], for example to check that a test sharing a Mux restored it:
+//
+//	snap := errMux.Snapshot()
+//	t.Cleanup(func() {
+//		if diff := snap.DiffFrom(errMux); len(diff) != 0 {
+//			t.Errorf("leaked registrations: %v", diff)
+//		}
+//	})
+//
+// Taking a snapshot is cheap, the registrations are copy-on-write, see [Mux].
+func (m *Mux) Snapshot() Snapshot {
+	return Snapshot{state: m.load()}
+}
+
+// Returns the differences between the registrations of s and the current ones of m, one per
+// line, or nil if there are none: the handlers added and removed since s was taken, identified by
+// their name, see [MatchedName], along with the UnknownHandler, the parent, the middlewares and
+// the finalizers that changed. The functions are compared by the pointer to their code, as
+// reported by reflect, so the closures created by the same function literal are considered the
+// same even if they capture different variables.
+func (s Snapshot) DiffFrom(m *Mux) []string {
+	if s.state == nil {
+		panic("centra: Snapshot has not been taken with Mux.Snapshot()")
+	}
+	cur := m.load()
+	if cur == s.state {
+		return nil
+	}
+
+	var diff []string
+
+	added := append([]handlerStruct(nil), cur.handlersStack[1:]...)
+	for _, h := range s.state.handlersStack[1:] {
+		i := indexHandler(added, h)
+		if i == -1 {
+			diff = append(diff, fmt.Sprintf("removed handler %q", h.label()))
+			continue
+		}
+		added = append(added[:i], added[i+1:]...)
+	}
+	for _, h := range added {
+		diff = append(diff, fmt.Sprintf("added handler %q", h.label()))
+	}
+
+	if !sameFunc(s.state.handlersStack[0].handler, cur.handlersStack[0].handler) {
+		diff = append(diff, "changed UnknownHandler")
+	}
+	if s.state.parent != cur.parent {
+		diff = append(diff, "changed parent")
+	}
+	if !sameFuncs(s.state.middlewares, cur.middlewares) {
+		diff = append(diff, fmt.Sprintf("changed middlewares, from %d to %d", len(s.state.middlewares), len(cur.middlewares)))
+	}
+	if !sameFuncs(s.state.finalizers, cur.finalizers) {
+		diff = append(diff, fmt.Sprintf("changed finalizers, from %d to %d", len(s.state.finalizers), len(cur.finalizers)))
+	}
+	return diff
+}
+
+// indexHandler returns the index of the first handler of stack registered like h, with the same
+// error and handler, or -1 if there is none.
+func indexHandler(stack []handlerStruct, h handlerStruct) int {
+	for i, other := range stack {
+		if other.exact == h.exact && other.method == h.method && other.status == h.status &&
+			other.statusMax == h.statusMax && other.priority == h.priority && other.name == h.name &&
+			identical(other.err, h.err) && sameFunc(other.handler, h.handler) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameFunc reports whether a and b are the same function, or both nil.
+func sameFunc[F any](a, b F) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// sameFuncs reports whether a and b hold the same functions in the same order.
+func sameFuncs[F any](a, b []F) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameFunc(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestSnapshotDiffFrom(t *testing.T) {
+	handlerA := func(w http.ResponseWriter, r *http.Request, err error) {}
+	handlerB := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Mutate func(m *Mux)
+
+		ExpectedDiff []string
+	}{
+		"Unchanged": {
+			Mutate:       func(m *Mux) {},
+			ExpectedDiff: nil,
+		},
+		"Added": {
+			Mutate: func(m *Mux) {
+				m.Handle(errString("B"), handlerB)
+			},
+			ExpectedDiff: []string{`added handler "B"`},
+		},
+		"Restored": {
+			Mutate: func(m *Mux) {
+				m.Handle(errString("B"), handlerB)
+				m.Reset()
+				m.Handle(errString("A"), handlerA)
+			},
+			ExpectedDiff: nil,
+		},
+		"Removed": {
+			Mutate: func(m *Mux) {
+				m.Reset()
+			},
+			ExpectedDiff: []string{`removed handler "A"`},
+		},
+		"Replaced_Handler": {
+			Mutate: func(m *Mux) {
+				m.Reset()
+				m.Handle(errString("A"), handlerB)
+			},
+			ExpectedDiff: []string{`removed handler "A"`, `added handler "A"`},
+		},
+		"Unknown_Handler": {
+			Mutate: func(m *Mux) {
+				m.UnknownHandler(handlerB)
+			},
+			ExpectedDiff: []string{"changed UnknownHandler"},
+		},
+		"Middleware": {
+			Mutate: func(m *Mux) {
+				m.Use(func(next ErrorHandlerFunc) ErrorHandlerFunc { return next })
+			},
+			ExpectedDiff: []string{"changed middlewares, from 0 to 1"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Handle(errString("A"), handlerA)
+
+			snap := errMux.Snapshot()
+			tc.Mutate(errMux)
+
+			if diff := snap.DiffFrom(errMux); !slices.Equal(tc.ExpectedDiff, diff) {
+				t.Fatalf("expected diff %q, got %q", tc.ExpectedDiff, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Declarative mapping of an error to a response, used by [BuildMux].
+type HandlerSpec struct {
+	// Error handled, registered with [Mux.Handle].
+	Err error
+
+	// Status code written, 0 means 500. If a status has been hinted with [ErrorStatus], it's
+	// written instead.
+	Status int
+
+	// Content type of the body, which is the status text of Status:
+	//
+	//   - "": negotiated by the request's Accept header, see [NegotiatingHandler]
+	//   - "text/html": "<h1>Not Found</h1>"
+	//   - "application/json": {"error":"not found"}
+	//   - "application/problem+json": see [ProblemDetailsHandler]
+	//   - "text/plain": see [TextHandler]
+	ContentType string
+}
+
+// Returns a new Mux created with opts, with a handler registered for every spec in specs, in
+// order, so simple mappings of errors to status codes can be kept as data, for example loaded
+// from a config file:
+//
+//	errMux := centra.BuildMux([]centra.HandlerSpec{
+//		{Err: ErrNotFound, Status: http.StatusNotFound},
+//		{Err: ErrConflict, Status: http.StatusConflict, ContentType: "application/json"},
+//	})
+//
+// More complex handlers can be registered afterwards with [Mux.Handle] and the like.
+//
+// Panics if a spec has a nil Err or an unsupported ContentType.
+func BuildMux(specs []HandlerSpec, opts ...Option) *Mux {
+	m := NewMux(opts...)
+	for _, spec := range specs {
+		if spec.Err == nil {
+			panic("centra: spec Err must not be nil")
+		}
+		m.Handle(spec.Err, spec.handler())
+	}
+	return m
+}
+
+// Sets a handler for err, like [Mux.Handle], that writes the canned response body with
+// Content-Type contentType, its Content-Length and status code status, for the simple mappings not
+// worth a closure:
+//
+//	errMux.HandleStatusCT(ErrNotFound, http.StatusNotFound, "application/json", `{"error":"not found"}`)
+//
+// If a status has been hinted with [ErrorStatus], it's written instead of status.
+func (m *Mux) HandleStatusCT(err error, status int, contentType, body string) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if status < 100 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
+	}
+
+	if contentType == "" {
+		panic("centra: contentType must not be empty")
+	}
+
+	b := []byte(body)
+
+	m.handle("HandleStatusCT", handlerStruct{
+		err: err,
+		handler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeResponse(w, r, resolveStatus(r, status), contentType, b)
+		},
+	})
+}
+
+// Outcome of an error for every transport, registered with [Mux.Register], so the HTTP response
+// and the status of other transports, like gRPC with the centragrpc package, can't drift apart.
+type OutcomeSpec struct {
+	// Status code of the HTTP response, 0 means 500. If a status has been hinted with
+	// [ErrorStatus], it's written instead.
+	Status int
+
+	// gRPC code, the value of a google.golang.org/grpc/codes.Code, so centra doesn't depend on
+	// gRPC. 0, codes.OK, means the error is not mapped for gRPC.
+	GRPCCode uint32
+
+	// Message shown to the clients instead of the message of the error, so internal details are
+	// not leaked: the message of the gRPC status and the detail of the HTTP response, which is
+	// only written if [WithVerboseErrors] is enabled. Empty means the message of the error.
+	Message string
+}
+
+// Sets a handler for err, like [Mux.Handle], generated from spec, which writes the response of
+// [NegotiatingHandler] with spec.Status, and records spec as the outcome of the errors handled by
+// it, as returned by [Mux.Outcome], so a single registration drives every transport:
+//
+//	errMux.Register(ErrNotFound, centra.OutcomeSpec{
+//		Status:   http.StatusNotFound,
+//		GRPCCode: uint32(codes.NotFound),
+//	})
+func (m *Mux) Register(err error, spec OutcomeSpec) {
+	if err == nil {
+		panic("centra: err must not be nil")
+	}
+
+	if spec.Status != 0 && (spec.Status < 100 || spec.Status > 999) {
+		panic("centra: invalid status code " + strconv.Itoa(spec.Status))
+	}
+
+	handler := NegotiatingHandler(spec.Status)
+	if spec.Message != "" {
+		// the detail is the message of the error passed to the handler
+		message := errors.New(spec.Message)
+		next := handler
+		handler = func(w http.ResponseWriter, r *http.Request, err error) {
+			next(w, r, message)
+		}
+	}
+
+	m.handle("Register", handlerStruct{
+		err:     err,
+		handler: handler,
+		outcome: &spec,
+	})
+}
+
+// Returns the spec registered with [Mux.Register] for the error whose handler would handle err,
+// the same one [Error] would pick, see [Mux.Match]. Returns false if err would be handled by a
+// handler not registered with Register, including the UnknownHandler.
+func (m *Mux) Outcome(err error) (OutcomeSpec, bool) {
+	_, _, h := m.resolve("", boundChain(err))
+	if h.outcome == nil {
+		return OutcomeSpec{}, false
+	}
+	return *h.outcome, true
+}
+
+// handler returns the error handler writing the response described by spec.
+func (spec HandlerSpec) handler() ErrorHandlerFunc {
+	status := spec.Status
+
+	if spec.ContentType == "" {
+		return NegotiatingHandler(status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(spec.ContentType)
+	if err != nil {
+		panic(fmt.Sprintf("centra: invalid content type %q in spec for %q", spec.ContentType, spec.Err))
+	}
+
+	switch mediaType {
+	case "text/html":
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			writeHTMLStatus(w, r, err, resolveStatus(r, status))
+		}
+	case "application/json":
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			writeJSONStatus(w, r, err, resolveStatus(r, status))
+		}
+	case "application/problem+json":
+		return ProblemDetailsHandler(status)
+	case "text/plain":
+		return TextHandler(status)
+	default:
+		panic(fmt.Sprintf("centra: unsupported content type %q in spec for %q", spec.ContentType, spec.Err))
+	}
+}
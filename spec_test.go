@@ -0,0 +1,286 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildMux(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errConflict := errors.New("conflict")
+	errGone := errors.New("gone")
+	errLimited := errors.New("limited")
+	errBadInput := errors.New("bad input")
+
+	errMux := BuildMux([]HandlerSpec{
+		{Err: errNotFound, Status: http.StatusNotFound},
+		{Err: errConflict, Status: http.StatusConflict, ContentType: "application/json"},
+		{Err: errGone, Status: http.StatusGone, ContentType: "text/html; charset=utf-8"},
+		{Err: errLimited, Status: http.StatusTooManyRequests, ContentType: "text/plain"},
+		{Err: errBadInput, Status: http.StatusBadRequest, ContentType: "application/problem+json"},
+	})
+
+	testCases := map[string]struct {
+		Err    error
+		Accept string
+
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"Negotiated_HTML": {
+			Err:                 errNotFound,
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Not Found</h1>",
+		},
+		"Negotiated_JSON": {
+			Err:                 errNotFound,
+			Accept:              "application/json",
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "application/json",
+			ExpectedBuf:         `{"error":"not found"}`,
+		},
+		"JSON": {
+			Err:                 fmt.Errorf("saving user: %w", errConflict),
+			Accept:              "text/html",
+			ExpectedStatus:      http.StatusConflict,
+			ExpectedContentType: "application/json",
+			ExpectedBuf:         `{"error":"conflict"}`,
+		},
+		"HTML": {
+			Err:                 errGone,
+			Accept:              "application/json",
+			ExpectedStatus:      http.StatusGone,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Gone</h1>",
+		},
+		"Text": {
+			Err:                 errLimited,
+			ExpectedStatus:      http.StatusTooManyRequests,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "Too Many Requests",
+		},
+		"Problem": {
+			Err:                 errBadInput,
+			ExpectedStatus:      http.StatusBadRequest,
+			ExpectedContentType: "application/problem+json",
+			ExpectedBuf:         `{"instance":"/","status":400,"title":"Bad Request","type":"about:blank"}`,
+		},
+		"Unknown": {
+			Err:                 errors.New("unknown"),
+			ExpectedStatus:      http.StatusInternalServerError,
+			ExpectedContentType: "text/html; charset=utf-8",
+			ExpectedBuf:         "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := SetMux(httptest.NewRequest("", "/", nil), errMux)
+			req.Header.Set("Accept", tc.Accept)
+			recorder := httptest.NewRecorder()
+
+			Error(recorder, req, tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status code %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %q, got %q", tc.ExpectedContentType, ct)
+			}
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuildMuxPanics(t *testing.T) {
+	testCases := map[string]struct {
+		Specs []HandlerSpec
+
+		ExpectedPanic string
+	}{
+		"Nil_Err": {
+			Specs:         []HandlerSpec{{Status: http.StatusNotFound}},
+			ExpectedPanic: "centra: spec Err must not be nil",
+		},
+		"Unsupported_Content_Type": {
+			Specs:         []HandlerSpec{{Err: errString("A"), ContentType: "application/xml"}},
+			ExpectedPanic: `centra: unsupported content type "application/xml" in spec for "A"`,
+		},
+		"Invalid_Content_Type": {
+			Specs:         []HandlerSpec{{Err: errString("A"), ContentType: "/"}},
+			ExpectedPanic: `centra: invalid content type "/" in spec for "A"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); tc.ExpectedPanic != r {
+					t.Fatalf("expected panic %q, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			BuildMux(tc.Specs)
+		})
+	}
+}
+
+func TestHandleStatusCT(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errMaintenance := errors.New("maintenance")
+
+	errMux := NewMux()
+	errMux.HandleStatusCT(errNotFound, http.StatusNotFound, "application/json", `{"error":"not found"}`)
+	errMux.HandleStatusCT(errMaintenance, http.StatusServiceUnavailable, "text/plain; charset=utf-8", "back soon")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBuf         string
+	}{
+		"JSON": {
+			Err:                 errNotFound,
+			ExpectedStatus:      http.StatusNotFound,
+			ExpectedContentType: "application/json",
+			ExpectedBuf:         `{"error":"not found"}`,
+		},
+		"Wrapped": {
+			Err:                 fmt.Errorf("loading page: %w", errMaintenance),
+			ExpectedStatus:      http.StatusServiceUnavailable,
+			ExpectedContentType: "text/plain; charset=utf-8",
+			ExpectedBuf:         "back soon",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status code %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+
+			if ct := recorder.Header().Get("Content-Type"); tc.ExpectedContentType != ct {
+				t.Fatalf("expected Content-Type %q, got %q", tc.ExpectedContentType, ct)
+			}
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+
+			assertResponseHeaders(t, recorder)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	errNotFound := errString("NOT_FOUND")
+	errGone := errString("GONE")
+
+	errMux := NewMux(WithVerboseErrors(true))
+	errMux.Register(errNotFound, OutcomeSpec{Status: http.StatusNotFound, GRPCCode: 5})
+	errMux.Register(errGone, OutcomeSpec{Status: http.StatusGone, Message: "resource removed"})
+	errMux.Handle(errString("OTHER"), NegotiatingHandler(http.StatusConflict))
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus  int
+		ExpectedBuf     string
+		ExpectedOutcome OutcomeSpec
+		ExpectedOK      bool
+	}{
+		"Registered": {
+			Err:             fmt.Errorf("user 42: %w", errNotFound),
+			ExpectedStatus:  http.StatusNotFound,
+			ExpectedBuf:     "<h1>Not Found</h1><p>user 42: NOT_FOUND</p>",
+			ExpectedOutcome: OutcomeSpec{Status: http.StatusNotFound, GRPCCode: 5},
+			ExpectedOK:      true,
+		},
+		"Message": {
+			Err:             errGone,
+			ExpectedStatus:  http.StatusGone,
+			ExpectedBuf:     "<h1>Gone</h1><p>resource removed</p>",
+			ExpectedOutcome: OutcomeSpec{Status: http.StatusGone, Message: "resource removed"},
+			ExpectedOK:      true,
+		},
+		"Not_Registered": {
+			Err:            errString("OTHER"),
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "<h1>Conflict</h1><p>OTHER</p>",
+			ExpectedOK:     false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			errMux.ServeError(recorder, httptest.NewRequest("", "/", nil), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+
+			outcome, ok := errMux.Outcome(tc.Err)
+			if tc.ExpectedOK != ok || tc.ExpectedOutcome != outcome {
+				t.Fatalf("expected outcome %+v %t, got %+v %t", tc.ExpectedOutcome, tc.ExpectedOK, outcome, ok)
+			}
+		})
+	}
+}
+
+func TestOutcomeBoundChain(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+	}{
+		"Cyclic": {Err: &cyclicError{}},
+		"Deep":   {Err: wrapChain(errString("A"), 10*MaxChainLength)},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.Register(errString("A"), OutcomeSpec{Status: http.StatusNotFound})
+			errMux.Register(ErrChainTooDeep, OutcomeSpec{Status: http.StatusBadRequest})
+
+			var outcome OutcomeSpec
+			var ok bool
+			assertTerminates(t, func() {
+				outcome, ok = errMux.Outcome(tc.Err)
+			})
+
+			if !ok || outcome.Status != http.StatusBadRequest {
+				t.Fatalf("expected the outcome of ErrChainTooDeep, got %+v %t", outcome, ok)
+			}
+		})
+	}
+}
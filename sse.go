@@ -0,0 +1,63 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Returns an error handler for the errors happening in the middle of a Server-Sent Events
+// stream, when the headers have already been sent, it writes an error event and flushes it:
+//
+//	event: error
+//	data: Internal Server Error
+//
+// The data is the status text of the status hinted with [ErrorStatus], 500 if none, or the
+// message of err if [WithVerboseErrors] is enabled, split in several data lines if it has
+// newlines.
+//
+// The event is only written if the Content-Type of the response is "text/event-stream", the
+// other errors are handled by the UnknownHandler, unless the response has already been written,
+// see [Written], in which case nothing is written.
+func SSEHandler() ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if mediaType != "text/event-stream" {
+			if !Written(w) {
+				callUnknown(w, r, err)
+			}
+			return
+		}
+
+		data := statusText(r, statusOr(r, http.StatusInternalServerError))
+		if detail, ok := errorDetail(r, err); ok {
+			data = detail
+		}
+
+		var frame strings.Builder
+		frame.WriteString("event: error\n")
+		for _, line := range strings.Split(data, "\n") {
+			frame.WriteString("data: ")
+			frame.WriteString(strings.TrimSuffix(line, "\r"))
+			frame.WriteString("\n")
+		}
+		frame.WriteString("\n")
+
+		MustWrite(w, []byte(frame.String()))
+		http.NewResponseController(w).Flush()
+	}
+}
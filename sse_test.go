@@ -0,0 +1,83 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEHandler(t *testing.T) {
+	errStream := errors.New("upstream closed\nretry later")
+
+	testCases := map[string]struct {
+		Stream  bool
+		Verbose bool
+
+		ExpectedStatus  int
+		ExpectedBuf     string
+		ExpectedFlushed bool
+	}{
+		"Stream": {
+			Stream:          true,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedBuf:     "data: tick\n\nevent: error\ndata: Internal Server Error\n\n",
+			ExpectedFlushed: true,
+		},
+		"Stream_Verbose": {
+			Stream:          true,
+			Verbose:         true,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedBuf:     "data: tick\n\nevent: error\ndata: upstream closed\ndata: retry later\n\n",
+			ExpectedFlushed: true,
+		},
+		"Not_A_Stream": {
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithVerboseErrors(tc.Verbose))
+			errMux.Handle(errStream, SSEHandler())
+
+			handler := errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.Stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+					io.WriteString(w, "data: tick\n\n")
+					http.NewResponseController(w).Flush()
+				}
+				Error(w, r, errStream)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("", "/events", nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+			if tc.ExpectedFlushed != recorder.Flushed {
+				t.Fatalf("expected flushed %t, got %t", tc.ExpectedFlushed, recorder.Flushed)
+			}
+		})
+	}
+}
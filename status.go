@@ -0,0 +1,156 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"strconv"
+)
+
+// StatusCoder is implemented by the errors that know the status code they should be handled with,
+// see [Mux.HandleStatus].
+type StatusCoder interface {
+	error
+	StatusCode() int
+}
+
+// Returns an error wrapping err that implements [StatusCoder] with status, so the status code can
+// be assigned at the call site and honored by the handlers registered with [Mux.HandleStatus]:
+//
+//	if err := validate(order); err != nil {
+//		return centra.WithStatus(err, http.StatusBadRequest)
+//	}
+//
+// The returned error has the same message of err and unwraps to it, so the handlers registered
+// for the errors in the chain of err still match it, and they win over the status handlers as
+// usual. Returns nil if err is nil.
+func WithStatus(err error, status int) error {
+	if status < 100 || status > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(status))
+	}
+	if err == nil {
+		return nil
+	}
+	return &withStatusError{err: err, status: status}
+}
+
+// withStatusError is the error returned by WithStatus.
+type withStatusError struct {
+	err    error
+	status int
+}
+
+func (e *withStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *withStatusError) Unwrap() error {
+	return e.err
+}
+
+func (e *withStatusError) StatusCode() int {
+	return e.status
+}
+
+// Sets handler to handle the errors that resolve to status code, this is, the ones the status
+// mapper set with [WithStatusMapper] maps to code, or the ones that have a [StatusCoder] in their
+// chain returning code, as reported by errors.As.
+//
+// The handlers registered for an error always win over the status handlers, which in turn win over
+// the ranges registered with [Mux.HandleStatusRange], the parent Mux and the UnknownHandler.
+// [Matched] returns a placeholder error describing code for the errors handled by handler.
+func (m *Mux) HandleStatus(code int, handler ErrorHandlerFunc) {
+	if code < 100 || code > 999 {
+		panic("centra: invalid status code " + strconv.Itoa(code))
+	}
+
+	if handler == nil {
+		panic("centra: handler must not be nil for status code " + strconv.Itoa(code))
+	}
+
+	m.handle("HandleStatus", handlerStruct{
+		err:     statusError{status: code},
+		handler: handler,
+		status:  code,
+	})
+}
+
+// Sets handler to handle the errors that resolve to a status code in [min, max], like
+// [Mux.HandleStatus] does for a single status code, so coarse policies can be applied to whole
+// status families, for example logging all the server errors:
+//
+//	errMux.HandleStatusRange(500, 599, logAndRespond)
+//
+// The handlers registered for an error always win, then the ones registered with HandleStatus for
+// the exact status code, then the ranges, the last registered taking precedence if several
+// contain the status code. [Matched] returns a placeholder error describing the range for the
+// errors handled by handler.
+func (m *Mux) HandleStatusRange(min, max int, handler ErrorHandlerFunc) {
+	if min < 100 || max > 999 || min > max {
+		panic("centra: invalid status code range " + strconv.Itoa(min) + "-" + strconv.Itoa(max))
+	}
+
+	if handler == nil {
+		panic("centra: handler must not be nil for status code range " + strconv.Itoa(min) + "-" + strconv.Itoa(max))
+	}
+
+	m.handle("HandleStatusRange", handlerStruct{
+		err:       statusRangeError{min: min, max: max},
+		handler:   handler,
+		status:    min,
+		statusMax: max,
+	})
+}
+
+// statusRangeError is the placeholder registered error of the handlers registered with
+// Mux.HandleStatusRange.
+type statusRangeError struct {
+	min, max int
+}
+
+func (e statusRangeError) Error() string {
+	return "centra: errors mapped to status " + strconv.Itoa(e.min) + "-" + strconv.Itoa(e.max)
+}
+
+// matchStatus returns the handler of the errors resolving to status, the exact status handlers
+// being looked up before the ranges.
+func (s *muxState) matchStatus(status int) (handlerStruct, bool) {
+	for i := len(s.handlersStack) - 1; i >= 1; i-- {
+		if h := s.handlersStack[i]; h.statusMax == 0 && h.status == status {
+			return h, true
+		}
+	}
+	for i := len(s.handlersStack) - 1; i >= 1; i-- {
+		if h := s.handlersStack[i]; h.statusMax != 0 && h.status <= status && status <= h.statusMax {
+			return h, true
+		}
+	}
+	return handlerStruct{}, false
+}
+
+// errorStatus returns the status code err resolves to, or 0 if it doesn't resolve to any, mapped
+// reports whether it was resolved by the status mapper.
+func (m *Mux) errorStatus(err error) (status int, mapped bool) {
+	if m.cfg.statusMapper != nil {
+		if status, ok := m.cfg.statusMapper(err); ok {
+			return status, true
+		}
+	}
+	var coder StatusCoder
+	if errors.As(err, &coder) {
+		return coder.StatusCode(), false
+	}
+	return 0, false
+}
@@ -0,0 +1,345 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type codedError struct {
+	code int
+}
+
+func (e codedError) Error() string {
+	return fmt.Sprintf("coded %d", e.code)
+}
+
+func (e codedError) StatusCode() int {
+	return e.code
+}
+
+func TestHandleStatus(t *testing.T) {
+	errRegistered := fmt.Errorf("registered: %w", codedError{code: http.StatusGone})
+	errMapped := errors.New("mapped")
+
+	mapper := func(err error) (int, bool) {
+		if errors.Is(err, errMapped) {
+			return http.StatusGone, true
+		}
+		return 0, false
+	}
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"StatusCoder": {
+			Err: codedError{code: http.StatusNotFound},
+
+			ExpectedStatus: http.StatusNotFound,
+			ExpectedBuf:    "404 page",
+		},
+		"StatusCoder_Wrapped": {
+			Err: fmt.Errorf("wrapped: %w", codedError{code: http.StatusConflict}),
+
+			ExpectedStatus: http.StatusConflict,
+			ExpectedBuf:    "409 page",
+		},
+		"Mapped": {
+			Err: errMapped,
+
+			ExpectedStatus: http.StatusGone,
+			ExpectedBuf:    "410 page",
+		},
+		"Error_Handler_Wins": {
+			Err: errRegistered,
+
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "registered",
+		},
+		"No_Status_Handler": {
+			Err: codedError{code: http.StatusBadRequest},
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+		"No_Status": {
+			Err: errors.New("other"),
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	page := func(status int) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "%d page", status)
+		}
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithStatusMapper(mapper))
+			errMux.Handle(errRegistered, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, "registered")
+			})
+			for _, status := range []int{http.StatusNotFound, http.StatusConflict, http.StatusGone} {
+				errMux.HandleStatus(status, page(status))
+			}
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleStatusRange(t *testing.T) {
+	errRegistered := fmt.Errorf("registered: %w", codedError{code: http.StatusBadGateway})
+	errMapped := errors.New("mapped")
+
+	mapper := func(err error) (int, bool) {
+		if errors.Is(err, errMapped) {
+			return http.StatusInsufficientStorage, true
+		}
+		return 0, false
+	}
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedStatus int
+		ExpectedBuf    string
+		ExpectedMatch  string
+	}{
+		"Range": {
+			Err: codedError{code: http.StatusServiceUnavailable},
+
+			ExpectedStatus: http.StatusServiceUnavailable,
+			ExpectedBuf:    "5xx page",
+			ExpectedMatch:  "centra: errors mapped to status 500-599",
+		},
+		"Range_Bounds": {
+			Err: codedError{code: http.StatusInternalServerError},
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "5xx page",
+			ExpectedMatch:  "centra: errors mapped to status 500-599",
+		},
+		"Latest_Range_Wins": {
+			Err: codedError{code: 522},
+
+			ExpectedStatus: 522,
+			ExpectedBuf:    "origin page",
+			ExpectedMatch:  "centra: errors mapped to status 520-529",
+		},
+		"Mapped": {
+			Err: errMapped,
+
+			ExpectedStatus: http.StatusInsufficientStorage,
+			ExpectedBuf:    "5xx page",
+			ExpectedMatch:  "centra: errors mapped to status 500-599",
+		},
+		"Exact_Status_Wins": {
+			Err: codedError{code: http.StatusNotImplemented},
+
+			ExpectedStatus: http.StatusNotImplemented,
+			ExpectedBuf:    "501 page",
+			ExpectedMatch:  "centra: errors mapped to status 501",
+		},
+		"Error_Handler_Wins": {
+			Err: errRegistered,
+
+			ExpectedStatus: http.StatusTeapot,
+			ExpectedBuf:    "registered",
+			ExpectedMatch:  errRegistered.Error(),
+		},
+		"Out_Of_Range": {
+			Err: codedError{code: http.StatusNotFound},
+
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux(WithStatusMapper(mapper))
+			errMux.HandleStatusRange(500, 599, func(w http.ResponseWriter, r *http.Request, err error) {
+				var coder StatusCoder
+				if errors.As(err, &coder) {
+					w.WriteHeader(coder.StatusCode())
+				} else {
+					w.WriteHeader(http.StatusInsufficientStorage)
+				}
+				io.WriteString(w, "5xx page")
+			})
+			errMux.HandleStatusRange(520, 529, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(522)
+				io.WriteString(w, "origin page")
+			})
+			errMux.HandleStatus(http.StatusNotImplemented, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotImplemented)
+				io.WriteString(w, "501 page")
+			})
+			errMux.Handle(errRegistered, func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusTeapot)
+				io.WriteString(w, "registered")
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+
+			match, ok := errMux.Match(tc.Err)
+			if tc.ExpectedMatch == "" {
+				if ok {
+					t.Fatalf("expected no match, got %v", match)
+				}
+			} else if !ok || tc.ExpectedMatch != match.Error() {
+				t.Fatalf("expected match %q, got %v", tc.ExpectedMatch, match)
+			}
+		})
+	}
+}
+
+func TestHandleStatusRangePanics(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	testCases := map[string]struct {
+		Call func()
+
+		ExpectedPanic string
+	}{
+		"Min_Too_Low": {
+			Call:          func() { NewMux().HandleStatusRange(99, 599, handler) },
+			ExpectedPanic: "centra: invalid status code range 99-599",
+		},
+		"Max_Too_High": {
+			Call:          func() { NewMux().HandleStatusRange(500, 1000, handler) },
+			ExpectedPanic: "centra: invalid status code range 500-1000",
+		},
+		"Inverted": {
+			Call:          func() { NewMux().HandleStatusRange(599, 500, handler) },
+			ExpectedPanic: "centra: invalid status code range 599-500",
+		},
+		"Nil_Handler": {
+			Call:          func() { NewMux().HandleStatusRange(500, 599, nil) },
+			ExpectedPanic: "centra: handler must not be nil for status code range 500-599",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); tc.ExpectedPanic != r {
+					t.Fatalf("expected panic %q, got %v", tc.ExpectedPanic, r)
+				}
+			}()
+
+			tc.Call()
+		})
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	errSentinel := errString("SENTINEL")
+	errOther := errString("OTHER")
+
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"Status_Honored": {
+			Err:         WithStatus(errOther, http.StatusBadRequest),
+			ExpectedBuf: "400: OTHER",
+		},
+		"Status_Honored_Wrapped": {
+			Err:         fmt.Errorf("creating order: %w", WithStatus(errOther, http.StatusBadRequest)),
+			ExpectedBuf: "400: creating order: OTHER",
+		},
+		"Sentinel_Wins": {
+			Err:         WithStatus(fmt.Errorf("repo: %w", errSentinel), http.StatusBadRequest),
+			ExpectedBuf: "sentinel",
+		},
+		"Other_Status": {
+			Err:         WithStatus(errOther, http.StatusConflict),
+			ExpectedBuf: "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "unknown")
+			})
+			errMux.Handle(errSentinel, func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "sentinel")
+			})
+			errMux.HandleStatus(http.StatusBadRequest, func(w http.ResponseWriter, r *http.Request, err error) {
+				fmt.Fprintf(w, "400: %v", err)
+			})
+
+			recorder := httptest.NewRecorder()
+			Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), tc.Err)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithStatusChain(t *testing.T) {
+	errSentinel := errString("SENTINEL")
+	err := WithStatus(fmt.Errorf("repo: %w", errSentinel), http.StatusNotFound)
+
+	var coder StatusCoder
+	if !errors.As(err, &coder) || coder.StatusCode() != http.StatusNotFound {
+		t.Fatalf("expected status %d to be readable", http.StatusNotFound)
+	}
+	if !errors.Is(err, errSentinel) {
+		t.Fatal("expected the sentinel to be matchable")
+	}
+	if expected := "repo: SENTINEL"; err.Error() != expected {
+		t.Fatalf("expected message %q, got %q", expected, err.Error())
+	}
+	if WithStatus(nil, http.StatusNotFound) != nil {
+		t.Fatal("expected nil for a nil error")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// Registers handler to handle the errors that have an error of type T in their chain, as
+// reported by errors.As, the handler receives that error already asserted to T:
+//
+//	centra.HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err *NotFoundError) {
+//		// err.Resource is available without calling errors.As
+//	})
+//
+// It follows the same precedence of [Mux.Handle], and [Matched] returns a placeholder error
+// describing T for the errors handled by handler.
+func HandleType[T error](m *Mux, handler func(w http.ResponseWriter, r *http.Request, err T)) {
+	if handler == nil {
+		panic("centra: handler must not be nil for error type " + reflect.TypeFor[T]().String())
+	}
+
+	m.handle("HandleType", handlerStruct{
+		err: typeError{typ: reflect.TypeFor[T]()},
+		handler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var target T
+			errors.As(err, &target)
+			handler(w, r, target)
+		},
+		matcher: AsMatcher[T](),
+	})
+}
+
+// typeError is the placeholder registered error of the handlers registered with HandleType.
+type typeError struct {
+	typ reflect.Type
+}
+
+func (e typeError) Error() string {
+	return "centra: errors of type " + e.typ.String()
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type NotFoundError struct {
+	Resource string
+	ID       int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %d not found", e.Resource, e.ID)
+}
+
+func TestHandleType(t *testing.T) {
+	testCases := map[string]struct {
+		Err error
+
+		ExpectedBuf string
+	}{
+		"Direct": {
+			Err:         &NotFoundError{Resource: "user", ID: 1},
+			ExpectedBuf: "user:1",
+		},
+		"Wrapped": {
+			Err:         fmt.Errorf("service: %w", &NotFoundError{Resource: "order", ID: 2}),
+			ExpectedBuf: "order:2",
+		},
+		"Other_Type": {
+			Err:         errString("err"),
+			ExpectedBuf: "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "unknown")
+			})
+			HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err *NotFoundError) {
+				if _, ok := Matched(r); !ok {
+					t.Fatalf("expected a placeholder matched error")
+				}
+				fmt.Fprintf(w, "%s:%d", err.Resource, err.ID)
+			})
+
+			req := httptest.NewRequest("", "/", nil)
+			recorder := httptest.NewRecorder()
+
+			errMux.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Error(w, r, tc.Err)
+			})).ServeHTTP(recorder, req)
+
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %s, got %s", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlersTypePlaceholder(t *testing.T) {
+	errMux := NewMux()
+	HandleType(errMux, func(w http.ResponseWriter, r *http.Request, err *NotFoundError) {})
+
+	handlers := errMux.Handlers()
+	if len(handlers) != 1 {
+		t.Fatalf("expected 1 handler, got %d", len(handlers))
+	}
+	if expected := "centra: errors of type *centra.NotFoundError"; handlers[0].Error() != expected {
+		t.Fatalf("expected %s, got %s", expected, handlers[0].Error())
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import "net/http"
+
+// responseWriter wraps the http.ResponseWriter passed to the handlers selected by Error, it
+// records whether the response has been written, see Written.
+type responseWriter struct {
+	http.ResponseWriter
+
+	// status code written, 0 if the header has not been written yet
+	status int
+
+	// Mux guarding the response against calls to Error after a success, see Mux.GuardSuccess
+	guard *Mux
+
+	// defer the status code until the first write, see DeferHeader
+	deferHeader bool
+
+	// status code deferred by WriteHeader, 0 if there is none
+	pending int
+
+	defaults
+}
+
+// defaults of the responses written through a responseWriter, set by the Mux dispatching the
+// error.
+type defaults struct {
+	// status code written by Write if the header has not been written yet, 0 means http.StatusOK,
+	// see WithImplicitStatus
+	implicitStatus int
+
+	// Content-Type set when the header is written without one, empty means none, see
+	// WithDefaultContentType
+	defaultContentType string
+
+	// called with req when writing the body fails, nil means disabled, see WithWriteErrorHook
+	writeErrorHook func(r *http.Request, err error)
+	req            *http.Request
+}
+
+// wrapWriter returns w wrapped in a responseWriter, or w itself if it's already wrapping one.
+func wrapWriter(w http.ResponseWriter) http.ResponseWriter {
+	if findWriter(w) != nil {
+		return w
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.deferHeader && rw.status == 0 && statusCode >= 200 {
+		if rw.pending == 0 {
+			rw.pending = statusCode
+		}
+		return
+	}
+	rw.writeHeader(statusCode)
+}
+
+// writeHeader writes the header with statusCode, without deferring it.
+func (rw *responseWriter) writeHeader(statusCode int) {
+	if rw.status == 0 && statusCode >= 200 {
+		// informational headers (1xx) may be followed by the actual header
+		rw.status = statusCode
+		rw.setDefaultContentType(statusCode)
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		if rw.pending != 0 {
+			rw.writePending()
+		} else if rw.implicitStatus != 0 {
+			rw.WriteHeader(rw.implicitStatus)
+		} else {
+			rw.status = http.StatusOK
+			rw.setDefaultContentType(http.StatusOK)
+		}
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// writePending writes the header with the status code deferred by WriteHeader, if any.
+func (rw *responseWriter) writePending() {
+	if rw.status == 0 && rw.pending != 0 {
+		status := rw.pending
+		rw.pending = 0
+		rw.writeHeader(status)
+	}
+}
+
+// FlushError writes the deferred status code, if any, before flushing the wrapped writer, see
+// [http.ResponseController].
+func (rw *responseWriter) FlushError() error {
+	rw.writePending()
+	return http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Returns a middleware that defers the status code written by the handlers of next until the
+// first write of the body, so a call to [Error] made after a premature WriteHeader, like a
+// WriteHeader(http.StatusOK) before the rendering fails halfway, can still write the status of
+// the error instead:
+//
+//	router.Use(errMux.Handler, centra.DeferHeader)
+//
+//	w.WriteHeader(http.StatusOK)
+//	if err := render(w, data); err != nil {
+//		centra.Error(w, r, err) // 500, instead of a superfluous WriteHeader
+//	}
+//
+// The deferred status is written along with the first write of the body, when the response is
+// flushed with [http.ResponseController], or once next returns. Error discards it and handles the
+// error as usual, once the body has been written the status can't be changed anymore. [Written]
+// reports false while the status is deferred, and the headers set after WriteHeader are sent too,
+// unlike with net/http.
+func DeferHeader(next http.Handler) http.Handler {
+	if next == nil {
+		panic("centra: next must not be nil")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = wrapWriter(w)
+		rw := findWriter(w)
+		rw.deferHeader = true
+
+		next.ServeHTTP(w, r)
+
+		rw.deferHeader = false
+		rw.writePending()
+	})
+}
+
+// setDefaultContentType sets the default Content-Type, if any, as the header is being written with
+// status, unless a Content-Type has already been set or status doesn't allow a body.
+func (rw *responseWriter) setDefaultContentType(status int) {
+	if rw.defaultContentType == "" || status == http.StatusNoContent || status == http.StatusNotModified {
+		return
+	}
+	if _, ok := rw.Header()["Content-Type"]; !ok {
+		rw.Header().Set("Content-Type", rw.defaultContentType)
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, so [http.ResponseController] can reach its
+// Flusher, Hijacker and deadline capabilities.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// findWriter returns the responseWriter wrapped by w, following the Unwrap methods of the
+// writers in between, or nil if there is none.
+func findWriter(w http.ResponseWriter) *responseWriter {
+	for w != nil {
+		if rw, ok := w.(*responseWriter); ok {
+			return rw
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// Writes b to w, like w.Write(b), reporting the error to the hook set with [WithWriteErrorHook]
+// if it fails, most likely because the client is gone, so the custom handlers report their write
+// failures like the built-in ones do:
+//
+//	centra.MustWrite(w, page)
+//
+// Nothing is reported if w is not a writer passed by [Error] to an error handler, or wrapping one,
+// see [Written].
+func MustWrite(w http.ResponseWriter, b []byte) {
+	if _, err := w.Write(b); err != nil {
+		reportWriteError(w, err)
+	}
+}
+
+// reportWriteError reports err, returned by writing the body to w, to the hook set with
+// WithWriteErrorHook, if any.
+func reportWriteError(w http.ResponseWriter, err error) {
+	if rw := findWriter(w); rw != nil && rw.writeErrorHook != nil {
+		rw.writeErrorHook(rw.req, err)
+	}
+}
+
+// reportingWriter is an io.Writer writing to the http.ResponseWriter with MustWrite.
+type reportingWriter struct {
+	w http.ResponseWriter
+}
+
+func (rw reportingWriter) Write(b []byte) (int, error) {
+	n, err := rw.w.Write(b)
+	if err != nil {
+		reportWriteError(rw.w, err)
+	}
+	return n, err
+}
+
+// Reports whether the status code or the body of the response have already been written to w.
+//
+// It works for the writers passed by [Error] to the error handlers, and for any writer wrapping
+// them that implements "Unwrap() http.ResponseWriter", like the ones used with
+// [http.ResponseController]. For any other writer, it reports false.
+//
+// Handlers that may run after another one has already written the response, like the ones
+// composed with [Chain], use it to avoid writing twice.
+func Written(w http.ResponseWriter) bool {
+	rw := findWriter(w)
+	return rw != nil && rw.status != 0
+}
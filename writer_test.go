@@ -0,0 +1,190 @@
+// Copyright 2024 Oscar Pernia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package centra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (u unwrappingWriter) Unwrap() http.ResponseWriter {
+	return u.ResponseWriter
+}
+
+func TestWritten(t *testing.T) {
+	testCases := map[string]struct {
+		Handler ErrorHandlerFunc
+
+		ExpectedWritten bool
+	}{
+		"Nothing": {
+			Handler:         func(w http.ResponseWriter, r *http.Request, err error) {},
+			ExpectedWritten: false,
+		},
+		"Header_Only": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.Header().Set("X-Custom", "1")
+			},
+			ExpectedWritten: false,
+		},
+		"Informational": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusEarlyHints)
+			},
+			ExpectedWritten: false,
+		},
+		"WriteHeader": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			ExpectedWritten: true,
+		},
+		"Write": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(w, "1")
+			},
+			ExpectedWritten: true,
+		},
+		"Write_Through_Wrapper": {
+			Handler: func(w http.ResponseWriter, r *http.Request, err error) {
+				io.WriteString(unwrappingWriter{w}, "1")
+			},
+			ExpectedWritten: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var written bool
+
+			errMux := NewMux()
+			errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				tc.Handler(w, r, err)
+				written = Written(unwrappingWriter{w})
+			})
+
+			Error(httptest.NewRecorder(), SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+			if tc.ExpectedWritten != written {
+				t.Fatalf("expected written %v, got %v", tc.ExpectedWritten, written)
+			}
+		})
+	}
+
+	if Written(httptest.NewRecorder()) {
+		t.Fatalf("expected a writer not passed by Error to report not written")
+	}
+}
+
+func TestWriterUnwrap(t *testing.T) {
+	errMux := NewMux()
+	errMux.UnknownHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Fatalf("expected Flush to reach the underlying writer: %v", err)
+		}
+	})
+
+	recorder := httptest.NewRecorder()
+	Error(recorder, SetMux(httptest.NewRequest("", "/", nil), errMux), errString("A"))
+
+	if !recorder.Flushed {
+		t.Fatalf("expected recorder to be flushed")
+	}
+}
+
+func TestDeferHeader(t *testing.T) {
+	testCases := map[string]struct {
+		Handler http.HandlerFunc
+		Guard   bool
+
+		ExpectedStatus int
+		ExpectedBuf    string
+	}{
+		"Error_Overrides_Deferred_Status": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				Error(w, r, errString("A"))
+			},
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+		"Error_Overrides_Deferred_Status_Guarded": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				Error(w, r, errString("A"))
+			},
+			Guard:          true,
+			ExpectedStatus: http.StatusInternalServerError,
+			ExpectedBuf:    "<h1>Internal Server Error</h1>",
+		},
+		"Written_On_First_Write": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				if Written(w) {
+					panic("expected the status to be deferred")
+				}
+				io.WriteString(w, "created")
+			},
+			ExpectedStatus: http.StatusCreated,
+			ExpectedBuf:    "created",
+		},
+		"Written_On_Return": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			ExpectedStatus: http.StatusNoContent,
+			ExpectedBuf:    "",
+		},
+		"Written_On_Flush": {
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				http.NewResponseController(w).Flush()
+				if !Written(w) {
+					panic("expected the status to be written by Flush")
+				}
+			},
+			ExpectedStatus: http.StatusAccepted,
+			ExpectedBuf:    "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errMux := NewMux()
+
+			var handler http.Handler = DeferHeader(tc.Handler)
+			if tc.Guard {
+				handler = errMux.GuardSuccess(handler)
+			}
+			handler = errMux.Handler(handler)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
+
+			if tc.ExpectedStatus != recorder.Code {
+				t.Fatalf("expected status %d, got %d", tc.ExpectedStatus, recorder.Code)
+			}
+			if tc.ExpectedBuf != recorder.Body.String() {
+				t.Fatalf("expected %q, got %q", tc.ExpectedBuf, recorder.Body.String())
+			}
+		})
+	}
+}